@@ -12,6 +12,8 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+
+	"babylon/dataloader/money"
 )
 
 const (
@@ -104,8 +106,8 @@ type Transaction struct {
 	DatePosted string `json:"datePosted"`
 	// Description of the transaction.
 	Description string `json:"description"`
-	// Amount posted in the transaction.
-	Amount float64 `json:"amount"`
+	// Amount posted in the transaction, in minor units of its currency.
+	Amount money.Money `json:"amount"`
 	// Slip number from an external institution.
 	SlipNumber string `json:"slipNumber,omitempty"`
 }
@@ -0,0 +1,474 @@
+// Package camtparser reads ISO 20022 camt.053 end-of-day statements and camt.052 intraday reports.
+package camtparser
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	csvparser "babylon/dataloader/csv"
+	"babylon/dataloader/datalake/datasource"
+	"babylon/dataloader/money"
+)
+
+// Elements that open a statement in each message type.
+const (
+	elementStatement = "Stmt" // camt.053
+	elementReport    = "Rpt"  // camt.052
+	elementEntry     = "Ntry"
+)
+
+// Statement kinds reported in csvparser.Statement.Kind.
+const (
+	KindStatement = "camt.053"
+	KindReport    = "camt.052"
+)
+
+// Keys of the records produced by the parser. They line up with the default column mapping.
+const (
+	FieldPostingDate    = "posting date"
+	FieldValueDate      = "value date"
+	FieldAmount         = "amount"
+	FieldCurrency       = "currency"
+	FieldDescription    = "description"
+	FieldDetails        = "details"
+	FieldType           = "type"
+	FieldMemo           = "memo"
+	FieldEndToEndID     = "end to end id"
+	FieldEntryReference = "entry reference"
+	FieldStatementID    = "statement id"
+)
+
+// Credit/debit indicators and the details they map to.
+const (
+	indicatorCredit = "CRDT"
+	indicatorDebit  = "DBIT"
+	detailsCredit   = "CREDIT"
+	detailsDebit    = "DEBIT"
+)
+
+// Balance type codes. Intraday reports may carry interim or previously closed balances instead.
+var (
+	openingBalanceCodes = []string{"OPBD", "PRCD"}
+	closingBalanceCodes = []string{"CLBD", "ITBD"}
+)
+
+const (
+	// statusBooked marks entries that have been booked to the account; pending and
+	// informational entries are not ingested and do not move the balance.
+	statusBooked = "BOOK"
+	// isoDateLength is the length of the date part of an ISO 8601 date or date-time.
+	isoDateLength = len("2006-01-02")
+	// namespacePrefix begins the namespace of every camt.052, camt.053 and camt.054 document.
+	namespacePrefix = "urn:iso:std:iso:20022:tech:xsd:camt.05"
+)
+
+// numericFields are the record fields written as plain decimals, which are read whatever
+// the data source's locale.
+var numericFields = map[string]bool{FieldAmount: true}
+
+var errInvalidCamt = errors.New("invalid camt statement")
+
+// InvalidCamtError is returned when a statement cannot be read.
+func InvalidCamtError(filePath string, reason string) error {
+	return fmt.Errorf("%w, %s: %s", errInvalidCamt, filePath, reason)
+}
+
+// Parser is a csvparser.Parser for camt.053 and camt.052 XML files.
+type Parser struct {
+	// Banks resolves the servicing bank's BIC to a data source.
+	Banks *datasource.Registry
+}
+
+// NewParser creates a new Parser that resolves BICs with the built-in bank profiles.
+func NewParser() *Parser {
+	return &Parser{Banks: datasource.DefaultRegistry()}
+}
+
+// Supports reports whether filePath is a camt document, judging by its root element's
+// namespace, so that other XML files are left to other parsers.
+func (p *Parser) Supports(filePath string) bool {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	decoder := xml.NewDecoder(file)
+	for {
+		tok, tokErr := decoder.Token()
+		if tokErr != nil {
+			return false
+		}
+		if el, ok := tok.(xml.StartElement); ok {
+			return el.Name.Local == "Document" && strings.HasPrefix(el.Name.Space, namespacePrefix)
+		}
+	}
+}
+
+// ---- XML document model ----
+
+type amount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type dateChoice struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+// iso returns the date part of the element, preferring Dt over DtTm.
+func (d dateChoice) iso() string {
+	value := d.Date
+	if value == "" {
+		value = d.DateTime
+	}
+	if len(value) > isoDateLength {
+		value = value[:isoDateLength]
+	}
+	return value
+}
+
+// status accepts both the plain code of camt versions up to 7 and the <Cd> element of later versions.
+type status struct {
+	Text string `xml:",chardata"`
+	Code string `xml:"Cd"`
+}
+
+func (s status) code() string {
+	if s.Code != "" {
+		return strings.TrimSpace(s.Code)
+	}
+	return strings.TrimSpace(s.Text)
+}
+
+type account struct {
+	IBAN  string `xml:"Id>IBAN"`
+	Other string `xml:"Id>Othr>Id"`
+	BIC   string `xml:"Svcr>FinInstnId>BIC"`
+	BICFI string `xml:"Svcr>FinInstnId>BICFI"`
+}
+
+// id returns the account's IBAN, or its other identification, without spaces.
+func (a account) id() string {
+	id := a.IBAN
+	if id == "" {
+		id = a.Other
+	}
+	return strings.ReplaceAll(strings.TrimSpace(id), " ", "")
+}
+
+type balance struct {
+	Type      string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount    amount     `xml:"Amt"`
+	Indicator string     `xml:"CdtDbtInd"`
+	Date      dateChoice `xml:"Dt"`
+}
+
+// party carries a name directly up to camt version 7 and under Pty from version 8.
+type party struct {
+	Name      string `xml:"Nm"`
+	PartyName string `xml:"Pty>Nm"`
+}
+
+func (p party) name() string {
+	if name := strings.TrimSpace(p.Name); name != "" {
+		return name
+	}
+	return strings.TrimSpace(p.PartyName)
+}
+
+type transactionDetails struct {
+	EndToEndID   string   `xml:"Refs>EndToEndId"`
+	Unstructured []string `xml:"RmtInf>Ustrd"`
+	CreditorRef  []string `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+	Debtor       party    `xml:"RltdPties>Dbtr"`
+	Creditor     party    `xml:"RltdPties>Cdtr"`
+}
+
+type entry struct {
+	Reference      string               `xml:"NtryRef"`
+	Amount         amount               `xml:"Amt"`
+	Indicator      string               `xml:"CdtDbtInd"`
+	Status         status               `xml:"Sts"`
+	BookingDate    dateChoice           `xml:"BookgDt"`
+	ValueDate      dateChoice           `xml:"ValDt"`
+	ServicerRef    string               `xml:"AcctSvcrRef"`
+	TransactionCd  string               `xml:"BkTxCd>Prtry>Cd"`
+	Details        []transactionDetails `xml:"NtryDtls>TxDtls"`
+	AdditionalInfo string               `xml:"AddtlNtryInf"`
+}
+
+// ---- Parsing ----
+
+// Parse streams every booked entry in the file to handle and reports each statement's balances.
+func (p *Parser) Parse(
+	ctx context.Context,
+	filePath string,
+	_ string,
+	_ string,
+	handle csvparser.RecordHandler,
+) (csvparser.Summary, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return csvparser.Summary{}, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	var (
+		summary csvparser.Summary
+		current *csvparser.Statement
+	)
+	decoder := xml.NewDecoder(file)
+	for {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return summary, fmt.Errorf("parsing %s was interrupted: %w", filePath, ctxErr)
+		}
+
+		tok, tokErr := decoder.Token()
+		if errors.Is(tokErr, io.EOF) {
+			break
+		}
+		if tokErr != nil {
+			return summary, InvalidCamtError(filePath, tokErr.Error())
+		}
+
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case el.Name.Local == elementStatement || el.Name.Local == elementReport:
+				current = &csvparser.Statement{Kind: kindOf(el.Name.Local)}
+			case current == nil:
+				continue
+			case el.Name.Local == "Id" && current.ID == "":
+				var id string
+				if err = decoder.DecodeElement(&id, &el); err != nil {
+					return summary, InvalidCamtError(filePath, err.Error())
+				}
+				current.ID = strings.TrimSpace(id)
+			case el.Name.Local == "Acct":
+				var acct account
+				if err = decoder.DecodeElement(&acct, &el); err != nil {
+					return summary, InvalidCamtError(filePath, err.Error())
+				}
+				current.AccountID = acct.id()
+			case el.Name.Local == "Bal":
+				var bal balance
+				if err = decoder.DecodeElement(&bal, &el); err != nil {
+					return summary, InvalidCamtError(filePath, err.Error())
+				}
+				if err = setBalance(current, bal); err != nil {
+					return summary, InvalidCamtError(filePath, err.Error())
+				}
+			case el.Name.Local == elementEntry:
+				line, _ := decoder.InputPos()
+				var ntry entry
+				if err = decoder.DecodeElement(&ntry, &el); err != nil {
+					return summary, InvalidCamtError(filePath, err.Error())
+				}
+				if code := ntry.Status.code(); code != "" && code != statusBooked {
+					continue
+				}
+				// An entry whose amount cannot be read is rejected, not the file.
+				result := csvparser.Record{Line: int64(line)}
+				if record, recordErr := toRecord(ntry, current.ID); recordErr != nil {
+					result.Reject, result.Detail = csvparser.RejectInvalidEntry, recordErr.Error()
+				} else {
+					result.Fields, result.Numeric = record, numericFields
+				}
+				if handleErr := handle(ctx, result); handleErr != nil {
+					return summary, handleErr
+				}
+				summary.Records++
+			}
+		case xml.EndElement:
+			if current != nil && (el.Name.Local == elementStatement || el.Name.Local == elementReport) {
+				summary.Statements = append(summary.Statements, *current)
+				current = nil
+			}
+		}
+	}
+
+	return summary, nil
+}
+
+// ParseInfo reads the account of the file's first statement. The data source is the bank
+// profile the servicing bank's BIC belongs to, and is empty when the bank is not known.
+func (p *Parser) ParseInfo(ctx context.Context, filePath string) (*datasource.SourceInfo, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	decoder := xml.NewDecoder(file)
+	for {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("reading %s was interrupted: %w", filePath, ctxErr)
+		}
+
+		tok, tokErr := decoder.Token()
+		if errors.Is(tokErr, io.EOF) {
+			return nil, datasource.ErrUnableToExtractInfo
+		}
+		if tokErr != nil {
+			return nil, InvalidCamtError(filePath, tokErr.Error())
+		}
+
+		el, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch el.Name.Local {
+		case "Acct":
+			var acct account
+			if err = decoder.DecodeElement(&acct, &el); err != nil {
+				return nil, InvalidCamtError(filePath, err.Error())
+			}
+			if acct.id() == "" {
+				return nil, datasource.ErrUnableToExtractInfo
+			}
+			bic := acct.BIC
+			if bic == "" {
+				bic = acct.BICFI
+			}
+			info := &datasource.SourceInfo{AccountID: acct.id()}
+			if p.Banks != nil {
+				if profile, found := p.Banks.MatchBIC(bic); found {
+					info.DataSource = string(profile.DataSource)
+				}
+			}
+			return info, nil
+		case elementEntry:
+			// The account always precedes the entries.
+			return nil, datasource.ErrUnableToExtractInfo
+		}
+	}
+}
+
+func kindOf(element string) string {
+	if element == elementReport {
+		return KindReport
+	}
+	return KindStatement
+}
+
+// setBalance records bal as the statement's opening or closing balance, if it is one.
+func setBalance(statement *csvparser.Statement, bal balance) error {
+	isOpening := slices.Contains(openingBalanceCodes, bal.Type)
+	isClosing := slices.Contains(closingBalanceCodes, bal.Type)
+	if !isOpening && !isClosing {
+		return nil
+	}
+
+	value, err := signedAmount(bal.Amount, bal.Indicator)
+	if err != nil {
+		return fmt.Errorf("balance %s: %w", bal.Type, err)
+	}
+	parsed := &csvparser.Balance{Amount: value, Date: bal.Date.iso()}
+
+	// Booked balances take precedence over the interim and previous-day balances of reports.
+	switch {
+	case isOpening && (statement.Opening == nil || bal.Type == openingBalanceCodes[0]):
+		statement.Opening = parsed
+	case isClosing && (statement.Closing == nil || bal.Type == closingBalanceCodes[0]):
+		statement.Closing = parsed
+	}
+	return nil
+}
+
+// toRecord maps an entry to record fields. Amounts are signed, negative for debits.
+func toRecord(ntry entry, statementID string) (map[string]string, error) {
+	value, err := signedAmount(ntry.Amount, ntry.Indicator)
+	if err != nil {
+		return nil, err
+	}
+	bookingDate := ntry.BookingDate.iso()
+	if bookingDate == "" {
+		bookingDate = ntry.ValueDate.iso()
+	}
+
+	details := detailsCredit
+	if ntry.Indicator == indicatorDebit {
+		details = detailsDebit
+	}
+
+	var (
+		endToEndIDs []string
+		remittance  []string
+		counterpart string
+	)
+	for _, tx := range ntry.Details {
+		if id := strings.TrimSpace(tx.EndToEndID); id != "" && id != "NOTPROVIDED" {
+			endToEndIDs = append(endToEndIDs, id)
+		}
+		remittance = append(remittance, tx.Unstructured...)
+		remittance = append(remittance, tx.CreditorRef...)
+		if counterpart == "" {
+			counterpart = tx.counterparty(ntry.Indicator)
+		}
+	}
+
+	description := counterpart
+	if description == "" {
+		description = strings.TrimSpace(ntry.AdditionalInfo)
+	}
+	reference := ntry.ServicerRef
+	if reference == "" {
+		reference = ntry.Reference
+	}
+
+	return map[string]string{
+		FieldPostingDate:    bookingDate,
+		FieldValueDate:      ntry.ValueDate.iso(),
+		FieldAmount:         value.Decimal(),
+		FieldCurrency:       value.Currency,
+		FieldDescription:    description,
+		FieldDetails:        details,
+		FieldType:           ntry.TransactionCd,
+		FieldMemo:           joinNonEmpty(remittance, " "),
+		FieldEndToEndID:     strings.Join(endToEndIDs, ","),
+		FieldEntryReference: reference,
+		FieldStatementID:    statementID,
+	}, nil
+}
+
+// counterparty names the other side of the transaction: the creditor of a debit or the debtor of a credit.
+func (tx transactionDetails) counterparty(indicator string) string {
+	if indicator == indicatorDebit {
+		return tx.Creditor.name()
+	}
+	return tx.Debtor.name()
+}
+
+// signedAmount parses an unsigned camt amount and applies its credit/debit indicator.
+func signedAmount(value amount, indicator string) (money.Money, error) {
+	parsed, err := money.Parse(value.Value, value.Currency)
+	if err != nil {
+		return money.Money{}, err
+	}
+	switch indicator {
+	case indicatorDebit:
+		return parsed.Neg(), nil
+	case indicatorCredit:
+		return parsed, nil
+	default:
+		return money.Money{}, fmt.Errorf("invalid credit/debit indicator %q", indicator)
+	}
+}
+
+func joinNonEmpty(values []string, sep string) string {
+	kept := make([]string, 0, len(values))
+	for _, value := range values {
+		if trimmed := strings.TrimSpace(value); trimmed != "" {
+			kept = append(kept, trimmed)
+		}
+	}
+	return strings.Join(kept, sep)
+}
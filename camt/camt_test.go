@@ -0,0 +1,261 @@
+package camtparser_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "babylon/dataloader/camt"
+	csvparser "babylon/dataloader/csv"
+	"babylon/dataloader/datalake/datasource"
+	"babylon/dataloader/datalake/mapping"
+	"babylon/dataloader/money"
+)
+
+const statement053 = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+  <BkToCstmrStmt>
+    <GrpHdr><MsgId>MSG-1</MsgId><CreDtTm>2023-02-01T06:00:00</CreDtTm></GrpHdr>
+    <Stmt>
+      <Id>STMT-2023-01-31</Id>
+      <Acct>
+        <Id><IBAN>DE89370400440532013000</IBAN></Id>
+        <Svcr><FinInstnId><BIC>CHASDEFX</BIC></FinInstnId></Svcr>
+      </Acct>
+      <Bal>
+        <Tp><CdOrPrtry><Cd>OPBD</Cd></CdOrPrtry></Tp>
+        <Amt Ccy="EUR">1000.00</Amt><CdtDbtInd>CRDT</CdtDbtInd>
+        <Dt><Dt>2023-01-30</Dt></Dt>
+      </Bal>
+      <Bal>
+        <Tp><CdOrPrtry><Cd>CLBD</Cd></CdOrPrtry></Tp>
+        <Amt Ccy="EUR">1225.50</Amt><CdtDbtInd>CRDT</CdtDbtInd>
+        <Dt><Dt>2023-01-31</Dt></Dt>
+      </Bal>
+      <Ntry>
+        <Amt Ccy="EUR">24.50</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts>BOOK</Sts>
+        <BookgDt><Dt>2023-01-31</Dt></BookgDt>
+        <ValDt><Dt>2023-02-01</Dt></ValDt>
+        <AcctSvcrRef>REF-1</AcctSvcrRef>
+        <NtryDtls><TxDtls>
+          <Refs><EndToEndId>E2E-1</EndToEndId></Refs>
+          <RltdPties><Cdtr><Nm>Stadtwerke</Nm></Cdtr></RltdPties>
+          <RmtInf><Ustrd>Invoice 42</Ustrd><Ustrd>January</Ustrd></RmtInf>
+        </TxDtls></NtryDtls>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="EUR">250.00</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <Sts>BOOK</Sts>
+        <BookgDt><DtTm>2023-01-31T12:00:00+01:00</DtTm></BookgDt>
+        <AcctSvcrRef>REF-2</AcctSvcrRef>
+        <NtryDtls><TxDtls>
+          <Refs><EndToEndId>NOTPROVIDED</EndToEndId></Refs>
+          <RltdPties><Dbtr><Nm>ACME GmbH</Nm></Dbtr></RltdPties>
+        </TxDtls></NtryDtls>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="EUR">99.00</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts>PDNG</Sts>
+        <BookgDt><Dt>2023-01-31</Dt></BookgDt>
+      </Ntry>
+    </Stmt>
+  </BkToCstmrStmt>
+</Document>
+`
+
+const report052 = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.052.001.08">
+  <BkToCstmrAcctRpt>
+    <Rpt>
+      <Id>RPT-1</Id>
+      <Acct><Id><Othr><Id>123456789</Id></Othr></Id></Acct>
+      <Bal>
+        <Tp><CdOrPrtry><Cd>PRCD</Cd></CdOrPrtry></Tp>
+        <Amt Ccy="USD">10.00</Amt><CdtDbtInd>DBIT</CdtDbtInd>
+        <Dt><Dt>2023-03-14</Dt></Dt>
+      </Bal>
+      <Ntry>
+        <Amt Ccy="USD">5.00</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <Sts><Cd>BOOK</Cd></Sts>
+        <BookgDt><Dt>2023-03-15</Dt></BookgDt>
+        <NtryDtls><TxDtls><RltdPties><Dbtr><Pty><Nm>Jane Doe</Nm></Pty></Dbtr></RltdPties></TxDtls></NtryDtls>
+      </Ntry>
+    </Rpt>
+  </BkToCstmrAcctRpt>
+</Document>
+`
+
+// writeStatement writes a camt document to a temporary directory.
+func writeStatement(t *testing.T, content string) string {
+	filePath := filepath.Join(t.TempDir(), "statement.xml")
+	if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write test camt file: %v", err)
+	}
+	return filePath
+}
+
+func TestParse_InvalidEntry(t *testing.T) {
+	records, summary := parseAll(t, writeStatement(t, strings.Replace(statement053, ">24.50<", ">24,5x<", 1)))
+	if len(summary.Statements) != 1 || int(summary.Records) != len(records) {
+		t.Fatalf("Expected the statement to be read, got %+v", summary)
+	}
+	// The entry with an unreadable amount is rejected; the rest of the statement is read.
+	rejected := records[0]
+	if rejected.Reject != csvparser.RejectInvalidEntry || rejected.Line == 0 || rejected.Detail == "" {
+		t.Errorf("Expected the first entry to be rejected as an invalid entry, got %+v", rejected)
+	}
+	if valid := records[1]; valid.Reject != "" || valid.Fields[FieldAmount] != "250.00" {
+		t.Errorf("Expected the next entry to be read, got %+v", valid)
+	}
+}
+
+// parseAll runs the parser over filePath and collects every record it yields.
+func parseAll(t *testing.T, filePath string) ([]csvparser.Record, csvparser.Summary) {
+	var records []csvparser.Record
+	summary, err := NewParser().Parse(context.Background(), filePath, "", "",
+		func(_ context.Context, record csvparser.Record) error {
+			records = append(records, record)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	return records, summary
+}
+
+func TestParse_Statement(t *testing.T) {
+	records, summary := parseAll(t, writeStatement(t, statement053))
+	if len(records) != 2 || summary.Records != 2 {
+		t.Fatalf("Expected the 2 booked entries, got %d (summary %d)", len(records), summary.Records)
+	}
+
+	want := map[string]string{
+		FieldPostingDate:    "2023-01-31",
+		FieldValueDate:      "2023-02-01",
+		FieldAmount:         "-24.50",
+		FieldCurrency:       "EUR",
+		FieldDescription:    "Stadtwerke",
+		FieldDetails:        "DEBIT",
+		FieldMemo:           "Invoice 42 January",
+		FieldEndToEndID:     "E2E-1",
+		FieldEntryReference: "REF-1",
+		FieldStatementID:    "STMT-2023-01-31",
+	}
+	for key, value := range want {
+		if got := records[0].Fields[key]; got != value {
+			t.Errorf("Expected %s %q, got %q", key, value, got)
+		}
+	}
+
+	second := records[1].Fields
+	if second[FieldPostingDate] != "2023-01-31" || second[FieldAmount] != "250.00" ||
+		second[FieldDescription] != "ACME GmbH" || second[FieldEndToEndID] != "" {
+		t.Errorf("Unexpected credit record %v", second)
+	}
+
+	if len(summary.Statements) != 1 {
+		t.Fatalf("Expected 1 statement, got %d", len(summary.Statements))
+	}
+	statement := summary.Statements[0]
+	if statement.ID != "STMT-2023-01-31" || statement.Kind != KindStatement || statement.AccountID != "DE89370400440532013000" {
+		t.Errorf("Unexpected statement %+v", statement)
+	}
+	if statement.Opening == nil || statement.Opening.Amount != money.New(100000, "EUR") || statement.Opening.Date != "2023-01-30" {
+		t.Errorf("Unexpected opening balance %+v", statement.Opening)
+	}
+	if statement.Closing == nil || statement.Closing.Amount != money.New(122550, "EUR") {
+		t.Errorf("Unexpected closing balance %+v", statement.Closing)
+	}
+}
+
+func TestParse_Report(t *testing.T) {
+	records, summary := parseAll(t, writeStatement(t, report052))
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(records))
+	}
+	if got := records[0].Fields[FieldDescription]; got != "Jane Doe" {
+		t.Errorf("Expected the debtor's party name, got %q", got)
+	}
+
+	statement := summary.Statements[0]
+	if statement.Kind != KindReport || statement.Opening == nil || statement.Opening.Amount.Minor != -1000 {
+		t.Errorf("Expected a report opening on an overdrawn previous close, got %+v", statement)
+	}
+	if statement.Closing != nil {
+		t.Errorf("Expected no closing balance, got %+v", statement.Closing)
+	}
+}
+
+func TestParseInfo(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		want    datasource.SourceInfo
+	}{
+		"iban with known bic": {statement053, datasource.SourceInfo{DataSource: "chase", AccountID: "DE89370400440532013000"}},
+		"other id":            {report052, datasource.SourceInfo{AccountID: "123456789"}},
+		"iban with other bic": {
+			strings.Replace(statement053, "CHASDEFX", "BOFAUS3N", 1),
+			datasource.SourceInfo{DataSource: "bankofamerica", AccountID: "DE89370400440532013000"},
+		},
+		"iban with unknown bic": {
+			strings.Replace(statement053, "CHASDEFX", "DEUTDEFF", 1),
+			datasource.SourceInfo{AccountID: "DE89370400440532013000"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			info, err := NewParser().ParseInfo(context.Background(), writeStatement(t, tt.content))
+			if err != nil {
+				t.Fatalf("ParseInfo failed: %v", err)
+			}
+			if *info != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, *info)
+			}
+		})
+	}
+}
+
+func TestSupports(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		want    bool
+	}{
+		"camt.053":        {statement053, true},
+		"camt.052":        {report052, true},
+		"other namespace": {`<?xml version="1.0"?><Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.001.001.03"/>`, false},
+		"other document":  {`<?xml version="1.0"?><rss version="2.0"><channel/></rss>`, false},
+		"not xml":         {"Posting Date,Amount\n", false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := NewParser().Supports(writeStatement(t, tt.content)); got != tt.want {
+				t.Errorf("Expected Supports to be %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParse_AmountsIgnoreLocale(t *testing.T) {
+	records, _ := parseAll(t, writeStatement(t, statement053))
+	profile := mapping.DefaultProfile()
+	profile.Locale = "de-DE"
+
+	// Amounts are written as plain decimals, which a German profile must not read as
+	// thousands.
+	amount, err := profile.ReadAmount(records[0].Fields, records[0].Numeric, "EUR")
+	if err != nil {
+		t.Fatalf("ReadAmount failed: %v", err)
+	}
+	if amount != money.New(-2450, "EUR") {
+		t.Errorf("Expected -24.50 EUR, got %v", amount)
+	}
+}
@@ -12,5 +12,12 @@ type Config struct {
 	MoveProcessedFiles bool
 	SyntheticDataDir   string
 	SyntheticDataRows  int
+	IngestBatchSize    int
+	CSVDialectsFile    string
+	XLSXSheetsFile     string
+	MappingFile        string
+	FXRatesFile        string
+	ReportingCurrency  string
+	RequireAccounts    bool
 	Timeout            time.Duration
 }
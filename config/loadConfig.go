@@ -6,6 +6,7 @@ import (
 	"net"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	bcontext "babylon/dataloader/appcontext"
@@ -23,6 +24,8 @@ const (
 	defaultMoveProcessedFiles = false
 	defaultSyntheticDataDir   = "tmp/synthetic"
 	defaultSyntheticDataRows  = 100
+	defaultIngestBatchSize    = 500
+	defaultReportingCurrency  = "USD"
 	envMongoURI               = "MONGO_URI"
 	envMongoHost              = "MONGO_HOST"
 	envCSVDirectory           = "CSV_DIR"
@@ -31,6 +34,13 @@ const (
 	envMoveProcessedFiles     = "MOVE_PROCESSED_FILES"
 	envMongoUser              = "MONGO_USER"
 	envMongoPassword          = "MONGO_PASSWORD"
+	envIngestBatchSize        = "INGEST_BATCH_SIZE"
+	envCSVDialectsFile        = "CSV_DIALECTS_FILE"
+	envXLSXSheetsFile         = "XLSX_SHEETS_FILE"
+	envMappingFile            = "MAPPING_FILE"
+	envFXRatesFile            = "FX_RATES_FILE"
+	envReportingCurrency      = "REPORTING_CURRENCY"
+	envRequireAccounts        = "REQUIRE_REGISTERED_ACCOUNTS"
 )
 
 // LoadConfig loads the application configuration from environment variables or uses default values.
@@ -71,6 +81,8 @@ func LoadConfig(ctx context.Context) *Config {
 	syntheticDataRows := defaultSyntheticDataRows
 	// TODO: Add environment variable parsing for syntheticDataDir and syntheticDataRows if needed
 
+	ingestBatchSize := getIngestBatchSize(ctx)
+
 	return &Config{
 		MongoURI:           mongoURI,
 		UnprocessedDir:     unprocessedDir,
@@ -78,10 +90,78 @@ func LoadConfig(ctx context.Context) *Config {
 		MoveProcessedFiles: moveProcessedFiles,
 		SyntheticDataDir:   syntheticDataDir,
 		SyntheticDataRows:  syntheticDataRows,
+		IngestBatchSize:    ingestBatchSize,
+		CSVDialectsFile:    os.Getenv(envCSVDialectsFile),
+		XLSXSheetsFile:     os.Getenv(envXLSXSheetsFile),
+		MappingFile:        os.Getenv(envMappingFile),
+		FXRatesFile:        os.Getenv(envFXRatesFile),
+		ReportingCurrency:  getReportingCurrency(ctx),
+		RequireAccounts:    getRequireAccounts(ctx),
 		Timeout:            defaultTimeoutSeconds * time.Second,
 	}
 }
 
+// Fetch the `INGEST_BATCH_SIZE` env var or fall back to a default value.
+func getIngestBatchSize(ctx context.Context) int {
+	logger := bcontext.LoggerFromContext(ctx)
+	batchSizeStr := os.Getenv(envIngestBatchSize)
+	if batchSizeStr == "" {
+		logger.DebugContext(ctx, "Using default ingest batch size", "value", defaultIngestBatchSize)
+		return defaultIngestBatchSize
+	}
+
+	batchSize, err := strconv.Atoi(batchSizeStr)
+	if err != nil || batchSize <= 0 {
+		logger.WarnContext(
+			ctx,
+			"Invalid value for INGEST_BATCH_SIZE, using default",
+			"value", batchSizeStr,
+			"default", defaultIngestBatchSize,
+			"error", err,
+		)
+		return defaultIngestBatchSize
+	}
+	logger.DebugContext(ctx, "Set ingest batch size from environment variable", "value", batchSize)
+
+	return batchSize
+}
+
+// Fetch the `REPORTING_CURRENCY` env var or fall back to a default value.
+func getReportingCurrency(ctx context.Context) string {
+	logger := bcontext.LoggerFromContext(ctx)
+	currency := strings.ToUpper(strings.TrimSpace(os.Getenv(envReportingCurrency)))
+	if currency == "" {
+		logger.DebugContext(ctx, "Using default reporting currency", "value", defaultReportingCurrency)
+		return defaultReportingCurrency
+	}
+	logger.DebugContext(ctx, "Set reporting currency from environment variable", "value", currency)
+
+	return currency
+}
+
+// Fetch the `REQUIRE_REGISTERED_ACCOUNTS` env var or fall back to registering unknown accounts.
+func getRequireAccounts(ctx context.Context) bool {
+	logger := bcontext.LoggerFromContext(ctx)
+	requireStr := os.Getenv(envRequireAccounts)
+	if requireStr == "" {
+		return false
+	}
+
+	require, err := strconv.ParseBool(requireStr)
+	if err != nil {
+		logger.WarnContext(
+			ctx,
+			"Invalid value for REQUIRE_REGISTERED_ACCOUNTS, registering unknown accounts",
+			"value", requireStr,
+			"error", err,
+		)
+		return false
+	}
+	logger.DebugContext(ctx, "Set requireAccounts from environment variable", "value", require)
+
+	return require
+}
+
 func setEnvCSVDir(ctx context.Context) string {
 	logger := bcontext.LoggerFromContext(ctx)
 	csvDirectory := os.Getenv(envCSVDirectory)
@@ -1,6 +1,8 @@
 package csvparser
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/csv"
 	"errors"
@@ -11,9 +13,11 @@ import (
 )
 
 var (
-	errTargetFileNotFound = errors.New("the valid target file was not found")
-	errInvalidDataSource  = errors.New("data source is not valid")
-	errProcessCsv         = errors.New("error while parsing CSV file")
+	errTargetFileNotFound  = errors.New("the valid target file was not found")
+	errInvalidDataSource   = errors.New("data source is not valid")
+	errProcessCsv          = errors.New("error while parsing CSV file")
+	errUnsupportedEncoding = errors.New("unsupported text encoding")
+	errInvalidDialect      = errors.New("invalid CSV dialect")
 )
 
 func ValidFileNotFoundError(path string) error {
@@ -28,75 +32,213 @@ func ProcessCsvError(filename string) error {
 	return fmt.Errorf("%s, %w", filename, errProcessCsv)
 }
 
+// UnsupportedEncodingError is returned when a configured encoding is unknown.
+func UnsupportedEncodingError(encoding string) error {
+	return fmt.Errorf("%w, %s", errUnsupportedEncoding, encoding)
+}
+
+// InvalidDialectError is returned when a configured dialect override cannot be used.
+func InvalidDialectError(detail string) error {
+	return fmt.Errorf("%w, %s", errInvalidDialect, detail)
+}
+
 // DefaultParser is a concrete implementation of the Parser interface.
-type DefaultParser struct{}
+// The delimiter, quote style, encoding and byte order mark of each file are
+// sniffed from its first bytes unless overridden for the file's data source.
+type DefaultParser struct {
+	// Overrides holds per-data-source dialect settings that take precedence over detection.
+	Overrides map[string]Dialect
+	// Headers names, in order, the columns of each data source whose files have no header
+	// row. The first row of such a file is read as data.
+	Headers map[string][]string
+}
 
 // NewDefaultParser creates a new DefaultParser instance.
 func NewDefaultParser() *DefaultParser {
 	return &DefaultParser{}
 }
 
-// Parse reads a CSV file from a given path and returns the data.
+// Parse streams a CSV file from a given path, calling handle for every complete row.
+// It returns the number of rows handed to handle and the dialect the file was read with.
 func (p *DefaultParser) Parse(
-	_ context.Context,
+	ctx context.Context,
 	filePath string,
+	dataSource string,
 	_ string,
-	_ string,
-) ([]map[string]string, int64, error) {
+	handle RecordHandler,
+) (Summary, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to open file %s: %w", filePath, err)
+		return Summary{}, fmt.Errorf("failed to open file %s: %w", filePath, err)
 	}
 	defer file.Close()
 
-	reader := csv.NewReader(file)
-	reader.FieldsPerRecord = -1
-	reader.Comma = ','
+	source, dialect, err := p.openDialect(file, dataSource)
+	if err != nil {
+		return Summary{}, fmt.Errorf("failed to detect dialect of file %s: %w", filePath, err)
+	}
+	summary := Summary{Dialect: &dialect}
+
+	raw := &rawRecorder{reader: source}
+	reader := p.newRowReader(raw, dataSource, dialect)
 
 	// Read header and create column index map
-	header, err := reader.Read()
-	if err != nil {
-		if errors.Is(err, io.EOF) {
-			return nil, 0, nil // Handle empty file gracefully
+	header := p.Headers[dataSource]
+	if len(header) == 0 {
+		header, err = reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return summary, nil // Handle empty file gracefully
+			}
+			return summary, fmt.Errorf("failed to read CSV header from file %s: %w", filePath, err)
 		}
-		return nil, 0, fmt.Errorf("failed to read CSV header from file %s: %w", filePath, err)
+		raw.consume(reader.InputOffset())
 	}
+	headerLen := len(header)
 	colIndex := make(map[string]int)
 	for i, col := range header {
 		colIndex[strings.ToLower(col)] = i
 	}
 
-	var documents []map[string]string
-
-	var recordsProcessed int64
-
 	for {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return summary, fmt.Errorf("parsing %s was interrupted: %w", filePath, ctxErr)
+		}
+
 		record, readErr := reader.Read()
 		if readErr != nil {
 			if errors.Is(readErr, io.EOF) {
 				break
 			}
-			return nil, 0, fmt.Errorf("failed to read record from CSV in file %s: %w", filePath, readErr)
+			return summary, fmt.Errorf("failed to read record from CSV in file %s: %w", filePath, readErr)
 		}
 
-		if len(record) < len(header) {
+		line, _ := reader.FieldPos(0)
+		rawLine := raw.consume(reader.InputOffset())
+
+		if len(record) < headerLen {
+			if handleErr := handle(ctx, Record{Line: int64(line), Raw: rawLine, Reject: RejectShortRow}); handleErr != nil {
+				return summary, handleErr
+			}
+			summary.Records++
 			continue
 		}
 
-		doc := make(map[string]string)
+		doc := make(map[string]string, len(colIndex))
 		for key, idx := range colIndex {
 			doc[key] = safeGet(record, idx)
 		}
 
-		documents = append(documents, doc)
-		recordsProcessed++
+		if handleErr := handle(ctx, Record{Line: int64(line), Fields: doc, Raw: rawLine}); handleErr != nil {
+			return summary, handleErr
+		}
+		summary.Records++
+	}
+
+	return summary, nil
+}
+
+// newRowReader reads rows in dialect. Quote characters are read as ordinary characters
+// only when the data source's override sets QuoteNone: a sniffed QuoteNone only means the
+// sample had no quotes, and rows further on still may.
+func (p *DefaultParser) newRowReader(r io.Reader, dataSource string, dialect Dialect) rowReader {
+	if p.Overrides[dataSource].Quote == QuoteNone {
+		return newPlainReader(r, dialect.delimiterRune())
+	}
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comma = dialect.delimiterRune()
+	reader.LazyQuotes = dialect.Quote == QuoteLazy
+	reader.ReuseRecord = true
+	return reader
+}
+
+// openDialect sniffs the byte order mark, encoding, delimiter and quote style of file,
+// applies any override for dataSource, and returns a UTF-8 reader positioned after the BOM.
+func (p *DefaultParser) openDialect(file io.Reader, dataSource string) (io.Reader, Dialect, error) {
+	buffered := bufio.NewReaderSize(file, sniffSize)
+	encoding, sample, bom, err := sniffEncoding(buffered)
+	if err != nil {
+		return nil, Dialect{}, err
+	}
+
+	override := p.Overrides[dataSource]
+	if override.Encoding != "" {
+		if encoding, err = normalizeEncoding(override.Encoding); err != nil {
+			return nil, Dialect{}, err
+		}
+		override.Encoding = encoding
+	}
+
+	decodedSample, err := io.ReadAll(newDecodingReader(bytes.NewReader(sample), encoding))
+	if err != nil {
+		return nil, Dialect{}, fmt.Errorf("failed to decode file sample: %w", err)
 	}
 
-	if len(documents) == 0 {
-		return nil, 0, nil
+	dialect := sniffDialect(string(decodedSample))
+	dialect.Encoding = encoding
+	dialect.BOM = bom
+	dialect = dialect.withOverride(override)
+
+	return newDecodingReader(buffered, dialect.Encoding), dialect, nil
+}
+
+// NewDecoder returns r's text as UTF-8, after any byte order mark, sniffing its encoding the
+// way Parse does for a data source without an encoding override.
+func NewDecoder(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReaderSize(r, sniffSize)
+	encoding, _, _, err := sniffEncoding(buffered)
+	if err != nil {
+		return nil, err
 	}
+	return newDecodingReader(buffered, encoding), nil
+}
+
+// sniffEncoding detects the encoding of buffered from its byte order mark and a sample of
+// its text, and skips the mark. It returns the sample after the mark and whether there was one.
+func sniffEncoding(buffered *bufio.Reader) (string, []byte, bool, error) {
+	sample, err := buffered.Peek(sniffSize)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return "", nil, false, fmt.Errorf("failed to read file sample: %w", err)
+	}
+
+	encoding, bomLen := detectBOM(sample)
+	if _, err = buffered.Discard(bomLen); err != nil {
+		return "", nil, false, fmt.Errorf("failed to skip byte order mark: %w", err)
+	}
+	sample = sample[bomLen:]
+	// Some exporters prepend a UTF-8 BOM to Windows-1252 text, so the BOM alone is not trusted.
+	if encoding == "" || encoding == EncodingUTF8 {
+		encoding = detectEncoding(sample)
+	}
+	return encoding, sample, bomLen > 0, nil
+}
+
+// rawRecorder keeps the text read through it until consumed, so each row's original
+// text can be recovered from the csv.Reader's input offsets.
+type rawRecorder struct {
+	reader io.Reader
+	buf    []byte
+	// offset is the input offset of buf[0].
+	offset int64
+}
 
-	return documents, recordsProcessed, nil
+func (r *rawRecorder) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.buf = append(r.buf, p[:n]...)
+	return n, err
+}
+
+// consume returns the text up to the input offset end, without its line ending, and discards it.
+func (r *rawRecorder) consume(end int64) string {
+	n := int(end - r.offset)
+	if n > len(r.buf) {
+		n = len(r.buf)
+	}
+	text := strings.TrimRight(string(r.buf[:n]), "\r\n")
+	r.buf = r.buf[:copy(r.buf, r.buf[n:])]
+	r.offset = end
+	return text
 }
 
 // safeGet retrieves slice[index] safely.
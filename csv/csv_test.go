@@ -2,6 +2,7 @@ package csvparser_test
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
@@ -9,6 +10,8 @@ import (
 
 	. "babylon/dataloader/csv"
 	"babylon/dataloader/datalake/datasource"
+	"babylon/dataloader/datalake/mapping"
+	"babylon/dataloader/money"
 )
 
 // createTempCSV creates a temporary CSV file with the given content.
@@ -21,6 +24,25 @@ func createTempCSV(t *testing.T, filename, content string) string {
 	return filePath
 }
 
+// parseAll runs the parser over filePath and collects every row it yields, leaving out rejects.
+func parseAll(
+	ctx context.Context,
+	parser Parser,
+	filePath string,
+	dataSource string,
+	accountID string,
+) ([]map[string]string, int64, error) {
+	var data []map[string]string
+	summary, err := parser.Parse(ctx, filePath, dataSource, accountID,
+		func(_ context.Context, record Record) error {
+			if record.Reject == "" {
+				data = append(data, record.Fields)
+			}
+			return nil
+		})
+	return data, summary.Records, err
+}
+
 func TestParseCSV_Success(t *testing.T) {
 	ctx := context.Background()
 	csvContent := `Details,Posting Date,Description,Category,Amount,Type,Balance,Check or Slip #
@@ -31,7 +53,7 @@ CREDIT,01/02/2024,"ONLINE PAYMENT THANK YOU",Payment,1000.00,PAYMENT,10114.36,`
 	accountID := "1234"
 
 	parser := NewDefaultParser()
-	data, recordsProcessed, err := parser.Parse(ctx, filePath, dataSource, accountID)
+	data, recordsProcessed, err := parseAll(ctx, parser, filePath, dataSource, accountID)
 	if err != nil {
 		t.Fatalf("Parse failed: %v", err)
 	}
@@ -104,7 +126,7 @@ func TestParseCSV_DifferentColumnOrder(t *testing.T) {
 	accountID := "5678"
 
 	parser := NewDefaultParser()
-	data, _, err := parser.Parse(ctx, filePath, dataSource, accountID)
+	data, _, err := parseAll(ctx, parser, filePath, dataSource, accountID)
 	if err != nil {
 		t.Fatalf("Parse with reordered columns failed: %v", err)
 	}
@@ -153,12 +175,23 @@ DEBIT,01/01/2024,Test,Shopping,-75.77` // Missing columns
 	dataSource := string(datasource.Generic)
 
 	parser := NewDefaultParser()
-	data, _, err := parser.Parse(ctx, filePath, dataSource, "0000")
+	var records []Record
+	_, err := parser.Parse(ctx, filePath, dataSource, "0000",
+		func(_ context.Context, record Record) error {
+			records = append(records, record)
+			return nil
+		})
 	if err != nil {
 		t.Fatalf("Parse failed: %v", err)
 	}
-	if len(data) != 0 {
-		t.Errorf("Expected 0 documents, got %d", len(data))
+	if len(records) != 1 {
+		t.Fatalf("Expected the short row to be handed over, got %d records", len(records))
+	}
+	if records[0].Reject != RejectShortRow || records[0].Fields != nil {
+		t.Errorf("Expected a %s reject without fields, got %+v", RejectShortRow, records[0])
+	}
+	if records[0].Raw != "DEBIT,01/01/2024,Test,Shopping,-75.77" {
+		t.Errorf("Expected the original row text, got %q", records[0].Raw)
 	}
 }
 
@@ -170,7 +203,7 @@ DEBIT,InvalidDate,Test,Shopping,-75.77,DEBIT_CARD,11190.76,`
 	dataSource := string(datasource.Generic)
 
 	parser := NewDefaultParser()
-	data, _, err := parser.Parse(ctx, filePath, dataSource, "0000")
+	data, _, err := parseAll(ctx, parser, filePath, dataSource, "0000")
 	if err != nil {
 		t.Fatalf("Parse failed: %v", err)
 	}
@@ -191,7 +224,7 @@ func TestParseCSV_EmptyFile(t *testing.T) {
 	dataSource := string(datasource.Generic)
 
 	parser := NewDefaultParser()
-	data, recordsProcessed, err := parser.Parse(ctx, filePath, dataSource, "0000")
+	data, recordsProcessed, err := parseAll(ctx, parser, filePath, dataSource, "0000")
 	if err != nil {
 		t.Fatalf("Expected Parse to succeed for empty file, but got error: %v", err)
 	}
@@ -209,7 +242,7 @@ func TestParseCSV_FileNotFound(t *testing.T) {
 	dataSource := string(datasource.Generic)
 
 	parser := NewDefaultParser()
-	_, _, err := parser.Parse(ctx, filePath, dataSource, "0000")
+	_, _, err := parseAll(ctx, parser, filePath, dataSource, "0000")
 	if err == nil {
 		t.Fatalf("Expected Parse to fail for file not found, but got nil error")
 	}
@@ -218,3 +251,112 @@ func TestParseCSV_FileNotFound(t *testing.T) {
 		t.Errorf("Expected error message to contain '%s', got '%s'", expectedErrorMsg, err.Error())
 	}
 }
+
+func TestParseCSV_LineNumbers(t *testing.T) {
+	ctx := context.Background()
+	csvContent := `Details,Posting Date,Description,Amount
+DEBIT,01/01/2024,"MULTI
+LINE",-1.00
+DEBIT,01/02/2024,Short
+CREDIT,01/03/2024,Refund,5.00`
+	filePath := createTempCSV(t, "generic_lines.csv", csvContent)
+
+	var records []Record
+	parser := NewDefaultParser()
+	_, err := parser.Parse(ctx, filePath, string(datasource.Generic), "0000",
+		func(_ context.Context, record Record) error {
+			records = append(records, record)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	expected := []struct {
+		line   int64
+		raw    string
+		reject string
+	}{
+		{2, "DEBIT,01/01/2024,\"MULTI\nLINE\",-1.00", ""},
+		{4, "DEBIT,01/02/2024,Short", RejectShortRow},
+		{5, "CREDIT,01/03/2024,Refund,5.00", ""},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("Expected %d records, got %d", len(expected), len(records))
+	}
+	for i, want := range expected {
+		got := records[i]
+		if got.Line != want.line || got.Raw != want.raw || got.Reject != want.reject {
+			t.Errorf("Record %d: expected line %d %q (%q), got line %d %q (%q)",
+				i, want.line, want.raw, want.reject, got.Line, got.Raw, got.Reject)
+		}
+	}
+}
+
+func TestParseCSV_HandlerErrorStopsParsing(t *testing.T) {
+	ctx := context.Background()
+	csvContent := `Details,Posting Date,Description,Amount
+DEBIT,01/01/2024,One,-1.00
+DEBIT,01/02/2024,Two,-2.00
+DEBIT,01/03/2024,Three,-3.00`
+	filePath := createTempCSV(t, "generic_stop.csv", csvContent)
+	stopErr := errors.New("stop")
+
+	calls := 0
+	parser := NewDefaultParser()
+	summary, err := parser.Parse(ctx, filePath, string(datasource.Generic), "0000",
+		func(_ context.Context, _ Record) error {
+			calls++
+			if calls == 2 {
+				return stopErr
+			}
+			return nil
+		})
+	if !errors.Is(err, stopErr) {
+		t.Fatalf("Expected handler error to be returned, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected handler to be called twice, got %d", calls)
+	}
+	if summary.Records != 1 {
+		t.Errorf("Expected 1 record processed, got %d", summary.Records)
+	}
+}
+
+func TestParseCSV_HeaderlessWellsFargo(t *testing.T) {
+	ctx := context.Background()
+	// Wells Fargo exports have no header row: date, amount, "*", check number, description.
+	csvContent := `"01/31/2023","-75.77","*","","PURCHASE AUTHORIZED ON 01/30 WHOLEFDS HAR 10 OAKLAND CA S383030758186014 CARD 1234"
+"01/30/2023","2500.00","*","","ACME CORP PAYROLL PPD ID: 1234567890"
+"01/27/2023","-120.00","*","1042","CHECK # 1042"
+`
+	filePath := createTempCSV(t, "WellsFargo1234.csv", csvContent)
+	dataSource := string(datasource.WellsFargo)
+
+	registry := datasource.DefaultRegistry()
+	parser := NewDefaultParser()
+	parser.Headers = registry.Headers()
+	data, recordsProcessed, err := parseAll(ctx, parser, filePath, dataSource, "1234")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if recordsProcessed != 3 || len(data) != 3 {
+		t.Fatalf("Expected every row to be read as data, got %d records", recordsProcessed)
+	}
+
+	profile := mapping.Default().WithDefaults(registry.Mappings()).Resolve(dataSource)
+	check := data[2]
+	if date := profile.Value(check, mapping.FieldPostingDate); date != "01/27/2023" {
+		t.Errorf("Expected posting date 01/27/2023, got %q", date)
+	}
+	if number := profile.Value(check, mapping.FieldCheckOrSlipNum); number != "1042" {
+		t.Errorf("Expected check number 1042, got %q", number)
+	}
+	if description := profile.Value(check, mapping.FieldDescription); description != "CHECK # 1042" {
+		t.Errorf("Expected description CHECK # 1042, got %q", description)
+	}
+	amount, err := profile.Amount(check, "USD")
+	if err != nil || amount != money.New(-12000, "USD") {
+		t.Errorf("Expected amount -120.00 USD, got %v (%v)", amount, err)
+	}
+}
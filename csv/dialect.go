@@ -0,0 +1,225 @@
+package csvparser
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Quote styles recognised by the sniffer.
+const (
+	// QuoteStandard means fields may be wrapped in double quotes, RFC 4180 style.
+	QuoteStandard = "standard"
+	// QuoteNone means no quote characters were seen. As an override, it means quote
+	// characters are never special and are read as part of the field.
+	QuoteNone = "none"
+	// QuoteLazy means quotes appear inside unquoted fields and are read literally.
+	QuoteLazy = "lazy"
+)
+
+const (
+	// sniffSize is the number of bytes inspected to detect the dialect.
+	sniffSize = 64 * 1024
+	// sniffLines is the number of lines inspected to detect the delimiter.
+	sniffLines = 20
+)
+
+// candidateDelimiters are tried in order; earlier entries win ties.
+const candidateDelimiters = ",;\t|"
+
+// Dialect describes how a delimited text file is laid out on disk.
+type Dialect struct {
+	// Delimiter is the single character separating fields.
+	Delimiter string `json:"delimiter,omitempty"`
+	// Quote is one of QuoteStandard, QuoteNone or QuoteLazy.
+	Quote string `json:"quote,omitempty"`
+	// Encoding is the text encoding of the file, e.g. "utf-8" or "windows-1252".
+	Encoding string `json:"encoding,omitempty"`
+	// BOM reports whether the file started with a byte order mark.
+	BOM bool `json:"bom"`
+}
+
+// delimiterRune returns the delimiter as a rune, defaulting to a comma.
+func (d Dialect) delimiterRune() rune {
+	if d.Delimiter == "" {
+		return ','
+	}
+	r, _ := utf8.DecodeRuneInString(d.Delimiter)
+	return r
+}
+
+// withOverride returns d with every non-empty field of override applied on top.
+func (d Dialect) withOverride(override Dialect) Dialect {
+	if override.Delimiter != "" {
+		d.Delimiter = override.Delimiter
+	}
+	if override.Quote != "" {
+		d.Quote = override.Quote
+	}
+	if override.Encoding != "" {
+		d.Encoding = override.Encoding
+	}
+	return d
+}
+
+// validate checks that a configured dialect can be used by the parser.
+func (d Dialect) validate() error {
+	if d.Delimiter != "" {
+		r, size := utf8.DecodeRuneInString(d.Delimiter)
+		if size != len(d.Delimiter) || r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+			return InvalidDialectError(fmt.Sprintf("delimiter %q", d.Delimiter))
+		}
+	}
+	switch d.Quote {
+	case "", QuoteStandard, QuoteNone, QuoteLazy:
+	default:
+		return InvalidDialectError("quote " + d.Quote)
+	}
+	if d.Encoding != "" {
+		if _, err := normalizeEncoding(d.Encoding); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadDialects reads per-data-source dialect overrides from a JSON file of the form
+// {"chase": {"delimiter": ";", "encoding": "windows-1252"}}.
+func LoadDialects(path string) (map[string]Dialect, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dialect overrides %s: %w", path, err)
+	}
+
+	var dialects map[string]Dialect
+	if err = json.Unmarshal(data, &dialects); err != nil {
+		return nil, fmt.Errorf("failed to decode dialect overrides %s: %w", path, err)
+	}
+
+	for source, dialect := range dialects {
+		if err = dialect.validate(); err != nil {
+			return nil, fmt.Errorf("invalid dialect override for %s: %w", source, err)
+		}
+		if dialect.Encoding != "" {
+			// validate has already checked the encoding is known.
+			dialect.Encoding, _ = normalizeEncoding(dialect.Encoding)
+			dialects[source] = dialect
+		}
+	}
+
+	return dialects, nil
+}
+
+// sniffDialect guesses the delimiter and quote style from a decoded sample of the file.
+func sniffDialect(sample string) Dialect {
+	lines := sampleLines(sample)
+	dialect := Dialect{Delimiter: sniffDelimiter(lines)}
+	dialect.Quote = sniffQuote(lines, dialect.delimiterRune())
+
+	return dialect
+}
+
+// sampleLines returns up to sniffLines non-empty lines, dropping a possibly truncated last line.
+func sampleLines(sample string) []string {
+	lines := strings.Split(strings.ReplaceAll(sample, "\r\n", "\n"), "\n")
+	if len(lines) > 1 && len(sample) >= sniffSize {
+		lines = lines[:len(lines)-1]
+	}
+
+	result := make([]string, 0, sniffLines)
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		result = append(result, line)
+		if len(result) == sniffLines {
+			break
+		}
+	}
+	return result
+}
+
+// sniffDelimiter picks the candidate that splits the header into the most columns
+// while producing the same column count on the most sample lines.
+func sniffDelimiter(lines []string) string {
+	if len(lines) == 0 {
+		return ","
+	}
+
+	best, bestScore := ",", 0
+	for _, candidate := range candidateDelimiters {
+		headerCount := countOutsideQuotes(lines[0], candidate)
+		if headerCount == 0 {
+			continue
+		}
+
+		consistent := 0
+		for _, line := range lines {
+			if countOutsideQuotes(line, candidate) == headerCount {
+				consistent++
+			}
+		}
+
+		// Consistency dominates; the column count breaks ties between consistent candidates.
+		score := consistent*sniffSize + headerCount
+		if score > bestScore {
+			best, bestScore = string(candidate), score
+		}
+	}
+
+	return best
+}
+
+// sniffQuote reports whether the sample uses quoted fields and whether any bare
+// quotes appear inside unquoted fields.
+func sniffQuote(lines []string, delimiter rune) string {
+	style := QuoteNone
+	for _, line := range lines {
+		if !strings.Contains(line, `"`) {
+			continue
+		}
+		style = QuoteStandard
+		if hasBareQuote(line, delimiter) {
+			return QuoteLazy
+		}
+	}
+	return style
+}
+
+// countOutsideQuotes counts the occurrences of delimiter that are not inside a quoted field.
+func countOutsideQuotes(line string, delimiter rune) int {
+	count, quoted := 0, false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == delimiter && !quoted:
+			count++
+		}
+	}
+	return count
+}
+
+// hasBareQuote reports whether a quote appears in a field that does not start with one.
+func hasBareQuote(line string, delimiter rune) bool {
+	atFieldStart, quoted, justClosed := true, false, false
+	for _, r := range line {
+		switch {
+		case quoted:
+			if r == '"' {
+				quoted, justClosed = false, true
+			}
+			continue
+		case r == '"' && (atFieldStart || justClosed):
+			// Opening quote, or the second half of an escaped "" pair.
+			quoted = true
+		case r == '"':
+			return true
+		}
+		justClosed = false
+		atFieldStart = r == delimiter
+	}
+	return false
+}
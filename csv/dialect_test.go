@@ -0,0 +1,227 @@
+package csvparser_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "babylon/dataloader/csv"
+)
+
+// createTempBytes creates a temporary file holding raw bytes.
+func createTempBytes(t *testing.T, filename string, content []byte) string {
+	filePath := filepath.Join(t.TempDir(), filename)
+	if err := os.WriteFile(filePath, content, 0o644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+	return filePath
+}
+
+// encodeUTF16LE encodes an ASCII string as UTF-16LE with a byte order mark.
+func encodeUTF16LE(s string) []byte {
+	out := []byte{0xff, 0xfe}
+	for _, r := range s {
+		out = append(out, byte(r), 0)
+	}
+	return out
+}
+
+// encodeUTF16BE encodes an ASCII string as UTF-16BE without a byte order mark.
+func encodeUTF16BE(s string) []byte {
+	out := make([]byte, 0, 2*len(s))
+	for _, r := range s {
+		out = append(out, 0, byte(r))
+	}
+	return out
+}
+
+func TestParseCSV_DetectsDialect(t *testing.T) {
+	tests := []struct {
+		name            string
+		content         []byte
+		expectedDialect Dialect
+		expectedDesc    string
+	}{
+		{
+			name:            "comma utf-8",
+			content:         []byte("Posting Date,Description,Amount\n01/02/2024,\"Coffee, large\",-4.50\n"),
+			expectedDialect: Dialect{Delimiter: ",", Quote: QuoteStandard, Encoding: EncodingUTF8},
+			expectedDesc:    "Coffee, large",
+		},
+		{
+			name:            "semicolon",
+			content:         []byte("Posting Date;Description;Amount\n01/02/2024;Bäckerei;-4,50\n"),
+			expectedDialect: Dialect{Delimiter: ";", Quote: QuoteNone, Encoding: EncodingUTF8},
+			expectedDesc:    "Bäckerei",
+		},
+		{
+			name:            "tab",
+			content:         []byte("Posting Date\tDescription\tAmount\n01/02/2024\tRent\t-900.00\n"),
+			expectedDialect: Dialect{Delimiter: "\t", Quote: QuoteNone, Encoding: EncodingUTF8},
+			expectedDesc:    "Rent",
+		},
+		{
+			name: "windows-1252 with utf-8 bom",
+			content: append([]byte("\xef\xbb\xbf"),
+				[]byte("Posting Date;Description;Amount\n01/02/2024;Caf\xe9 \x80;-4,50\n")...),
+			expectedDialect: Dialect{Delimiter: ";", Quote: QuoteNone, Encoding: EncodingWindows1252, BOM: true},
+			expectedDesc:    "Café €",
+		},
+		{
+			name:            "utf-8 with bom",
+			content:         []byte("\xef\xbb\xbfPosting Date,Description,Amount\n01/02/2024,Café,-4.50\n"),
+			expectedDialect: Dialect{Delimiter: ",", Quote: QuoteNone, Encoding: EncodingUTF8, BOM: true},
+			expectedDesc:    "Café",
+		},
+		{
+			name:            "windows-1252 without bom",
+			content:         []byte("Posting Date;Description;Amount\n01/02/2024;Caf\xe9 \x80;-4,50\n"),
+			expectedDialect: Dialect{Delimiter: ";", Quote: QuoteNone, Encoding: EncodingWindows1252},
+			expectedDesc:    "Café €",
+		},
+		{
+			name:            "utf-16le with bom",
+			content:         encodeUTF16LE("Posting Date\tDescription\tAmount\r\n01/02/2024\tRent\t-900.00\r\n"),
+			expectedDialect: Dialect{Delimiter: "\t", Quote: QuoteNone, Encoding: EncodingUTF16LE, BOM: true},
+			expectedDesc:    "Rent",
+		},
+		{
+			name:            "utf-16le without bom",
+			content:         encodeUTF16LE("Posting Date\tDescription\tAmount\r\n01/02/2024\tRent\t-900.00\r\n")[2:],
+			expectedDialect: Dialect{Delimiter: "\t", Quote: QuoteNone, Encoding: EncodingUTF16LE},
+			expectedDesc:    "Rent",
+		},
+		{
+			name:            "utf-16be without bom",
+			content:         encodeUTF16BE("Posting Date,Description,Amount\r\n01/02/2024,Rent,-900.00\r\n"),
+			expectedDialect: Dialect{Delimiter: ",", Quote: QuoteNone, Encoding: EncodingUTF16BE},
+			expectedDesc:    "Rent",
+		},
+		{
+			name:            "bare quotes",
+			content:         []byte("Posting Date,Description,Amount\n01/02/2024,12\" pizza,-14.00\n"),
+			expectedDialect: Dialect{Delimiter: ",", Quote: QuoteLazy, Encoding: EncodingUTF8},
+			expectedDesc:    "12\" pizza",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filePath := createTempBytes(t, "dialect.csv", test.content)
+
+			var rows []map[string]string
+			summary, err := NewDefaultParser().Parse(context.Background(), filePath, "generic", "0000",
+				func(_ context.Context, record Record) error {
+					rows = append(rows, record.Fields)
+					return nil
+				})
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if summary.Dialect == nil {
+				t.Fatal("Expected a dialect to be reported")
+			}
+			if *summary.Dialect != test.expectedDialect {
+				t.Errorf("Expected dialect %+v, got %+v", test.expectedDialect, *summary.Dialect)
+			}
+			if len(rows) != 1 {
+				t.Fatalf("Expected 1 row, got %d", len(rows))
+			}
+			if _, ok := rows[0]["posting date"]; !ok {
+				t.Errorf("Expected a clean 'posting date' header, got %v", rows[0])
+			}
+			if rows[0]["description"] != test.expectedDesc {
+				t.Errorf("Expected description %q, got %q", test.expectedDesc, rows[0]["description"])
+			}
+		})
+	}
+}
+
+func TestParseCSV_DialectOverride(t *testing.T) {
+	// Without the override this sample would be read as Windows-1252.
+	content := []byte("Posting Date|Description|Amount\n01/02/2024|Caf\xe9|-4.50\n")
+	filePath := createTempBytes(t, "override.csv", content)
+
+	parser := NewDefaultParser()
+	parser.Overrides = map[string]Dialect{
+		"bank": {Delimiter: "|", Encoding: "latin1"},
+	}
+
+	var rows []map[string]string
+	summary, err := parser.Parse(context.Background(), filePath, "bank", "0000",
+		func(_ context.Context, record Record) error {
+			rows = append(rows, record.Fields)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if summary.Dialect.Encoding != EncodingLatin1 {
+		t.Errorf("Expected encoding %s, got %s", EncodingLatin1, summary.Dialect.Encoding)
+	}
+	if len(rows) != 1 || rows[0]["description"] != "Café" {
+		t.Errorf("Expected description Café, got %v", rows)
+	}
+}
+
+func TestParseCSV_QuoteNoneOverride(t *testing.T) {
+	// A field that starts with a quote but is not quoted would fail to parse as RFC 4180.
+	content := []byte("Posting Date,Description,Amount\n01/02/2024,\"Best\" Bakery,-4.50\n01/03/2024,Rent,-900.00\n")
+	filePath := createTempBytes(t, "quotes.csv", content)
+
+	parser := NewDefaultParser()
+	parser.Overrides = map[string]Dialect{"bank": {Quote: QuoteNone}}
+
+	var records []Record
+	summary, err := parser.Parse(context.Background(), filePath, "bank", "0000",
+		func(_ context.Context, record Record) error {
+			records = append(records, record)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if summary.Dialect.Quote != QuoteNone || len(records) != 2 {
+		t.Fatalf("Expected 2 rows read without quoting, got %d with %+v", len(records), *summary.Dialect)
+	}
+	if got := records[0].Fields["description"]; got != `"Best" Bakery` {
+		t.Errorf("Expected the quotes to be kept, got %q", got)
+	}
+	if records[1].Line != 3 || records[1].Raw != "01/03/2024,Rent,-900.00" {
+		t.Errorf("Expected line 3 with its raw text, got %d %q", records[1].Line, records[1].Raw)
+	}
+}
+
+func TestLoadDialects(t *testing.T) {
+	filePath := createTempBytes(t, "dialects.json",
+		[]byte(`{"chase": {"delimiter": ";", "encoding": "cp1252"}, "bank": {"delimiter": "\t"}}`))
+
+	dialects, err := LoadDialects(filePath)
+	if err != nil {
+		t.Fatalf("LoadDialects failed: %v", err)
+	}
+	if dialects["chase"].Delimiter != ";" || dialects["chase"].Encoding != EncodingWindows1252 {
+		t.Errorf("Unexpected chase dialect %+v", dialects["chase"])
+	}
+	if dialects["bank"].Delimiter != "\t" {
+		t.Errorf("Unexpected bank dialect %+v", dialects["bank"])
+	}
+}
+
+func TestLoadDialects_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"multi-char delimiter": `{"chase": {"delimiter": ";;"}}`,
+		"unknown encoding":     `{"chase": {"encoding": "ebcdic"}}`,
+		"unknown quote":        `{"chase": {"quote": "single"}}`,
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			filePath := createTempBytes(t, "dialects.json", []byte(content))
+			if _, err := LoadDialects(filePath); err == nil {
+				t.Error("Expected LoadDialects to fail")
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package csvparser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Supported text encodings.
+const (
+	EncodingUTF8        = "utf-8"
+	EncodingUTF16LE     = "utf-16le"
+	EncodingUTF16BE     = "utf-16be"
+	EncodingWindows1252 = "windows-1252"
+	EncodingLatin1      = "iso-8859-1"
+)
+
+// Byte order marks recognised at the start of a file.
+const (
+	bomUTF8    = "\xef\xbb\xbf"
+	bomUTF16LE = "\xff\xfe"
+	bomUTF16BE = "\xfe\xff"
+)
+
+// windows1252High maps the bytes 0x80-0x9F of Windows-1252 to runes.
+// Undefined positions fall back to the equivalent Latin-1 control character.
+const windows1252High = "€\u0081‚ƒ„…†‡ˆ‰Š‹Œ\u008dŽ\u008f" +
+	"\u0090‘’“”•–—˜™š›œ\u009džŸ"
+
+// normalizeEncoding maps common aliases to one of the supported encoding names.
+func normalizeEncoding(name string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "utf8", "utf-8":
+		return EncodingUTF8, nil
+	case "utf-16le", "utf16le":
+		return EncodingUTF16LE, nil
+	case "utf-16be", "utf16be":
+		return EncodingUTF16BE, nil
+	case "windows-1252", "cp1252", "win1252":
+		return EncodingWindows1252, nil
+	case "iso-8859-1", "latin1", "latin-1":
+		return EncodingLatin1, nil
+	default:
+		return "", UnsupportedEncodingError(name)
+	}
+}
+
+// detectBOM reports the encoding implied by a byte order mark at the start of sample
+// and the length of that mark.
+func detectBOM(sample []byte) (string, int) {
+	switch {
+	case bytes.HasPrefix(sample, []byte(bomUTF8)):
+		return EncodingUTF8, len(bomUTF8)
+	case bytes.HasPrefix(sample, []byte(bomUTF16LE)):
+		return EncodingUTF16LE, len(bomUTF16LE)
+	case bytes.HasPrefix(sample, []byte(bomUTF16BE)):
+		return EncodingUTF16BE, len(bomUTF16BE)
+	default:
+		return "", 0
+	}
+}
+
+// utf16Share is the share of a sample's byte pairs that must hold a NUL on the same side
+// for the sample to be read as UTF-16. Text in the ASCII range has one in every pair.
+const utf16Share = 0.4
+
+// detectEncoding guesses the encoding of a sample without a byte order mark. UTF-16 is told
+// apart by the NUL bytes it puts at alternating positions. Anything that is not valid UTF-8
+// is treated as Windows-1252, which is a superset of the printable Latin-1 range.
+func detectEncoding(sample []byte) string {
+	if encoding := detectUTF16(sample); encoding != "" {
+		return encoding
+	}
+
+	// The sample may end part-way through a multi-byte rune.
+	for i := 0; i < utf8.UTFMax && len(sample) > 0; i++ {
+		if utf8.Valid(sample) {
+			return EncodingUTF8
+		}
+		if r, _ := utf8.DecodeLastRune(sample); r != utf8.RuneError {
+			break
+		}
+		sample = sample[:len(sample)-1]
+	}
+
+	return EncodingWindows1252
+}
+
+// detectUTF16 reports the byte order of a UTF-16 sample without a byte order mark, or ""
+// when most of its byte pairs do not have a NUL on the same side.
+func detectUTF16(sample []byte) string {
+	pairs := len(sample) / 2
+	if pairs == 0 {
+		return ""
+	}
+	var even, odd int
+	for i := 0; i+1 < len(sample); i += 2 {
+		if sample[i] == 0 {
+			even++
+		}
+		if sample[i+1] == 0 {
+			odd++
+		}
+	}
+	threshold := int(utf16Share * float64(pairs))
+	switch {
+	case odd > threshold && even*10 < odd:
+		return EncodingUTF16LE
+	case even > threshold && odd*10 < even:
+		return EncodingUTF16BE
+	default:
+		return ""
+	}
+}
+
+// newDecodingReader wraps r so that it yields UTF-8 regardless of the source encoding.
+func newDecodingReader(r io.Reader, encoding string) io.Reader {
+	switch encoding {
+	case EncodingUTF16LE:
+		return &utf16Reader{src: bufio.NewReader(r), order: binary.LittleEndian}
+	case EncodingUTF16BE:
+		return &utf16Reader{src: bufio.NewReader(r), order: binary.BigEndian}
+	case EncodingWindows1252, EncodingLatin1:
+		reader := &singleByteReader{src: bufio.NewReader(r)}
+		if encoding == EncodingWindows1252 {
+			reader.high = []rune(windows1252High)
+		}
+		return reader
+	default:
+		return r
+	}
+}
+
+// singleByteReader decodes Latin-1 or Windows-1252 text into UTF-8.
+type singleByteReader struct {
+	src *bufio.Reader
+	// high replaces the 0x80-0x9F control range; nil for plain Latin-1.
+	high    []rune
+	pending []byte
+}
+
+func (s *singleByteReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(s.pending) > 0 {
+			copied := copy(p[n:], s.pending)
+			s.pending = s.pending[copied:]
+			n += copied
+			continue
+		}
+
+		b, err := s.src.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+
+		s.pending = utf8.AppendRune(s.pending[:0], s.decode(b))
+	}
+
+	return n, nil
+}
+
+func (s *singleByteReader) decode(b byte) rune {
+	const highStart, highEnd = 0x80, 0x9f
+	if s.high != nil && b >= highStart && b <= highEnd {
+		return s.high[b-highStart]
+	}
+	return rune(b)
+}
+
+// utf16Reader decodes UTF-16 text into UTF-8.
+type utf16Reader struct {
+	src     *bufio.Reader
+	order   binary.ByteOrder
+	pending []byte
+}
+
+func (u *utf16Reader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(u.pending) > 0 {
+			copied := copy(p[n:], u.pending)
+			u.pending = u.pending[copied:]
+			n += copied
+			continue
+		}
+
+		r, err := u.readRune()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+
+		u.pending = utf8.AppendRune(u.pending[:0], r)
+	}
+
+	return n, nil
+}
+
+func (u *utf16Reader) readRune() (rune, error) {
+	unit, err := u.readUnit()
+	if err != nil {
+		return 0, err
+	}
+	if !utf16.IsSurrogate(rune(unit)) {
+		return rune(unit), nil
+	}
+
+	low, err := u.readUnit()
+	if err != nil {
+		return utf8.RuneError, nil //nolint:nilerr // A dangling surrogate decodes to the replacement rune.
+	}
+
+	return utf16.DecodeRune(rune(unit), rune(low)), nil
+}
+
+func (u *utf16Reader) readUnit() (uint16, error) {
+	var buf [2]byte
+	if _, err := io.ReadFull(u.src, buf[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, io.EOF
+		}
+		return 0, err
+	}
+
+	return u.order.Uint16(buf[:]), nil
+}
@@ -1,13 +1,83 @@
 package csvparser
 
-import "context"
+import (
+	"context"
 
-// Parser defines the interface for parsing CSV data.
+	"babylon/dataloader/money"
+)
+
+// Record is a single row read from a data file.
+type Record struct {
+	// Line is the 1-based line number the row starts on in the source file.
+	Line int64
+	// Fields maps the lowercased column headers to the row's values.
+	Fields map[string]string
+	// Numeric marks the fields the parser wrote as plain decimals with a '.' separator, such
+	// as statement amounts and spreadsheet number cells. They are read whatever the source's
+	// locale. It is nil for delimited text, whose values are as the file wrote them.
+	Numeric map[string]bool
+	// Raw is the row's original text, decoded to UTF-8, for formats read line by line.
+	Raw string
+	// Reject is set when the parser could not read the row, and names the reason.
+	// Rejected records are passed to the RecordHandler so they can be quarantined.
+	Reject string
+	// Detail explains a rejection, e.g. the value that could not be read.
+	Detail string
+}
+
+// Reasons a parser rejects a row.
+const (
+	// RejectShortRow marks a row with fewer fields than the header.
+	RejectShortRow = "short_row"
+	// RejectInvalidEntry marks a transaction of a statement format, such as an OFX STMTTRN
+	// or an MT940 :61: line, whose date or amount could not be read.
+	RejectInvalidEntry = "invalid_entry"
+)
+
+// RecordHandler is called once for every row produced by a Parser.
+// Returning an error stops parsing and the error is returned from Parse.
+type RecordHandler func(ctx context.Context, record Record) error
+
+// Summary describes a completed Parse call.
+type Summary struct {
+	// Records is the number of rows handed to the RecordHandler.
+	Records int64
+	// Dialect is the layout the file was read with, or nil for formats that are not delimited text.
+	Dialect *Dialect
+	// Statements lists the account statements the file declared, for formats that carry
+	// balances. Records belonging to a statement carry its ID in their fields.
+	Statements []Statement
+}
+
+// Statement is an account statement's identity and the balances it reports.
+type Statement struct {
+	// ID is the statement's identifier, unique for the issuing institution.
+	ID string
+	// Kind names the statement format, e.g. camt.053.
+	Kind string
+	// AccountID identifies the account the statement belongs to.
+	AccountID string
+	// Opening and Closing are the balances before and after the statement's entries, if reported.
+	Opening *Balance
+	Closing *Balance
+}
+
+// Balance is an account balance on a given date.
+type Balance struct {
+	// Amount is signed, negative when the account is overdrawn.
+	Amount money.Money
+	// Date is the balance date, formatted as 2006-01-02.
+	Date string
+}
+
+// Parser defines the interface for streaming rows out of a data file.
+// Implementations must not hold more than a bounded number of rows in memory.
 type Parser interface {
 	Parse(
 		ctx context.Context,
 		filePath string,
 		dataSource string,
 		accountID string,
-	) ([]map[string]string, int64, error)
+		handle RecordHandler,
+	) (Summary, error)
 }
@@ -0,0 +1,59 @@
+package csvparser
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+)
+
+// rowReader reads the rows of a delimited file. It is satisfied by *csv.Reader.
+type rowReader interface {
+	Read() ([]string, error)
+	FieldPos(field int) (line int, column int)
+	InputOffset() int64
+}
+
+// plainReader splits each line on the delimiter without treating any character as a quote,
+// for sources whose dialect override sets QuoteNone. Empty lines are skipped, as
+// encoding/csv does.
+type plainReader struct {
+	reader    *bufio.Reader
+	delimiter string
+	// lines is the number of lines read, and line the line the last row started on.
+	lines  int
+	line   int
+	offset int64
+}
+
+func newPlainReader(r io.Reader, delimiter rune) *plainReader {
+	return &plainReader{reader: bufio.NewReader(r), delimiter: string(delimiter)}
+}
+
+func (r *plainReader) Read() ([]string, error) {
+	for {
+		text, err := r.reader.ReadString('\n')
+		if err != nil && (!errors.Is(err, io.EOF) || text == "") {
+			return nil, err
+		}
+		r.lines++
+		r.offset += int64(len(text))
+
+		text = strings.TrimRight(text, "\r\n")
+		if text == "" {
+			continue
+		}
+		r.line = r.lines
+		return strings.Split(text, r.delimiter), nil
+	}
+}
+
+// FieldPos returns the line the last row started on. Columns are not tracked.
+func (r *plainReader) FieldPos(int) (int, int) {
+	return r.line, 1
+}
+
+// InputOffset returns the number of bytes read so far.
+func (r *plainReader) InputOffset() int64 {
+	return r.offset
+}
@@ -0,0 +1,96 @@
+package csvparser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"babylon/dataloader/datalake/datasource"
+)
+
+var errUnsupportedFileType = errors.New("no parser registered for file type")
+
+// UnsupportedFileTypeError is returned when no parser handles a file's extension.
+func UnsupportedFileTypeError(filePath string) error {
+	return fmt.Errorf("%w, %s", errUnsupportedFileType, filePath)
+}
+
+// InfoParser is implemented by parsers whose file format identifies the data source
+// and account it belongs to. ParseInfo returns datasource.ErrUnableToExtractInfo when
+// the file does not carry that information.
+type InfoParser interface {
+	ParseInfo(ctx context.Context, filePath string) (*datasource.SourceInfo, error)
+}
+
+// FileMatcher reports whether a file can be handled, judging by its path and, for formats
+// that share an extension with others, by its contents.
+type FileMatcher interface {
+	Supports(filePath string) bool
+}
+
+// Registry is a Parser that dispatches each file to the parser registered for its extension.
+type Registry struct {
+	parsers map[string][]Parser
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{parsers: make(map[string][]Parser)}
+}
+
+// Register associates parser with one or more file extensions, e.g. ".csv".
+// Extensions are matched case-insensitively. When several parsers share an extension, they
+// are tried in the order they were registered, and a parser that is a FileMatcher is passed
+// over for files it does not support.
+func (r *Registry) Register(parser Parser, extensions ...string) {
+	for _, ext := range extensions {
+		ext = strings.ToLower(ext)
+		r.parsers[ext] = append(r.parsers[ext], parser)
+	}
+}
+
+// Supports reports whether a parser registered for the file's extension supports it.
+func (r *Registry) Supports(filePath string) bool {
+	_, ok := r.parserFor(filePath)
+	return ok
+}
+
+// Parse streams filePath through the parser registered for its extension.
+func (r *Registry) Parse(
+	ctx context.Context,
+	filePath string,
+	dataSource string,
+	accountID string,
+	handle RecordHandler,
+) (Summary, error) {
+	parser, ok := r.parserFor(filePath)
+	if !ok {
+		return Summary{}, UnsupportedFileTypeError(filePath)
+	}
+	return parser.Parse(ctx, filePath, dataSource, accountID, handle)
+}
+
+// ParseInfo asks the parser registered for filePath to identify its source, if it can.
+func (r *Registry) ParseInfo(ctx context.Context, filePath string) (*datasource.SourceInfo, error) {
+	parser, ok := r.parserFor(filePath)
+	if !ok {
+		return nil, UnsupportedFileTypeError(filePath)
+	}
+	infoParser, ok := parser.(InfoParser)
+	if !ok {
+		return nil, datasource.ErrUnableToExtractInfo
+	}
+	return infoParser.ParseInfo(ctx, filePath)
+}
+
+func (r *Registry) parserFor(filePath string) (Parser, bool) {
+	for _, parser := range r.parsers[strings.ToLower(filepath.Ext(filePath))] {
+		if matcher, ok := parser.(FileMatcher); ok && !matcher.Supports(filePath) {
+			continue
+		}
+		return parser, true
+	}
+	return nil, false
+}
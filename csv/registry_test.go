@@ -0,0 +1,70 @@
+package csvparser_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "babylon/dataloader/csv"
+	"babylon/dataloader/datalake/datasource"
+)
+
+func TestRegistry_DispatchesByExtension(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(NewDefaultParser(), ".csv")
+
+	if !registry.Supports("export.CSV") {
+		t.Error("Expected extensions to match case-insensitively")
+	}
+	if registry.Supports("statement.ofx") {
+		t.Error("Expected an unregistered extension to be unsupported")
+	}
+
+	filePath := createTempCSV(t, "export.csv", "Posting Date,Amount\n01/31/2023,-4.50\n")
+	data, count, err := parseAll(context.Background(), registry, filePath, "chase", "1234")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if count != 1 || data[0]["amount"] != "-4.50" {
+		t.Errorf("Expected one row from the CSV parser, got %v", data)
+	}
+
+	if _, err = registry.ParseInfo(context.Background(), filePath); !errors.Is(err, datasource.ErrUnableToExtractInfo) {
+		t.Errorf("Expected ErrUnableToExtractInfo from a parser without ParseInfo, got %v", err)
+	}
+
+	if _, _, err = parseAll(context.Background(), registry, "statement.ofx", "", ""); err == nil {
+		t.Error("Expected an unsupported file type error")
+	}
+}
+
+// prefixParser is a FileMatcher that only supports files whose name starts with prefix.
+type prefixParser struct {
+	Parser
+	prefix string
+}
+
+func (p prefixParser) Supports(filePath string) bool {
+	return strings.HasPrefix(filepath.Base(filePath), p.prefix)
+}
+
+func TestRegistry_FallsThroughUnsupportedMatchers(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(prefixParser{Parser: NewDefaultParser(), prefix: "never"}, ".csv")
+
+	filePath := createTempCSV(t, "export.csv", "Posting Date,Amount\n01/31/2023,-4.50\n")
+	if registry.Supports(filePath) {
+		t.Error("Expected a file no matcher supports to be unsupported")
+	}
+
+	// A later parser for the same extension takes the files the first passes over.
+	registry.Register(NewDefaultParser(), ".csv")
+	if !registry.Supports(filePath) {
+		t.Fatal("Expected the fallback parser to support the file")
+	}
+	if _, count, err := parseAll(context.Background(), registry, filePath, "", ""); err != nil || count != 1 {
+		t.Errorf("Expected one row from the fallback parser, got %d (%v)", count, err)
+	}
+}
@@ -0,0 +1,120 @@
+package datalake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"babylon/dataloader/datalake/datasource"
+	"babylon/dataloader/datalake/mapping"
+	"babylon/dataloader/datalake/model"
+	"babylon/dataloader/datalake/repository"
+)
+
+var (
+	errUnregisteredAccount = errors.New("account is not registered")
+	errUnknownAccount      = errors.New("file does not name its account")
+)
+
+// UnregisteredAccountError is returned when a file belongs to an account that is not
+// registered and RequireRegisteredAccounts is set.
+func UnregisteredAccountError(dataSource string, accountID string) error {
+	return fmt.Errorf("%w, %s in %s", errUnregisteredAccount, accountID, dataSource)
+}
+
+// UnknownAccountError is returned when neither a file's name, its metadata nor its rows
+// name the account it belongs to.
+func UnknownAccountError(fileName string) error {
+	return fmt.Errorf("%w, %s: name it in the filename, a sidecar or the manifest", errUnknownAccount, fileName)
+}
+
+// Look up the registered account a file belongs to. An account that is not registered is
+// registered with a warning, or fails the file when RequireRegisteredAccounts is set.
+// Without an account repository, every account is taken to be registered with no details.
+func (p *CSVFileProcessor) registeredAccount(
+	ctx context.Context,
+	sourceInfo *datasource.SourceInfo,
+) (model.Account, error) {
+	if p.Accounts == nil {
+		return model.Account{DataSource: sourceInfo.DataSource, AccountID: sourceInfo.AccountID}, nil
+	}
+
+	account, err := p.Accounts.FindAccount(ctx, sourceInfo.DataSource, sourceInfo.AccountID)
+	if err == nil {
+		return account, nil
+	}
+	if !errors.Is(err, repository.ErrAccountNotFound) {
+		return model.Account{}, err
+	}
+	if p.RequireRegisteredAccounts {
+		return model.Account{}, UnregisteredAccountError(sourceInfo.DataSource, sourceInfo.AccountID)
+	}
+
+	// The identifier is also registered as an alias, so a later file that masks it
+	// differently, such as ****1234 rather than XXXX-XXXX-1234, resolves to this account.
+	account = model.Account{
+		DataSource:     sourceInfo.DataSource,
+		AccountID:      sourceInfo.AccountID,
+		Aliases:        []string{model.NormalizeAccountAlias(sourceInfo.AccountID)},
+		AutoRegistered: true,
+	}
+	if err = p.Accounts.AddAccount(ctx, account); err != nil {
+		return model.Account{}, fmt.Errorf("failed to register account: %w", err)
+	}
+	p.Logger.WarnContext(ctx, "registered unknown account",
+		"dataSource", account.DataSource, "accountID", account.AccountID)
+	return account, nil
+}
+
+// Return the canonical ID of the registered account an identifier, such as a statement's
+// IBAN, names. An identifier that names no registered account is returned as it is.
+func (p *CSVFileProcessor) canonicalAccountID(
+	ctx context.Context,
+	dataSource string,
+	accountID string,
+) (string, error) {
+	if p.Accounts == nil {
+		return accountID, nil
+	}
+	account, err := p.Accounts.FindAccount(ctx, dataSource, accountID)
+	if errors.Is(err, repository.ErrAccountNotFound) {
+		return accountID, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return account.AccountID, nil
+}
+
+// Read a file's account from the account column of its first rows, such as a card number
+// or masked account number. It returns "" if no row has one.
+func (p *CSVFileProcessor) contentAccountID(
+	ctx context.Context,
+	filePath string,
+	sourceInfo *datasource.SourceInfo,
+	profile mapping.Profile,
+) (string, error) {
+	sample, err := p.sampleFile(ctx, filePath, sourceInfo.DataSource)
+	if err != nil {
+		return "", err
+	}
+	for _, row := range sample.Rows {
+		if accountID := profile.Value(row, mapping.FieldAccount); accountID != "" {
+			return accountID, nil
+		}
+	}
+	return "", nil
+}
+
+// Take the sign convention of a profile that does not declare one from the account's type:
+// credit card exports report charges as positive amounts.
+func accountProfile(profile mapping.Profile, account model.Account) mapping.Profile {
+	if profile.AmountSign != "" || account.Type == "" {
+		return profile
+	}
+	sign := mapping.SignSigned
+	if account.Type == model.AccountCreditCard {
+		sign = mapping.SignInverted
+	}
+	return profile.Override(mapping.Profile{AmountSign: sign})
+}
@@ -0,0 +1,167 @@
+package datalake
+
+import (
+	"context"
+	"fmt"
+
+	bcontext "babylon/dataloader/appcontext"
+	csvparser "babylon/dataloader/csv"
+	"babylon/dataloader/datalake/fx"
+	"babylon/dataloader/datalake/mapping"
+	"babylon/dataloader/datalake/model"
+	"babylon/dataloader/datalake/repository"
+	"babylon/dataloader/money"
+)
+
+// recordBatch buffers parsed rows for a single file and flushes them to the
+// repository in fixed-size chunks, so memory use does not grow with file size.
+type recordBatch struct {
+	repo       repository.Repository
+	size       int
+	profile    mapping.Profile
+	rates      *fx.Table
+	dataSource string
+	accountID  string
+	lineage    model.Lineage
+	pending    []csvparser.Record
+	// rejects quarantines rejected rows, or is nil when an earlier pass over the file has.
+	rejects *rejectWriter
+	ids     *transactionIDs
+	// dryRun maps and counts rows without upserting them, to check a file against its
+	// error budget before anything is written.
+	dryRun bool
+
+	// rawRecords counts every row received from the parser.
+	rawRecords int
+	// transactions counts every transaction successfully upserted.
+	transactions int
+	// rejected counts the rows quarantined, by reason.
+	rejected map[string]int
+	// statements tallies the upserted transactions of each statement, keyed by statement ID.
+	statements map[string]*statementTotal
+}
+
+// statementTotal counts and sums the transactions upserted from one statement.
+type statementTotal struct {
+	entries int
+	amount  money.Money
+}
+
+func newRecordBatch(
+	repo repository.Repository,
+	size int,
+	profile mapping.Profile,
+	rates *fx.Table,
+	dataSource string,
+	accountID string,
+	lineage model.Lineage,
+	rejects *rejectWriter,
+) *recordBatch {
+	return &recordBatch{
+		repo:       repo,
+		size:       size,
+		profile:    profile,
+		rates:      rates,
+		dataSource: dataSource,
+		accountID:  accountID,
+		lineage:    lineage,
+		pending:    make([]csvparser.Record, 0, size),
+		rejects:    rejects,
+		ids:        newTransactionIDs(),
+		rejected:   make(map[string]int),
+		statements: make(map[string]*statementTotal),
+	}
+}
+
+// add buffers a single row and flushes the batch once it is full. Rows the parser
+// rejected are quarantined straight away. It satisfies csvparser.RecordHandler.
+func (b *recordBatch) add(ctx context.Context, record csvparser.Record) error {
+	b.rawRecords++
+	if record.Reject != "" {
+		return b.reject(rejection{record: record, reason: record.Reject, detail: record.Detail})
+	}
+	b.pending = append(b.pending, record)
+
+	if len(b.pending) >= b.size {
+		return b.flush(ctx)
+	}
+
+	return nil
+}
+
+// flush maps the buffered rows to transactions and upserts them.
+func (b *recordBatch) flush(ctx context.Context) error {
+	if len(b.pending) == 0 {
+		return nil
+	}
+	logger := bcontext.LoggerFromContext(ctx)
+
+	transactions, rejections := fromRecords(
+		ctx,
+		b.dataSource,
+		b.accountID,
+		b.pending,
+		b.profile,
+		b.rates,
+		b.lineage,
+		*logger,
+	)
+	b.pending = b.pending[:0]
+
+	for _, rej := range rejections {
+		if err := b.reject(rej); err != nil {
+			return err
+		}
+	}
+
+	if len(transactions) == 0 || b.dryRun {
+		return nil
+	}
+	b.ids.assign(transactions)
+
+	// Upsert documents to datalake collection.
+	if err := b.repo.BulkUpsertTransactions(ctx, transactions); err != nil {
+		return fmt.Errorf("failed to bulk upsert transactions: %w", err)
+	}
+	b.transactions += len(transactions)
+
+	for _, transaction := range transactions {
+		if transaction.StatementID == "" {
+			continue
+		}
+		total, ok := b.statements[transaction.StatementID]
+		if !ok {
+			total = &statementTotal{}
+			b.statements[transaction.StatementID] = total
+		}
+		amount, err := total.amount.Add(transaction.Amount)
+		if err != nil {
+			return fmt.Errorf("failed to total statement %s: %w", transaction.StatementID, err)
+		}
+		total.entries++
+		total.amount = amount
+	}
+
+	return nil
+}
+
+// reject quarantines a row and counts it against its reason.
+func (b *recordBatch) reject(rej rejection) error {
+	b.rejected[rej.reason]++
+	if b.rejects == nil {
+		return nil
+	}
+	return b.rejects.write(rej)
+}
+
+// checkErrorBudget fails the file when it rejected more rows than the profile allows.
+func (b *recordBatch) checkErrorBudget() error {
+	rejected := 0
+	for _, count := range b.rejected {
+		rejected += count
+	}
+	if b.profile.ErrorBudget.Exceeded(rejected, b.rawRecords) {
+		return ErrorBudgetExceededError(rejected, b.rawRecords, b.rejected)
+	}
+	return nil
+}
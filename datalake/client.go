@@ -4,10 +4,13 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"slices"
 
 	bcontext "babylon/dataloader/appcontext"
 	csvparser "babylon/dataloader/csv"
 	"babylon/dataloader/datalake/datasource"
+	"babylon/dataloader/datalake/fx"
+	"babylon/dataloader/datalake/mapping"
 	"babylon/dataloader/datalake/repository"
 )
 
@@ -23,10 +26,27 @@ type Client interface {
 	) (*Stats, error)
 }
 
-type client struct{}
+// Options configures how a Client ingests files.
+type Options struct {
+	// BatchSize is the number of rows mapped and upserted together.
+	// Defaults to DefaultBatchSize when zero.
+	BatchSize int
+	// Mappings declares how each data source's columns map to transaction fields.
+	// Defaults to mapping.Default() when nil.
+	Mappings *mapping.Config
+	// Rates converts amounts to the reporting currency. Amounts are not converted when nil.
+	Rates *fx.Table
+	// RequireRegisteredAccounts fails files whose account is not registered, rather than
+	// registering it with a warning.
+	RequireRegisteredAccounts bool
+}
+
+type client struct {
+	opts Options
+}
 
-func NewClient() Client {
-	return &client{}
+func NewClient(opts Options) Client {
+	return &client{opts: opts}
 }
 
 // IngestCSVFiles processes all CSV files in a given directory and uploads them to MongoDB.
@@ -42,10 +62,14 @@ func (c *client) IngestCSVFiles(
 	logger := bcontext.LoggerFromContext(ctx)
 	logger.InfoContext(ctx, "Reading data from sink", "sink", unprocessedDir)
 
-	files, err := os.ReadDir(unprocessedDir)
+	entries, err := os.ReadDir(unprocessedDir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read directory: %w", err)
 	}
+	// Sidecars and manifests describe the data files rather than being ingested themselves.
+	files := slices.DeleteFunc(entries, func(entry os.DirEntry) bool {
+		return isMetadataFile(entry.Name())
+	})
 
 	stats := NewStats()
 	stats.TotalFiles = len(files)
@@ -63,6 +87,15 @@ func (c *client) IngestCSVFiles(
 		stats,
 		*logger,
 	)
+	if c.opts.BatchSize > 0 {
+		processor.BatchSize = c.opts.BatchSize
+	}
+	if c.opts.Mappings != nil {
+		processor.Mappings = c.opts.Mappings
+	}
+	processor.Rates = c.opts.Rates
+	processor.RequireRegisteredAccounts = c.opts.RequireRegisteredAccounts
+	stats.RunID = processor.RunID
 
 	// Ingest all files.
 	for _, file := range files {
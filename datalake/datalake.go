@@ -7,7 +7,6 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 
@@ -15,14 +14,25 @@ import (
 	csvparser "babylon/dataloader/csv"
 
 	"babylon/dataloader/datalake/datasource"
+	"babylon/dataloader/datalake/fx"
+	"babylon/dataloader/datalake/mapping"
 	"babylon/dataloader/datalake/model"
 	"babylon/dataloader/datalake/repository"
+	"babylon/dataloader/money"
 )
 
+// DefaultBatchSize is the number of rows mapped and upserted together when no batch size is configured.
+const DefaultBatchSize = 500
+
+// sampleRows is the number of rows read to identify a file by its contents.
+const sampleRows = 20
+
 var (
 	errTargetFileNotFound = errors.New("the valid directory target was not found")
 	errCreateDirectory    = errors.New("the valid directory target was not found")
 	errMoveFile           = errors.New("failed to move file")
+	// errSampleFull stops reading a file once enough rows have been sampled.
+	errSampleFull = errors.New("sample full")
 )
 
 func ValidFileNotFoundError(filePath string) error {
@@ -45,8 +55,25 @@ type CSVFileProcessor struct {
 	UnprocessedDir     string
 	ProcessedDir       string
 	MoveProcessedFiles bool
-	Stats              *Stats
-	Logger             slog.Logger
+	// BatchSize is the number of rows mapped and upserted together.
+	BatchSize int
+	// Mappings declares how each data source's columns map to transaction fields.
+	Mappings *mapping.Config
+	// Detector identifies files by their first rows when the Extractor cannot tell their data
+	// source from their name. It defaults to the Extractor, if that is a ContentDetector.
+	Detector datasource.ContentDetector
+	// Accounts registers the accounts files are loaded into. Accounts are not checked when nil.
+	// It defaults to the Repo, if that is an AccountRepository.
+	Accounts repository.AccountRepository
+	// RequireRegisteredAccounts fails files whose account is not registered, rather than
+	// registering it.
+	RequireRegisteredAccounts bool
+	// Rates converts amounts to the reporting currency. Amounts are not converted when nil.
+	Rates *fx.Table
+	// RunID identifies this ingest run in the lineage of every transaction it writes.
+	RunID  string
+	Stats  *Stats
+	Logger slog.Logger
 }
 
 // NewCSVFileProcessor creates a new CSVFileProcessor instance.
@@ -60,13 +87,20 @@ func NewCSVFileProcessor(
 	stats *Stats,
 	logger slog.Logger,
 ) *CSVFileProcessor {
+	detector, _ := extractor.(datasource.ContentDetector)
+	accounts, _ := repo.(repository.AccountRepository)
 	return &CSVFileProcessor{
 		Repo:               repo,
 		Extractor:          extractor,
+		Detector:           detector,
 		Parser:             parser,
 		UnprocessedDir:     unprocessedDir,
 		ProcessedDir:       processedDir,
 		MoveProcessedFiles: moveProcessedFiles,
+		BatchSize:          DefaultBatchSize,
+		Mappings:           mapping.Default(),
+		Accounts:           accounts,
+		RunID:              newRunID(time.Now()),
 		Stats:              stats,
 		Logger:             logger,
 	}
@@ -79,12 +113,12 @@ func (p *CSVFileProcessor) ingestCSVFile(
 
 	file os.DirEntry,
 ) error {
-	if !validateCSVFile(file) {
-		reason := "Not a valid CSV file"
+	if !p.validateFile(file) {
+		reason := "Not a supported data file"
 		p.Stats.AddFailure(file.Name(), reason)
 		p.Logger.WarnContext(ctx, "file was not processed", "fileName", file.Name(), "reason", reason)
 
-		return fmt.Errorf("file %s is not a valid CSV file", file.Name())
+		return fmt.Errorf("file %s is not a supported data file", file.Name())
 
 	}
 
@@ -107,167 +141,440 @@ func (p *CSVFileProcessor) ingestCSVFile(
 
 // Process the file in the directory.
 // This function will:
-//   - Parse the unprocessedFile csv in unprocessedDir row by row.
-//   - Map each row to mongo datalake models.
-//   - Upsert the models to appropriate collections.
+//   - Identify the file by its sidecar or manifest metadata, name or contents.
+//   - Look up its account, registering it if needed.
+//   - Stream the unprocessedFile csv in unprocessedDir row by row.
+//   - Fail the file, before writing anything, if it rejects more rows than its
+//     error budget allows.
+//   - Map each chunk of BatchSize rows to mongo datalake models.
+//   - Upsert each chunk to the appropriate collection before reading on.
 //   - Move the file to the unprocessedDir, only if the moveProcessedFiles
 //     flag is enabled.
 func (p *CSVFileProcessor) processFile(
 	ctx context.Context,
 	unprocessedFile os.DirEntry,
 ) error {
-	sourceInfo, err := p.Extractor.ExtractInfo(unprocessedFile.Name())
+	unprocessedFilePath := sanitizeFilePath(unprocessedFile, p.UnprocessedDir)
+
+	// A sidecar or manifest declares what the file is ahead of its name and contents.
+	metadata, sidecarPath, err := loadMetadata(p.UnprocessedDir, unprocessedFile.Name())
+	if err != nil {
+		return err
+	}
+
+	sourceInfo, err := p.identify(ctx, unprocessedFile.Name(), unprocessedFilePath, metadata)
 	if err != nil {
 		return fmt.Errorf("failed to extract source info: %w", err)
 	}
+
+	profile, err := p.metadataProfile(sourceInfo.DataSource, metadata)
+	if err != nil {
+		return err
+	}
+	// The file's rows name its account when neither its name nor its metadata does. A file
+	// nothing names the account of is refused rather than stored under a placeholder.
+	if sourceInfo.AccountUnknown {
+		accountID, contentErr := p.contentAccountID(ctx, unprocessedFilePath, sourceInfo, profile)
+		if contentErr != nil {
+			return contentErr
+		}
+		if accountID == "" {
+			return UnknownAccountError(unprocessedFile.Name())
+		}
+		sourceInfo.AccountID, sourceInfo.AccountUnknown = accountID, false
+	}
+
+	// Transactions are stored under the account's canonical ID, whichever of its
+	// identifiers the file carries.
+	account, err := p.registeredAccount(ctx, sourceInfo)
+	if err != nil {
+		return err
+	}
+	sourceInfo.AccountID = account.AccountID
 	dataSource := sourceInfo.DataSource
 	accountID := sourceInfo.AccountID
 
-	unprocessedFilePath := sanitizeFilePath(unprocessedFile, p.UnprocessedDir)
+	profile = accountProfile(profile, account)
+	if profile.HasAmbiguousLayouts() {
+		profile, err = p.detectDateLayouts(ctx, unprocessedFilePath, sourceInfo, profile)
+		if err != nil {
+			return err
+		}
+	}
 
-	// Parse raw records.
-	rawRecords, _, err := p.Parser.Parse(ctx, unprocessedFilePath, dataSource, accountID)
+	// Every transaction records the file, line and run it came from.
+	fileHash, err := hashFile(unprocessedFilePath)
 	if err != nil {
 		return err
 	}
+	lineage := model.Lineage{
+		SourceFile: unprocessedFile.Name(),
+		FileHash:   fileHash,
+		RunID:      p.RunID,
+		IngestedAt: time.Now().UTC(),
+	}
 
-	// Create transaction mappings.
-	transactions, err := mapRawRecordsToTransactions(ctx, rawRecords, dataSource, accountID)
+	// Rejected rows are quarantined next to the processed archive.
+	rejects := newRejectWriter(p.ProcessedDir, unprocessedFile.Name())
+	defer rejects.close()
+
+	// A file with an error budget is mapped once without upserting anything, so a file over
+	// its budget is failed, and left in place, before any of its transactions are written.
+	if profile.ErrorBudget.Enforced() {
+		check := newRecordBatch(p.Repo, p.batchSize(), profile, p.Rates, dataSource, accountID, lineage, rejects)
+		check.dryRun = true
+		if _, err = p.streamFile(ctx, unprocessedFile.Name(), unprocessedFilePath, sourceInfo, check); err != nil {
+			return err
+		}
+		if err = p.closeRejects(unprocessedFile.Name(), rejects, check); err != nil {
+			return err
+		}
+		if err = check.checkErrorBudget(); err != nil {
+			return err
+		}
+		// The check has already quarantined the file's rejected rows.
+		rejects = nil
+	}
+
+	// Stream raw records, flushing transactions as each chunk fills up.
+	batch := newRecordBatch(p.Repo, p.batchSize(), profile, p.Rates, dataSource, accountID, lineage, rejects)
+	summary, err := p.streamFile(ctx, unprocessedFile.Name(), unprocessedFilePath, sourceInfo, batch)
 	if err != nil {
 		return err
 	}
+	if rejects != nil {
+		if err = p.closeRejects(unprocessedFile.Name(), rejects, batch); err != nil {
+			return err
+		}
+	}
+
+	if batch.rawRecords > 0 && batch.transactions == 0 {
+		return fmt.Errorf("no valid transactions could be processed from %d raw records", batch.rawRecords)
+	}
 
-	// Upsert documents to datalake collection.
-	if err = p.Repo.BulkUpsertTransactions(ctx, transactions); err != nil {
-		return fmt.Errorf("failed to bulk upsert transactions: %w", err)
+	if len(summary.Statements) > 0 {
+		if err = p.reconcileStatements(ctx, unprocessedFile.Name(), sourceInfo, summary.Statements, batch); err != nil {
+			return err
+		}
 	}
 
-	// Move the file, only if moveProcessedFiles is enabled.
+	// Move the file, and archive its metadata, only if moveProcessedFiles is enabled.
 	if p.MoveProcessedFiles {
 		err = p.moveFile(ctx, unprocessedFilePath)
 		if err != nil {
 			return fmt.Errorf("failed to move file: %w", err)
 		}
+		if err = p.archiveMetadata(unprocessedFile.Name(), metadata, sidecarPath); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-// Return a sanitized path to the file.
-func sanitizeFilePath(file os.DirEntry, dir string) string {
-	// Return the shortest path name to the file.
-	sanitizedFileName := filepath.Clean(file.Name())
-
-	// Build unprocessed file path.
-	filePath := filepath.Join(dir, sanitizedFileName)
+// Stream a file's records through batch, flushing its last chunk, and record the dialect
+// the file was read with.
+func (p *CSVFileProcessor) streamFile(
+	ctx context.Context,
+	fileName string,
+	filePath string,
+	sourceInfo *datasource.SourceInfo,
+	batch *recordBatch,
+) (csvparser.Summary, error) {
+	summary, err := p.Parser.Parse(ctx, filePath, sourceInfo.DataSource, sourceInfo.AccountID, batch.add)
+	if summary.Dialect != nil {
+		p.Stats.RecordDialect(fileName, *summary.Dialect)
+	}
+	if err != nil {
+		return summary, err
+	}
+	return summary, batch.flush(ctx)
+}
 
-	return filePath
+// Close a file's rejects file and record the rows batch rejected in the stats.
+func (p *CSVFileProcessor) closeRejects(fileName string, rejects *rejectWriter, batch *recordBatch) error {
+	if err := rejects.close(); err != nil {
+		return err
+	}
+	p.Stats.RecordRejections(fileName, batch.rejected)
+	return nil
 }
 
-func getPostingDate(record map[string]string, validHeaders []string) string {
-	for _, header := range validHeaders {
-		if date, ok := record[header]; ok && date != "" {
-			return date
+// Identify the data source and account of a file. Formats that carry this information in
+// their contents, such as OFX, take precedence over the filename. When the contents name an
+// account but not an institution, the filename or the generic data source fills the gap.
+func (p *CSVFileProcessor) extractSourceInfo(
+	ctx context.Context,
+	fileName string,
+	filePath string,
+) (*datasource.SourceInfo, error) {
+	infoParser, ok := p.Parser.(csvparser.InfoParser)
+	if !ok {
+		return p.extractNameInfo(ctx, fileName, filePath)
+	}
+
+	contentInfo, err := infoParser.ParseInfo(ctx, filePath)
+	if errors.Is(err, datasource.ErrUnableToExtractInfo) {
+		return p.extractNameInfo(ctx, fileName, filePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if contentInfo.DataSource == "" {
+		contentInfo.DataSource = string(datasource.Generic)
+		if nameInfo, nameErr := p.Extractor.ExtractInfo(fileName); nameErr == nil {
+			contentInfo.DataSource = nameInfo.DataSource
 		}
 	}
-	return ""
+
+	return contentInfo, nil
 }
 
-func mapRawRecordsToTransactions(
+// Identify a file by its name. When the name does not say which bank the file came from,
+// its first rows are matched against the Detector's known layouts instead, and the
+// detection's confidence is recorded in the stats.
+func (p *CSVFileProcessor) extractNameInfo(
 	ctx context.Context,
-	rawRecords []map[string]string,
-	dataSource string,
-	accountID string,
-) ([]model.Transaction, error) {
-	logger := bcontext.LoggerFromContext(ctx)
+	fileName string,
+	filePath string,
+) (*datasource.SourceInfo, error) {
+	nameInfo, err := p.Extractor.ExtractInfo(fileName)
+	if err != nil && !errors.Is(err, datasource.ErrUnableToExtractInfo) {
+		return nil, err
+	}
+	if (err == nil && nameInfo.DataSource != string(datasource.Generic)) || p.Detector == nil {
+		return nameInfo, err
+	}
 
-	validPostingDateHeaders := []string{
-		"Post Date",
-		"Posting Date",
-		"post date",
-		"posting date",
+	sample, sampleErr := p.sampleFile(ctx, filePath, string(datasource.Generic))
+	if sampleErr != nil {
+		return nil, sampleErr
+	}
+	detection, ok := p.Detector.Detect(sample)
+	p.Stats.RecordDetection(fileName, detection)
+	if !ok {
+		return nameInfo, err
 	}
 
-	transactions := fromRecords(
-		ctx,
-		dataSource,
-		accountID,
-		rawRecords,
-		validPostingDateHeaders,
-		*logger,
-	)
+	p.Logger.InfoContext(ctx, "identified file by its contents",
+		"file", fileName, "dataSource", detection.DataSource, "confidence", detection.Confidence)
+	info := &datasource.SourceInfo{AccountID: datasource.UnknownAccountID, AccountUnknown: true}
+	if nameInfo != nil {
+		info.AccountID, info.AccountUnknown = nameInfo.AccountID, nameInfo.AccountUnknown
+	}
+	info.DataSource = string(detection.DataSource)
+	return info, nil
+}
+
+// Read the first sampleRows rows of a file for content detection.
+func (p *CSVFileProcessor) sampleFile(
+	ctx context.Context,
+	filePath string,
+	dataSource string,
+) (datasource.Sample, error) {
+	var sample datasource.Sample
+	_, err := p.Parser.Parse(ctx, filePath, dataSource, datasource.UnknownAccountID,
+		func(_ context.Context, record csvparser.Record) error {
+			if record.Reject == "" {
+				sample.Rows = append(sample.Rows, record.Fields)
+			}
+			if len(sample.Rows) == sampleRows {
+				return errSampleFull
+			}
+			return nil
+		})
+	if err != nil && !errors.Is(err, errSampleFull) {
+		return sample, fmt.Errorf("failed to sample file %s: %w", filePath, err)
+	}
+	return sample, nil
+}
+
+// Read a file's posting dates ahead of mapping it to tell which of the profile's ambiguous
+// date layouts, such as MM/DD and DD/MM, it uses. The file fails if its dates do not say.
+func (p *CSVFileProcessor) detectDateLayouts(
+	ctx context.Context,
+	filePath string,
+	sourceInfo *datasource.SourceInfo,
+	profile mapping.Profile,
+) (mapping.Profile, error) {
+	detector := profile.NewDateDetector()
+	_, err := p.Parser.Parse(ctx, filePath, sourceInfo.DataSource, sourceInfo.AccountID,
+		func(_ context.Context, record csvparser.Record) error {
+			if record.Reject == "" {
+				if value := profile.Value(record.Fields, mapping.FieldPostingDate); value != "" {
+					detector.Observe(value)
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return profile, err
+	}
+	return detector.Resolve()
+}
 
-	if len(rawRecords) > 0 && len(transactions) == 0 {
-		return nil, fmt.Errorf("no valid transactions could be processed from %d raw records", len(rawRecords))
+// Return the configured batch size, falling back to DefaultBatchSize.
+func (p *CSVFileProcessor) batchSize() int {
+	if p.BatchSize <= 0 {
+		return DefaultBatchSize
 	}
+	return p.BatchSize
+}
+
+// Return a sanitized path to the file.
+func sanitizeFilePath(file os.DirEntry, dir string) string {
+	// Return the shortest path name to the file.
+	sanitizedFileName := filepath.Clean(file.Name())
+
+	// Build unprocessed file path.
+	filePath := filepath.Join(dir, sanitizedFileName)
 
-	return transactions, nil
+	return filePath
 }
 
-// Map raw records to transaction DTOs.
+// Map raw records to transaction DTOs using the data source's mapping profile, converting
+// their amounts to the reporting currency when rates are given.
 func fromRecords(
 	ctx context.Context,
 	dataSource string,
 	accountID string,
-	rawRecords []map[string]string,
-	validPostingDateHeaders []string,
+	rawRecords []csvparser.Record,
+	profile mapping.Profile,
+	rates *fx.Table,
+	lineage model.Lineage,
 	logger slog.Logger,
-) []model.Transaction {
-	var transactions []model.Transaction
-	for _, record := range rawRecords {
-		postingDateStr := getPostingDate(record, validPostingDateHeaders)
+) ([]model.Transaction, []rejection) {
+	transactions := make([]model.Transaction, 0, len(rawRecords))
+	var rejections []rejection
+	for _, rawRecord := range rawRecords {
+		record := rawRecord.Fields
+		postingDateStr := profile.Value(record, mapping.FieldPostingDate)
 		if postingDateStr == "" {
-			logger.WarnContext(ctx, "Skipping record with empty posting date", "record", record)
+			logger.WarnContext(ctx, "Skipping record with empty posting date", "line", rawRecord.Line, "record", record)
+			rejections = append(rejections, rejection{record: rawRecord, reason: RejectMissingPostingDate})
 			continue
 		}
 
-		parsedDate, parseErr := time.Parse("01/02/2006", postingDateStr)
+		parsedDate, parseErr := profile.ParseDate(postingDateStr)
 		if parseErr != nil {
 			logger.WarnContext(
 				ctx,
 				"Skipping record with invalid date format",
+				"line", rawRecord.Line,
 				"date", postingDateStr,
 				"error", parseErr,
 			)
+			rejections = append(rejections, rejection{
+				record: rawRecord,
+				reason: RejectInvalidPostingDate,
+				detail: parseErr.Error(),
+			})
 			continue
 		}
 
-		amountStr := record["amount"]
-		amount, convErr := strconv.ParseFloat(amountStr, 64)
+		currency := profile.Value(record, mapping.FieldCurrency)
+		amount, convErr := profile.ReadAmount(record, rawRecord.Numeric, currency)
 		if convErr != nil {
-			logger.WarnContext(ctx, "Skipping record with invalid amount format", "amount", amountStr, "error", convErr)
+			logger.WarnContext(
+				ctx,
+				"Skipping record with invalid amount format",
+				"line", rawRecord.Line,
+				"amount", profile.Value(record, mapping.FieldAmount),
+				"error", convErr,
+			)
+			rejections = append(rejections, rejection{
+				record: rawRecord,
+				reason: RejectInvalidAmount,
+				detail: convErr.Error(),
+			})
 			continue
 		}
 
-		balance := 0.0
-		if balanceStr, ok := record["balance"]; ok && balanceStr != "" {
-			parsedBalance, balanceConvErr := strconv.ParseFloat(balanceStr, 64)
-			if balanceConvErr != nil {
+		// The amount may name its currency, e.g. 45.00 EUR, when no column does.
+		currency = amount.Currency
+		balance := money.New(0, currency)
+		parsedBalance, hasBalance, balanceConvErr := profile.ReadBalance(record, rawRecord.Numeric, currency)
+		switch {
+		case balanceConvErr != nil:
+			logger.WarnContext(
+				ctx,
+				"Skipping record with invalid balance format",
+				"balance", profile.Value(record, mapping.FieldBalance),
+				"error", balanceConvErr,
+			)
+		case hasBalance:
+			balance = parsedBalance
+		}
+
+		var reportingAmount *money.Money
+		fxRate := ""
+		if rates != nil {
+			converted, rate, fxErr := rates.Convert(amount, parsedDate)
+			if fxErr != nil {
+				logger.WarnContext(
+					ctx,
+					"Leaving amount unconverted",
+					"line", rawRecord.Line,
+					"amount", amount.String(),
+					"error", fxErr,
+				)
+			} else {
+				reportingAmount, fxRate = &converted, rate
+			}
+		}
+
+		valueDate := ""
+		if valueDateStr := profile.Value(record, mapping.FieldValueDate); valueDateStr != "" {
+			parsedValueDate, valueDateErr := profile.ParseDate(valueDateStr)
+			if valueDateErr != nil {
 				logger.WarnContext(
 					ctx,
-					"Skipping record with invalid balance format",
-					"balance", balanceStr,
-					"error", balanceConvErr,
+					"Ignoring invalid value date",
+					"line", rawRecord.Line,
+					"date", valueDateStr,
+					"error", valueDateErr,
 				)
 			} else {
-				balance = parsedBalance
+				valueDate = parsedValueDate.Format(mapping.DefaultDateLayout)
 			}
 		}
 
+		rowLineage := lineage
+		rowLineage.Line = rawRecord.Line
+
 		transactions = append(transactions, model.Transaction{
-			Details:        record["details"],
-			PostingDate:    parsedDate.Format("01/02/2006"), // Store as formatted string
-			Description:    record["description"],
-			Amount:         amount,
-			Category:       record["category"],
-			Type:           record["type"],
-			Balance:        balance,
-			CheckOrSlipNum: record["check or slip #"],
-			DataSource:     dataSource,
-			AccountID:      accountID,
+			SchemaVersion:   model.SchemaVersion,
+			Details:         profile.Value(record, mapping.FieldDetails),
+			PostingDate:     day(parsedDate),
+			RawPostingDate:  postingDateStr,
+			Description:     profile.Value(record, mapping.FieldDescription),
+			Amount:          amount,
+			Category:        profile.Value(record, mapping.FieldCategory),
+			Type:            profile.Value(record, mapping.FieldType),
+			Balance:         balance,
+			CheckOrSlipNum:  profile.Value(record, mapping.FieldCheckOrSlipNum),
+			DataSource:      dataSource,
+			AccountID:       accountID,
+			ExternalID:      profile.Value(record, mapping.FieldExternalID),
+			Memo:            profile.Value(record, mapping.FieldMemo),
+			ValueDate:       valueDate,
+			EndToEndID:      profile.Value(record, mapping.FieldEndToEndID),
+			StatementID:     profile.Value(record, mapping.FieldStatementID),
+			ReportingAmount: reportingAmount,
+			FXRate:          fxRate,
+			Raw:             profile.RawFields(record),
+			Lineage:         rowLineage,
 		})
 	}
-	return transactions
+	return transactions, rejections
+}
+
+// day keeps the calendar day of a parsed date, in the time zone it was parsed in, as
+// midnight UTC, dropping any time of day.
+func day(date time.Time) time.Time {
+	year, month, dayOfMonth := date.Date()
+	return time.Date(year, month, dayOfMonth, 0, 0, 0, 0, time.UTC)
 }
 
 // Move the file from processedFilePath to processedDir.
@@ -286,7 +593,7 @@ func (p *CSVFileProcessor) moveFile(
 	newPath := filepath.Join(p.ProcessedDir, fileName)
 
 	// Cleanup the processed file.
-	moveErr := moveProcessedFile(fileName, newPath)
+	moveErr := moveProcessedFile(processedFilePath, newPath)
 	if moveErr != nil {
 		return MoveFileError(fileName, p.ProcessedDir)
 	}
@@ -317,12 +624,32 @@ func checkProcessedDir(ctx context.Context, processedDir string) error {
 	return nil
 }
 
-// Return true only if the entry is a valid csv.
-func validateCSVFile(
+// Return true only if the entry is a file the parser can read.
+func (p *CSVFileProcessor) validateFile(
 	file os.DirEntry,
 ) bool {
-	if file.IsDir() || (!strings.HasSuffix(file.Name(), ".csv") && !strings.HasSuffix(file.Name(), ".CSV")) {
+	if file.IsDir() {
 		return false
 	}
-	return true
+	if matcher, ok := p.Parser.(csvparser.FileMatcher); ok {
+		return matcher.Supports(sanitizeFilePath(file, p.UnprocessedDir))
+	}
+	return validateDataFile(file, ".csv")
+}
+
+// Return true only if the entry is a file with one of the given extensions, in any case.
+func validateDataFile(
+	file os.DirEntry,
+	extensions ...string,
+) bool {
+	if file.IsDir() {
+		return false
+	}
+	ext := filepath.Ext(file.Name())
+	for _, candidate := range extensions {
+		if strings.EqualFold(ext, candidate) {
+			return true
+		}
+	}
+	return false
 }
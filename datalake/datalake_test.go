@@ -2,15 +2,26 @@ package datalake
 
 import (
 	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	csvparser "babylon/dataloader/csv"
 	"babylon/dataloader/datalake/datasource"
+	"babylon/dataloader/datalake/fx"
+	"babylon/dataloader/datalake/mapping"
 	"babylon/dataloader/datalake/model"
-	_ "babylon/dataloader/datalake/repository"
+	"babylon/dataloader/datalake/repository"
+	"babylon/dataloader/money"
+	mt940parser "babylon/dataloader/mt940"
 )
 
 // ---- Mocks ----
@@ -18,16 +29,44 @@ import (
 // mockRepository implements repository.Repository for testing.
 type mockRepository struct {
 	bulkUpsertTransactionsCalled bool
+	bulkUpsertCalls              int
 	transactions                 []model.Transaction
+	statements                   []model.Statement
 	err                          error
 }
 
 func (m *mockRepository) BulkUpsertTransactions(ctx context.Context, transactions []model.Transaction) error {
 	m.bulkUpsertTransactionsCalled = true
-	m.transactions = transactions
+	m.bulkUpsertCalls++
+	m.transactions = append(m.transactions, transactions...)
 	return m.err
 }
 
+func (m *mockRepository) UpsertStatements(ctx context.Context, statements []model.Statement) error {
+	m.statements = append(m.statements, statements...)
+	return m.err
+}
+
+// mockAccountRepository implements repository.AccountRepository for testing.
+type mockAccountRepository struct {
+	accounts []model.Account
+}
+
+func (m *mockAccountRepository) FindAccount(ctx context.Context, dataSource string, accountID string) (model.Account, error) {
+	for _, account := range m.accounts {
+		if account.DataSource == dataSource && (account.AccountID == accountID ||
+			slices.Contains(account.Aliases, model.NormalizeAccountAlias(accountID))) {
+			return account, nil
+		}
+	}
+	return model.Account{}, repository.ErrAccountNotFound
+}
+
+func (m *mockAccountRepository) AddAccount(ctx context.Context, account model.Account) error {
+	m.accounts = append(m.accounts, account)
+	return nil
+}
+
 // mockInfoExtractor implements datasource.InfoExtractor for testing.
 type mockInfoExtractor struct {
 	extractInfoCalled bool
@@ -44,12 +83,27 @@ func (m *mockInfoExtractor) ExtractInfo(filename string) (*datasource.SourceInfo
 type mockCSVParser struct {
 	parseCalled bool
 	records     []map[string]string
+	statements  []csvparser.Statement
 	err         error
 }
 
-func (m *mockCSVParser) Parse(ctx context.Context, filePath string, dataSource string, accountID string) ([]map[string]string, int64, error) {
+func (m *mockCSVParser) Parse(
+	ctx context.Context,
+	filePath string,
+	dataSource string,
+	accountID string,
+	handle csvparser.RecordHandler,
+) (csvparser.Summary, error) {
 	m.parseCalled = true
-	return m.records, int64(len(m.records)), m.err
+	if m.err != nil {
+		return csvparser.Summary{}, m.err
+	}
+	for i, fields := range m.records {
+		if err := handle(ctx, csvparser.Record{Line: int64(i + 2), Fields: fields}); err != nil {
+			return csvparser.Summary{Records: int64(i)}, err
+		}
+	}
+	return csvparser.Summary{Records: int64(len(m.records)), Statements: m.statements}, nil
 }
 
 // ---- Tests ----
@@ -131,18 +185,18 @@ DEBIT,01/31/2023,"WHOLEFDS HAR 102 230 B OAKLAND CA    211023  01/31",-75.77,DEB
 	}
 	expectedTransaction := model.Transaction{
 		Details:        "DEBIT",
-		PostingDate:    "01/31/2023",
+		PostingDate:    time.Date(2023, time.January, 31, 0, 0, 0, 0, time.UTC),
 		Description:    "WHOLEFDS HAR 102 230 B OAKLAND CA    211023  01/31",
-		Amount:         -75.77,
+		Amount:         money.New(-7577, ""),
 		Type:           "DEBIT_CARD",
-		Balance:        11190.76,
+		Balance:        money.New(1119076, ""),
 		CheckOrSlipNum: "",
 		DataSource:     string(datasource.Generic),
 		AccountID:      "1234",
 	}
 
 	if mockRepo.transactions[0].Details != expectedTransaction.Details ||
-		mockRepo.transactions[0].PostingDate != expectedTransaction.PostingDate ||
+		!mockRepo.transactions[0].PostingDate.Equal(expectedTransaction.PostingDate) ||
 		mockRepo.transactions[0].Description != expectedTransaction.Description ||
 		mockRepo.transactions[0].Amount != expectedTransaction.Amount ||
 		mockRepo.transactions[0].Type != expectedTransaction.Type ||
@@ -231,18 +285,18 @@ DEBIT,01/31/2023,"WHOLEFDS HAR 102 230 B OAKLAND CA    211023  01/31",-75.77,DEB
 	}
 	expectedTransaction := model.Transaction{
 		Details:        "DEBIT",
-		PostingDate:    "01/31/2023",
+		PostingDate:    time.Date(2023, time.January, 31, 0, 0, 0, 0, time.UTC),
 		Description:    "WHOLEFDS HAR 102 230 B OAKLAND CA    211023  01/31",
-		Amount:         -75.77,
+		Amount:         money.New(-7577, ""),
 		Type:           "DEBIT_CARD",
-		Balance:        11190.76,
+		Balance:        money.New(1119076, ""),
 		CheckOrSlipNum: "",
 		DataSource:     "bank",
 		AccountID:      "5678",
 	}
 
 	if mockRepo.transactions[0].Details != expectedTransaction.Details ||
-		mockRepo.transactions[0].PostingDate != expectedTransaction.PostingDate ||
+		!mockRepo.transactions[0].PostingDate.Equal(expectedTransaction.PostingDate) ||
 		mockRepo.transactions[0].Description != expectedTransaction.Description ||
 		mockRepo.transactions[0].Amount != expectedTransaction.Amount ||
 		mockRepo.transactions[0].Type != expectedTransaction.Type ||
@@ -254,19 +308,1252 @@ DEBIT,01/31/2023,"WHOLEFDS HAR 102 230 B OAKLAND CA    211023  01/31",-75.77,DEB
 	}
 }
 
-// mockDirEntry implements fs.DirEntry for testing.
-type mockDirEntry struct {
-	os.FileInfo
+func TestProcessFile_FlushesInBatches(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "chase1234_batches.csv")
+	if err := os.WriteFile(filePath, []byte("placeholder"), 0o644); err != nil {
+		t.Fatalf("failed to write test CSV file: %v", err)
+	}
+
+	records := make([]map[string]string, 0, 5)
+	for _, amount := range []string{"-1.00", "-2.00", "-3.00", "-4.00", "-5.00"} {
+		records = append(records, map[string]string{
+			"details":      "DEBIT",
+			"posting date": "01/31/2023",
+			"description":  "Purchase " + amount,
+			"amount":       amount,
+		})
+	}
+
+	mockRepo := &mockRepository{}
+	mockExtractor := &mockInfoExtractor{
+		info: &datasource.SourceInfo{DataSource: string(datasource.Chase), AccountID: "1234"},
+	}
+	mockParser := &mockCSVParser{records: records}
+
+	processor := NewCSVFileProcessor(
+		mockRepo,
+		mockExtractor,
+		mockParser,
+		tmpDir,
+		"",
+		false,
+		NewStats(),
+		*slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	processor.BatchSize = 2
+
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to get file info: %v", err)
+	}
+
+	if processErr := processor.processFile(ctx, newMockDirEntry(fileInfo)); processErr != nil {
+		t.Fatalf("processFile failed: %v", processErr)
+	}
+
+	if mockRepo.bulkUpsertCalls != 3 {
+		t.Errorf("Expected 3 bulk upserts for 5 rows in batches of 2, got %d", mockRepo.bulkUpsertCalls)
+	}
+	if len(mockRepo.transactions) != len(records) {
+		t.Errorf("Expected %d transactions to be upserted, got %d", len(records), len(mockRepo.transactions))
+	}
 }
 
-func newMockDirEntry(info os.FileInfo) mockDirEntry {
-	return mockDirEntry{info}
+func TestProcessFile_NoValidTransactions(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "chase1234_invalid.csv")
+	if err := os.WriteFile(filePath, []byte("placeholder"), 0o644); err != nil {
+		t.Fatalf("failed to write test CSV file: %v", err)
+	}
+
+	mockRepo := &mockRepository{}
+	mockParser := &mockCSVParser{
+		records: []map[string]string{
+			{"posting date": "not a date", "amount": "-1.00"},
+			{"posting date": "01/31/2023", "amount": "not an amount"},
+		},
+	}
+
+	processedDir := filepath.Join(tmpDir, "processed")
+	stats := NewStats()
+	processor := NewCSVFileProcessor(
+		mockRepo,
+		&mockInfoExtractor{info: &datasource.SourceInfo{DataSource: string(datasource.Chase), AccountID: "1234"}},
+		mockParser,
+		tmpDir,
+		processedDir,
+		false,
+		stats,
+		*slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to get file info: %v", err)
+	}
+
+	if processErr := processor.processFile(ctx, newMockDirEntry(fileInfo)); processErr == nil {
+		t.Fatal("Expected processFile to fail when no rows could be mapped")
+	}
+	if mockRepo.bulkUpsertTransactionsCalled {
+		t.Error("Expected BulkUpsertTransactions not to be called")
+	}
+
+	// Both rows are quarantined rather than dropped.
+	rejected := stats.Rejections["chase1234_invalid.csv"]
+	if rejected[RejectInvalidPostingDate] != 1 || rejected[RejectInvalidAmount] != 1 {
+		t.Errorf("Expected one rejection per reason in stats, got %v", rejected)
+	}
+	rejectsFile, err := os.Open(filepath.Join(processedDir, "chase1234_invalid.csv"+rejectsSuffix))
+	if err != nil {
+		t.Fatalf("Expected a rejects file: %v", err)
+	}
+	defer rejectsFile.Close()
+	rows, err := csv.NewReader(rejectsFile).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read rejects file: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("Expected a header and 2 rejected rows, got %d rows", len(rows))
+	}
+	if rows[1][0] != "2" || rows[1][1] != RejectInvalidPostingDate ||
+		rows[2][0] != "3" || rows[2][1] != RejectInvalidAmount {
+		t.Errorf("Unexpected rejects %v", rows[1:])
+	}
 }
 
-func (m mockDirEntry) Type() os.FileMode {
-	return m.Mode().Type()
+func TestIngestCSVFile_FailsOverErrorBudget(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "chase1234_budget.csv")
+	if err := os.WriteFile(filePath, []byte("placeholder"), 0o644); err != nil {
+		t.Fatalf("failed to write test CSV file: %v", err)
+	}
+
+	mockRepo := &mockRepository{}
+	mockParser := &mockCSVParser{
+		records: []map[string]string{
+			{"posting date": "01/31/2023", "amount": "-1.00"},
+			{"posting date": "", "amount": "-2.00"},
+			{"posting date": "01/31/2023", "amount": "not an amount"},
+			{"posting date": "01/31/2023", "amount": "-4.00"},
+		},
+	}
+
+	stats := NewStats()
+	processedDir := filepath.Join(tmpDir, "processed")
+	processor := NewCSVFileProcessor(
+		mockRepo,
+		&mockInfoExtractor{info: &datasource.SourceInfo{DataSource: string(datasource.Chase), AccountID: "1234"}},
+		mockParser,
+		tmpDir,
+		processedDir,
+		true,
+		stats,
+		*slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	maxPercent := 25.0
+	processor.Mappings = mapping.Default()
+	processor.Mappings.Default.ErrorBudget = mapping.ErrorBudget{MaxPercent: &maxPercent}
+	// Every valid row fills a batch of its own, ahead of the rows that break the budget.
+	processor.BatchSize = 1
+
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to get file info: %v", err)
+	}
+
+	// Half of the rows are rejected, over the 25% budget.
+	if ingestErr := processor.ingestCSVFile(ctx, newMockDirEntry(fileInfo)); ingestErr == nil {
+		t.Fatal("Expected ingestCSVFile to fail over the error budget")
+	}
+	if stats.FailedFiles != 1 || stats.ProcessedFiles != 0 {
+		t.Errorf("Expected the file to be counted as failed, got %+v", stats)
+	}
+	expected := "too many rows rejected, 2 of 4 (invalid_amount=1, missing_posting_date=1)"
+	if reason := stats.Failures["chase1234_budget.csv"]; !strings.Contains(reason, expected) {
+		t.Errorf("Expected failure reason to contain %q, got %q", expected, reason)
+	}
+	if _, statErr := os.Stat(filePath); statErr != nil {
+		t.Errorf("Expected the file to stay in the unprocessed directory: %v", statErr)
+	}
+	// Nothing from a file over its budget is written.
+	if mockRepo.bulkUpsertCalls != 0 || len(mockRepo.transactions) != 0 {
+		t.Errorf("Expected no upserts, got %d calls with %d transactions", mockRepo.bulkUpsertCalls, len(mockRepo.transactions))
+	}
+	rejects, err := os.ReadFile(filepath.Join(processedDir, "chase1234_budget.csv"+rejectsSuffix))
+	if err != nil || strings.Count(string(rejects), "\n") != 3 {
+		t.Errorf("Expected a header and 2 quarantined rows, got %q (%v)", rejects, err)
+	}
 }
 
-func (m mockDirEntry) Info() (os.FileInfo, error) {
-	return m, nil
+func TestIngestCSVFile_DetectsDayFirstDates(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "chase1234_dates.csv")
+	if err := os.WriteFile(filePath, []byte("placeholder"), 0o644); err != nil {
+		t.Fatalf("failed to write test CSV file: %v", err)
+	}
+
+	newProcessor := func(records []map[string]string, repo *mockRepository, stats *Stats) *CSVFileProcessor {
+		processor := NewCSVFileProcessor(
+			repo,
+			&mockInfoExtractor{info: &datasource.SourceInfo{DataSource: string(datasource.Chase), AccountID: "1234"}},
+			&mockCSVParser{records: records},
+			tmpDir,
+			filepath.Join(tmpDir, "processed"),
+			false,
+			stats,
+			*slog.New(slog.NewTextHandler(io.Discard, nil)),
+		)
+		processor.Mappings = mapping.Default()
+		processor.Mappings.Default.DateLayouts = []string{"01/02/2006", "02/01/2006"}
+		return processor
+	}
+
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to get file info: %v", err)
+	}
+
+	// The 25th cannot be a month, so every date in the file is read day first.
+	mockRepo := &mockRepository{}
+	processor := newProcessor([]map[string]string{
+		{"posting date": "03/04/2023", "amount": "-1.00"},
+		{"posting date": "25/04/2023", "amount": "-2.00"},
+	}, mockRepo, NewStats())
+	if err = processor.ingestCSVFile(ctx, newMockDirEntry(fileInfo)); err != nil {
+		t.Fatalf("ingestCSVFile failed: %v", err)
+	}
+	if len(mockRepo.transactions) != 2 {
+		t.Fatalf("Expected 2 transactions, got %d", len(mockRepo.transactions))
+	}
+	if got := mockRepo.transactions[0].PostingDate; !got.Equal(time.Date(2023, time.April, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected 3 April 2023, got %v", got)
+	}
+
+	// Dates that fit both layouts fail the file rather than guess.
+	stats := NewStats()
+	processor = newProcessor([]map[string]string{
+		{"posting date": "03/04/2023", "amount": "-1.00"},
+	}, &mockRepository{}, stats)
+	if err = processor.ingestCSVFile(ctx, newMockDirEntry(fileInfo)); err == nil {
+		t.Fatal("Expected ingestCSVFile to fail for ambiguous dates")
+	}
+	if reason := stats.Failures["chase1234_dates.csv"]; !strings.Contains(reason, "ambiguous dates") {
+		t.Errorf("Expected an ambiguous dates failure, got %q", reason)
+	}
+}
+
+func TestIngestCSVFile_AssignsStableTransactionIDs(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "chase1234_ids.csv")
+	if err := os.WriteFile(filePath, []byte("placeholder"), 0o644); err != nil {
+		t.Fatalf("failed to write test CSV file: %v", err)
+	}
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to get file info: %v", err)
+	}
+
+	// Two genuine identical purchases on the same day, and a third on another.
+	records := []map[string]string{
+		{"posting date": "01/31/2023", "description": "COFFEE", "amount": "-4.50"},
+		{"posting date": "01/31/2023", "description": "COFFEE", "amount": "-4.50"},
+		{"posting date": "02/01/2023", "description": "COFFEE", "amount": "-4.50"},
+	}
+	ingest := func() []model.Transaction {
+		mockRepo := &mockRepository{}
+		processor := NewCSVFileProcessor(
+			mockRepo,
+			&mockInfoExtractor{info: &datasource.SourceInfo{DataSource: string(datasource.Chase), AccountID: "1234"}},
+			&mockCSVParser{records: records},
+			tmpDir,
+			filepath.Join(tmpDir, "processed"),
+			false,
+			NewStats(),
+			*slog.New(slog.NewTextHandler(io.Discard, nil)),
+		)
+		processor.BatchSize = 2
+		if ingestErr := processor.ingestCSVFile(ctx, newMockDirEntry(fileInfo)); ingestErr != nil {
+			t.Fatalf("ingestCSVFile failed: %v", ingestErr)
+		}
+		return mockRepo.transactions
+	}
+
+	first := ingest()
+	if len(first) != 3 {
+		t.Fatalf("Expected 3 transactions, got %d", len(first))
+	}
+	ids := make(map[string]bool)
+	for _, transaction := range first {
+		if transaction.TransactionID == "" {
+			t.Fatalf("Expected every transaction to have an ID, got %+v", transaction)
+		}
+		ids[transaction.TransactionID] = true
+	}
+	if len(ids) != 3 {
+		t.Errorf("Expected 3 distinct IDs, got %d", len(ids))
+	}
+
+	// Loading the file again gives the same IDs, so its documents are updated in place.
+	for i, transaction := range ingest() {
+		if transaction.TransactionID != first[i].TransactionID {
+			t.Errorf("Expected transaction %d to keep ID %s, got %s", i, first[i].TransactionID, transaction.TransactionID)
+		}
+	}
+}
+
+func TestIngestCSVFile_RecordsLineage(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+	processedDir := filepath.Join(tmpDir, "processed")
+	content := "Posting Date,Description,Amount\r\n01/31/2023,COFFEE,-4.50\r\n02/01/2023,BOOKS,-12.00\r\n"
+	filePath := filepath.Join(tmpDir, "chase1234_lineage.csv")
+	if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write test CSV file: %v", err)
+	}
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to get file info: %v", err)
+	}
+
+	mockRepo := &mockRepository{}
+	processor := NewCSVFileProcessor(
+		mockRepo,
+		&mockInfoExtractor{info: &datasource.SourceInfo{DataSource: string(datasource.Chase), AccountID: "1234"}},
+		&mockCSVParser{records: []map[string]string{
+			{"posting date": "01/31/2023", "description": "COFFEE", "amount": "-4.50"},
+			{"posting date": "02/01/2023", "description": "BOOKS", "amount": "-12.00"},
+		}},
+		tmpDir,
+		processedDir,
+		true,
+		NewStats(),
+		*slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	if err = processor.ingestCSVFile(ctx, newMockDirEntry(fileInfo)); err != nil {
+		t.Fatalf("ingestCSVFile failed: %v", err)
+	}
+
+	if len(mockRepo.transactions) != 2 {
+		t.Fatalf("Expected 2 transactions, got %d", len(mockRepo.transactions))
+	}
+	lineage := mockRepo.transactions[1].Lineage
+	if lineage.SourceFile != "chase1234_lineage.csv" || lineage.Line != 3 || lineage.RunID != processor.RunID ||
+		len(lineage.FileHash) != 64 || lineage.IngestedAt.IsZero() {
+		t.Errorf("Expected lineage of line 3 in run %s, got %+v", processor.RunID, lineage)
+	}
+
+	if raw := mockRepo.transactions[1].Raw; raw["description"] != "BOOKS" || raw["amount"] != "-12.00" {
+		t.Errorf("Expected the raw row to be kept, got %v", raw)
+	}
+
+	// The row can be traced to the archived file.
+	path, row, err := SourceRow(lineage, tmpDir, processedDir)
+	if err != nil {
+		t.Fatalf("SourceRow failed: %v", err)
+	}
+	if path != filepath.Join(processedDir, "chase1234_lineage.csv") || row != "02/01/2023,BOOKS,-12.00" {
+		t.Errorf("Expected line 3 of the archived file, got %q from %s", row, path)
+	}
+
+	if err = os.WriteFile(path, []byte("edited"), 0o644); err != nil {
+		t.Fatalf("failed to edit archived file: %v", err)
+	}
+	if _, _, err = SourceRow(lineage, processedDir); err == nil {
+		t.Error("Expected SourceRow to refuse a file that changed since it was ingested")
+	}
+}
+
+func TestSourceRow_NotLineOriented(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"chase1234.ofx", "giro.xml", "giro.sta", "chase1234.xlsx"} {
+		content := []byte("<OFX>\n<STMTTRN>\n")
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		hash, err := hashFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("failed to hash %s: %v", name, err)
+		}
+
+		lineage := model.Lineage{SourceFile: name, FileHash: hash, Line: 2}
+		if _, row, err := SourceRow(lineage, dir); !errors.Is(err, errRowUnavailable) || row != "" {
+			t.Errorf("Expected no raw row for %s, got %q, %v", name, row, err)
+		}
+	}
+}
+
+// writeSource writes a source file to dir and returns the lineage of one of its lines.
+func writeSource(t *testing.T, dir string, name string, content []byte, line int64) model.Lineage {
+	t.Helper()
+	filePath := filepath.Join(dir, name)
+	if err := os.WriteFile(filePath, content, 0o644); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	hash, err := hashFile(filePath)
+	if err != nil {
+		t.Fatalf("failed to hash %s: %v", name, err)
+	}
+	return model.Lineage{SourceFile: name, FileHash: hash, Line: line}
+}
+
+func TestSourceRow_DecodesText(t *testing.T) {
+	dir := t.TempDir()
+	text := "Posting Date,Description,Amount\r\n01/31/2023,Caf\u00e9 \u20ac,-4.50\r\n"
+
+	// UTF-16LE with a byte order mark, as Excel's "Unicode text" export writes it.
+	utf16 := []byte{0xff, 0xfe}
+	for _, r := range text {
+		utf16 = append(utf16, byte(r), byte(r>>8))
+	}
+	// Windows-1252, where é is 0xE9 and € is 0x80.
+	windows1252 := []byte(strings.NewReplacer("\u00e9", "\xe9", "\u20ac", "\x80").Replace(text))
+
+	for name, content := range map[string][]byte{"utf16.csv": utf16, "windows1252.csv": windows1252} {
+		_, row, err := SourceRow(writeSource(t, dir, name, content, 2), dir)
+		if err != nil {
+			t.Fatalf("SourceRow of %s failed: %v", name, err)
+		}
+		if row != "01/31/2023,Caf\u00e9 \u20ac,-4.50" {
+			t.Errorf("Expected the decoded second line of %s, got %q", name, row)
+		}
+	}
+}
+
+func TestSourceRow_QIFEntry(t *testing.T) {
+	dir := t.TempDir()
+	content := "!Type:Bank\nD01/31/2023\nT-4.50\nPCoffee\n^\n\nD02/01/2023\nT-12.00\nPBooks\n"
+
+	tests := []struct {
+		line int64
+		want string
+	}{
+		{2, "D01/31/2023\nT-4.50\nPCoffee\n^"},
+		// The last entry has no closing ^.
+		{7, "D02/01/2023\nT-12.00\nPBooks"},
+	}
+	for _, tt := range tests {
+		_, row, err := SourceRow(writeSource(t, dir, "checking.qif", []byte(content), tt.line), dir)
+		if err != nil {
+			t.Fatalf("SourceRow failed: %v", err)
+		}
+		if row != tt.want {
+			t.Errorf("line %d: expected the whole entry %q, got %q", tt.line, tt.want, row)
+		}
+	}
+}
+
+func TestProcessFile_UsesSourceMapping(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "export.csv")
+	if err := os.WriteFile(filePath, []byte("placeholder"), 0o644); err != nil {
+		t.Fatalf("failed to write test CSV file: %v", err)
+	}
+
+	mockRepo := &mockRepository{}
+	mockParser := &mockCSVParser{
+		records: []map[string]string{
+			{"buchungstag": "31.01.2023", "verwendungszweck": "Bäckerei", "betrag": "-4.50"},
+		},
+	}
+
+	processor := NewCSVFileProcessor(
+		mockRepo,
+		&mockInfoExtractor{info: &datasource.SourceInfo{DataSource: "dkb", AccountID: "9876"}},
+		mockParser,
+		tmpDir,
+		"",
+		false,
+		NewStats(),
+		*slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	processor.Mappings = &mapping.Config{
+		Default: mapping.DefaultProfile(),
+		Sources: map[string]mapping.Profile{
+			"dkb": {
+				Columns: map[string][]string{
+					mapping.FieldPostingDate: {"Buchungstag"},
+					mapping.FieldDescription: {"Verwendungszweck"},
+					mapping.FieldAmount:      {"Betrag"},
+				},
+				DateLayouts: []string{"02.01.2006"},
+				Defaults:    map[string]string{mapping.FieldCategory: "groceries"},
+			},
+		},
+	}
+
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to get file info: %v", err)
+	}
+
+	if processErr := processor.processFile(ctx, newMockDirEntry(fileInfo)); processErr != nil {
+		t.Fatalf("processFile failed: %v", processErr)
+	}
+
+	if len(mockRepo.transactions) != 1 {
+		t.Fatalf("Expected 1 transaction to be upserted, got %d", len(mockRepo.transactions))
+	}
+	got := mockRepo.transactions[0]
+	if got.PostingDate.Format(mapping.ISODateLayout) != "2023-01-31" || got.RawPostingDate != "31.01.2023" ||
+		got.Description != "Bäckerei" || got.Amount != money.New(-450, "") ||
+		got.Category != "groceries" {
+		t.Errorf("Unexpected transaction %+v", got)
+	}
+}
+
+func TestProcessFile_DetectsSourceFromContent(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "Activity (3).csv")
+	if err := os.WriteFile(filePath, []byte("placeholder"), 0o644); err != nil {
+		t.Fatalf("failed to write test CSV file: %v", err)
+	}
+
+	mockRepo := &mockRepository{}
+	mockParser := &mockCSVParser{
+		records: []map[string]string{
+			{"date": "01/31/2023", "description": "Coffee", "card member": "J DOE", "account #": "-41007", "amount": "4.50"},
+			{"date": "02/01/2023", "description": "Refund", "card member": "J DOE", "account #": "-41007", "amount": "-2.00"},
+		},
+	}
+	registry := datasource.DefaultRegistry()
+
+	stats := NewStats()
+	processor := NewCSVFileProcessor(
+		mockRepo,
+		registry,
+		mockParser,
+		tmpDir,
+		"",
+		false,
+		stats,
+		*slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	processor.Mappings = mapping.Default().WithDefaults(registry.Mappings())
+
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to get file info: %v", err)
+	}
+
+	if processErr := processor.processFile(ctx, newMockDirEntry(fileInfo)); processErr != nil {
+		t.Fatalf("processFile failed: %v", processErr)
+	}
+
+	if len(mockRepo.transactions) != 2 {
+		t.Fatalf("Expected 2 transactions to be upserted, got %d", len(mockRepo.transactions))
+	}
+	got := mockRepo.transactions[0]
+	// The Amex profile's mapping applies, so charges are negated.
+	if got.DataSource != string(datasource.Amex) || got.AccountID != "-41007" ||
+		got.Amount != money.New(-450, "") {
+		t.Errorf("Unexpected transaction %+v", got)
+	}
+	detection := stats.Detections["Activity (3).csv"]
+	if detection.DataSource != datasource.Amex || detection.Confidence != 1 {
+		t.Errorf("Expected a confident Amex detection in the stats, got %+v", detection)
+	}
+}
+
+func TestProcessFile_ConvertsToReportingCurrency(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "travel.csv")
+	if err := os.WriteFile(filePath, []byte("placeholder"), 0o644); err != nil {
+		t.Fatalf("failed to write test CSV file: %v", err)
+	}
+
+	mockRepo := &mockRepository{}
+	mockParser := &mockCSVParser{
+		records: []map[string]string{
+			{"posting date": "01/31/2023", "amount": "-24.50", "currency": "EUR"},
+			{"posting date": "01/31/2023", "amount": "-1200", "currency": "JPY"},
+			{"posting date": "01/31/2023", "amount": "-10.00", "currency": "GBP"},
+			{"posting date": "01/31/2023", "amount": "-3.00"},
+		},
+	}
+
+	processor := NewCSVFileProcessor(
+		mockRepo,
+		&mockInfoExtractor{info: &datasource.SourceInfo{DataSource: "travel", AccountID: "4321"}},
+		mockParser,
+		tmpDir,
+		"",
+		false,
+		NewStats(),
+		*slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	processor.Rates = fx.NewTable("USD")
+	rateDate := time.Date(2023, time.January, 30, 0, 0, 0, 0, time.UTC)
+	if err := processor.Rates.Add("EUR", rateDate, "1.0856"); err != nil {
+		t.Fatalf("failed to add rate: %v", err)
+	}
+	if err := processor.Rates.Add("JPY", rateDate, "0.0077"); err != nil {
+		t.Fatalf("failed to add rate: %v", err)
+	}
+
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to get file info: %v", err)
+	}
+
+	if processErr := processor.processFile(ctx, newMockDirEntry(fileInfo)); processErr != nil {
+		t.Fatalf("processFile failed: %v", processErr)
+	}
+
+	if len(mockRepo.transactions) != 4 {
+		t.Fatalf("Expected 4 transactions to be upserted, got %d", len(mockRepo.transactions))
+	}
+	expected := []struct {
+		amount    string
+		reporting string
+		rate      string
+	}{
+		{"-24.50 EUR", "-26.60 USD", "1.0856"},
+		{"-1200 JPY", "-9.24 USD", "0.0077"},
+		// Without a GBP rate the amount is kept but not converted.
+		{"-10.00 GBP", "", ""},
+		{"-3.00", "-3.00 USD", "1"},
+	}
+	for i, want := range expected {
+		got := mockRepo.transactions[i]
+		reporting := ""
+		if got.ReportingAmount != nil {
+			reporting = got.ReportingAmount.String()
+		}
+		if got.Amount.String() != want.amount || reporting != want.reporting || got.FXRate != want.rate {
+			t.Errorf("Transaction %d: expected %s as %q at %q, got %s as %q at %q",
+				i, want.amount, want.reporting, want.rate, got.Amount, reporting, got.FXRate)
+		}
+	}
+}
+
+// mockDirEntry implements fs.DirEntry for testing.
+type mockDirEntry struct {
+	os.FileInfo
+}
+
+func newMockDirEntry(info os.FileInfo) mockDirEntry {
+	return mockDirEntry{info}
+}
+
+func (m mockDirEntry) Type() os.FileMode {
+	return m.Mode().Type()
+}
+
+func (m mockDirEntry) Info() (os.FileInfo, error) {
+	return m, nil
+}
+
+// mockInfoParser is a mockCSVParser that also identifies the file's source from its contents.
+type mockInfoParser struct {
+	mockCSVParser
+	info *datasource.SourceInfo
+}
+
+func (m *mockInfoParser) ParseInfo(ctx context.Context, filePath string) (*datasource.SourceInfo, error) {
+	return m.info, nil
+}
+
+func (m *mockInfoParser) Supports(fileName string) bool {
+	return filepath.Ext(fileName) == ".ofx"
+}
+
+func TestProcessFile_PrefersContentSourceInfo(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "statement.ofx")
+	if err := os.WriteFile(filePath, []byte("placeholder"), 0o644); err != nil {
+		t.Fatalf("failed to write test OFX file: %v", err)
+	}
+
+	mockRepo := &mockRepository{}
+	mockExtractor := &mockInfoExtractor{info: &datasource.SourceInfo{DataSource: "chase", AccountID: "0000"}}
+	mockParser := &mockInfoParser{
+		mockCSVParser: mockCSVParser{
+			records: []map[string]string{
+				{"posting date": "2023-01-31", "amount": "-4.50", "description": "Coffee", "fitid": "2023013101"},
+			},
+		},
+		info: &datasource.SourceInfo{AccountID: "1234"},
+	}
+
+	processor := NewCSVFileProcessor(
+		mockRepo,
+		mockExtractor,
+		mockParser,
+		tmpDir,
+		"",
+		false,
+		NewStats(),
+		*slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to get file info: %v", err)
+	}
+
+	if processErr := processor.processFile(ctx, newMockDirEntry(fileInfo)); processErr != nil {
+		t.Fatalf("processFile failed: %v", processErr)
+	}
+
+	if len(mockRepo.transactions) != 1 {
+		t.Fatalf("Expected 1 transaction to be upserted, got %d", len(mockRepo.transactions))
+	}
+	got := mockRepo.transactions[0]
+	// The account comes from the file contents, the data source from the filename.
+	if got.AccountID != "1234" || got.DataSource != "chase" {
+		t.Errorf("Expected account 1234 from chase, got %s from %s", got.AccountID, got.DataSource)
+	}
+	if got.PostingDate.Format(mapping.ISODateLayout) != "2023-01-31" || got.ExternalID != "2023013101" {
+		t.Errorf("Unexpected transaction %+v", got)
+	}
+}
+
+func TestProcessFile_ReconcilesStatements(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "statement.xml")
+	if err := os.WriteFile(filePath, []byte("placeholder"), 0o644); err != nil {
+		t.Fatalf("failed to write test camt file: %v", err)
+	}
+
+	mockRepo := &mockRepository{}
+	mockParser := &mockCSVParser{
+		records: []map[string]string{
+			{"posting date": "2023-01-31", "amount": "-24.5", "description": "Stadtwerke", "statement id": "S1"},
+			{"posting date": "2023-01-31", "amount": "250", "description": "ACME GmbH", "statement id": "S1"},
+			{"posting date": "2023-01-31", "amount": "-10", "description": "Fee", "statement id": "S2"},
+		},
+		statements: []csvparser.Statement{
+			{
+				ID:        "S1",
+				AccountID: "DE89370400440532013000",
+				Opening:   &csvparser.Balance{Amount: money.New(100000, "EUR")},
+				Closing:   &csvparser.Balance{Amount: money.New(122550, "EUR")},
+			},
+			{
+				ID:      "S2",
+				Opening: &csvparser.Balance{Amount: money.New(0, "EUR")},
+				Closing: &csvparser.Balance{Amount: money.New(-2000, "EUR")},
+			},
+		},
+	}
+
+	stats := NewStats()
+	processor := NewCSVFileProcessor(
+		mockRepo,
+		&mockInfoExtractor{info: &datasource.SourceInfo{DataSource: "generic", AccountID: "3000"}},
+		mockParser,
+		tmpDir,
+		"",
+		false,
+		stats,
+		*slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	processor.BatchSize = 2
+	// The statement's full IBAN is an alias of a registered account.
+	processor.Accounts = &mockAccountRepository{accounts: []model.Account{
+		{DataSource: "generic", AccountID: "giro", Aliases: []string{"de89370400440532013000"}},
+	}}
+
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to get file info: %v", err)
+	}
+
+	// A statement that does not reconcile is reported, not failed.
+	if processErr := processor.processFile(ctx, newMockDirEntry(fileInfo)); processErr != nil {
+		t.Fatalf("processFile failed: %v", processErr)
+	}
+
+	if len(mockRepo.statements) != 2 {
+		t.Fatalf("Expected 2 statements to be upserted, got %d", len(mockRepo.statements))
+	}
+	first, second := mockRepo.statements[0], mockRepo.statements[1]
+	if !first.Reconciled || first.Entries != 2 || first.EntriesTotal.Minor != 22550 || first.AccountID != "giro" {
+		t.Errorf("Expected S1 to reconcile across batches, got %+v", first)
+	}
+	if second.Reconciled || second.Difference != money.New(-1000, "EUR") || second.AccountID != "3000" {
+		t.Errorf("Expected S2 to be off by -10, got %+v", second)
+	}
+	if got := stats.Reconciliations["statement.xml"]; len(got) != 2 || got[1].Reconciled {
+		t.Errorf("Expected reconciliations in stats, got %+v", got)
+	}
+}
+
+func TestProcessFile_StatementAmountsIgnoreLocale(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "statement.sta")
+	statement := `:20:STARTUMS
+:25:37040044/0532013000
+:28C:00012/001
+:60F:C230130EUR1000,00
+:61:2301310131DR1234,50NTRFNONREF
+:86:Stadtwerke Berlin
+:61:2301310131CR250,NCHK4711
+:86:Salary January ACME GmbH
+:62F:C230131EUR15,50
+-
+`
+	if err := os.WriteFile(filePath, []byte(statement), 0o644); err != nil {
+		t.Fatalf("failed to write test MT940 file: %v", err)
+	}
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to get file info: %v", err)
+	}
+
+	mockRepo := &mockRepository{}
+	stats := NewStats()
+	processor := NewCSVFileProcessor(
+		mockRepo,
+		&mockInfoExtractor{info: &datasource.SourceInfo{DataSource: "dkb", AccountID: "3000"}},
+		mt940parser.NewParser(),
+		tmpDir,
+		"",
+		false,
+		stats,
+		*slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	// A German profile reads "1.234,50" in delimited text, but the parser
+	// already emits plain decimals that must not be re-read in the locale.
+	profile := mapping.DefaultProfile()
+	profile.Locale = "de-DE"
+	processor.Mappings = &mapping.Config{Default: profile}
+
+	if err = processor.processFile(ctx, newMockDirEntry(fileInfo)); err != nil {
+		t.Fatalf("processFile failed: %v", err)
+	}
+	if len(mockRepo.transactions) != 2 {
+		t.Fatalf("Expected 2 transactions, got %d", len(mockRepo.transactions))
+	}
+	if got := mockRepo.transactions[0].Amount; got != money.New(-123450, "EUR") {
+		t.Errorf("Expected -1234.50 EUR, got %v", got)
+	}
+	if got := mockRepo.transactions[1].Amount; got != money.New(25000, "EUR") {
+		t.Errorf("Expected 250.00 EUR, got %v", got)
+	}
+	if len(mockRepo.statements) != 1 || !mockRepo.statements[0].Reconciled {
+		t.Errorf("Expected the statement to reconcile, got %+v", mockRepo.statements)
+	}
+}
+
+func TestIngestCSVFile_HonorsSidecarMetadata(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+	processedDir := filepath.Join(tmpDir, "processed")
+	filePath := filepath.Join(tmpDir, "Activity (3).csv")
+	if err := os.WriteFile(filePath, []byte("placeholder"), 0o644); err != nil {
+		t.Fatalf("failed to write test CSV file: %v", err)
+	}
+	// The manifest covers every export; the sidecar overrides its account, and writes its
+	// currency code in lowercase.
+	manifest := `{"files": [
+		{"match": "Activity*.csv", "dataSource": "dkb", "accountID": "1111", "currency": "EUR", "dateLayout": "02.01.2006"}
+	]}`
+	if err := os.WriteFile(filepath.Join(tmpDir, ManifestFile), []byte(manifest), 0o644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	sidecarPath := filePath + SidecarSuffix
+	if err := os.WriteFile(sidecarPath, []byte(`{"accountID": "9876", "profile": "giro", "currency": " eur"}`), 0o644); err != nil {
+		t.Fatalf("failed to write sidecar: %v", err)
+	}
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to get file info: %v", err)
+	}
+
+	mockRepo := &mockRepository{}
+	mockExtractor := &mockInfoExtractor{err: datasource.ErrUnableToExtractInfo}
+	processor := NewCSVFileProcessor(
+		mockRepo,
+		mockExtractor,
+		&mockCSVParser{records: []map[string]string{
+			{"buchungstag": "03.02.2023", "betrag": "-4.50"},
+		}},
+		tmpDir,
+		processedDir,
+		true,
+		NewStats(),
+		*slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	processor.Mappings = &mapping.Config{
+		Default: mapping.DefaultProfile(),
+		Sources: map[string]mapping.Profile{
+			"giro": {Columns: map[string][]string{
+				mapping.FieldPostingDate: {"Buchungstag"},
+				mapping.FieldAmount:      {"Betrag"},
+			}},
+		},
+	}
+
+	if err = processor.ingestCSVFile(ctx, newMockDirEntry(fileInfo)); err != nil {
+		t.Fatalf("ingestCSVFile failed: %v", err)
+	}
+	if mockExtractor.extractInfoCalled {
+		t.Error("Expected the extractor not to be asked when the metadata declares the source and account")
+	}
+
+	if len(mockRepo.transactions) != 1 {
+		t.Fatalf("Expected 1 transaction, got %d", len(mockRepo.transactions))
+	}
+	got := mockRepo.transactions[0]
+	if got.DataSource != "dkb" || got.AccountID != "9876" || got.Amount != money.New(-450, "EUR") ||
+		got.PostingDate.Format(mapping.ISODateLayout) != "2023-02-03" {
+		t.Errorf("Unexpected transaction %+v", got)
+	}
+
+	// The metadata the file was read with is archived as its sidecar; the manifest stays for
+	// the next export.
+	archived, err := os.ReadFile(filepath.Join(processedDir, "Activity (3).csv"+SidecarSuffix))
+	if err != nil {
+		t.Fatalf("Expected the sidecar to be archived: %v", err)
+	}
+	var archivedMetadata Metadata
+	if err = json.Unmarshal(archived, &archivedMetadata); err != nil {
+		t.Fatalf("failed to decode archived sidecar: %v", err)
+	}
+	want := Metadata{DataSource: "dkb", AccountID: "9876", Currency: "EUR", DateLayout: "02.01.2006", Profile: "giro"}
+	if archivedMetadata != want {
+		t.Errorf("Expected the archived sidecar to hold %+v, got %+v", want, archivedMetadata)
+	}
+	if _, err = os.Stat(sidecarPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the sidecar to leave the unprocessed directory, got %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(tmpDir, ManifestFile)); err != nil {
+		t.Errorf("Expected the manifest to stay in place: %v", err)
+	}
+}
+
+func TestProcessFile_RejectsInvalidMetadata(t *testing.T) {
+	tests := map[string]struct {
+		manifest string
+		sidecar  string
+	}{
+		"sidecar date layout without a day":        {sidecar: `{"dateLayout": "01/2006"}`},
+		"sidecar date layout that is not a layout": {sidecar: `{"dateLayout": "dd.mm.yyyy"}`},
+		"manifest data source":                     {manifest: `{"files": [{"match": "*.csv", "dataSource": "My Bank"}]}`},
+		"manifest data source with a dollar":       {manifest: `{"files": [{"match": "*.csv", "dataSource": "$bank"}]}`},
+		"sidecar currency symbol":                  {sidecar: `{"currency": "€"}`},
+		"manifest currency name":                   {manifest: `{"files": [{"match": "*.csv", "currency": "euro"}]}`},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			filePath := filepath.Join(tmpDir, "export.csv")
+			if err := os.WriteFile(filePath, []byte("placeholder"), 0o644); err != nil {
+				t.Fatalf("failed to write test CSV file: %v", err)
+			}
+			if tt.manifest != "" {
+				if err := os.WriteFile(filepath.Join(tmpDir, ManifestFile), []byte(tt.manifest), 0o644); err != nil {
+					t.Fatalf("failed to write manifest: %v", err)
+				}
+			}
+			if tt.sidecar != "" {
+				if err := os.WriteFile(filePath+SidecarSuffix, []byte(tt.sidecar), 0o644); err != nil {
+					t.Fatalf("failed to write sidecar: %v", err)
+				}
+			}
+			fileInfo, err := os.Stat(filePath)
+			if err != nil {
+				t.Fatalf("failed to get file info: %v", err)
+			}
+
+			mockRepo := &mockRepository{}
+			processor := NewCSVFileProcessor(
+				mockRepo,
+				&mockInfoExtractor{info: &datasource.SourceInfo{DataSource: "chase", AccountID: "1234"}},
+				&mockCSVParser{records: []map[string]string{
+					{"posting date": "01/31/2023", "description": "COFFEE", "amount": "-4.50"},
+				}},
+				tmpDir,
+				"",
+				false,
+				NewStats(),
+				*slog.New(slog.NewTextHandler(io.Discard, nil)),
+			)
+
+			err = processor.processFile(context.Background(), newMockDirEntry(fileInfo))
+			if !errors.Is(err, errInvalidMetadata) {
+				t.Errorf("Expected an invalid metadata error, got %v", err)
+			}
+			if len(mockRepo.transactions) != 0 {
+				t.Errorf("Expected nothing to be upserted, got %d transactions", len(mockRepo.transactions))
+			}
+		})
+	}
+}
+
+func TestIngestCSVFile_RejectsUnknownMetadataProfile(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "export.csv")
+	if err := os.WriteFile(filePath, []byte("placeholder"), 0o644); err != nil {
+		t.Fatalf("failed to write test CSV file: %v", err)
+	}
+	if err := os.WriteFile(filePath+SidecarSuffix, []byte(`{"profile": "missing"}`), 0o644); err != nil {
+		t.Fatalf("failed to write sidecar: %v", err)
+	}
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to get file info: %v", err)
+	}
+
+	processor := NewCSVFileProcessor(
+		&mockRepository{},
+		&mockInfoExtractor{info: &datasource.SourceInfo{DataSource: "chase", AccountID: "1234"}},
+		&mockCSVParser{},
+		tmpDir,
+		"",
+		false,
+		NewStats(),
+		*slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+
+	if err = processor.processFile(ctx, newMockDirEntry(fileInfo)); !errors.Is(err, errUnknownProfile) {
+		t.Errorf("Expected an unknown profile error, got %v", err)
+	}
+}
+
+func TestProcessFile_RegistersAccounts(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "export.csv")
+	if err := os.WriteFile(filePath, []byte("placeholder"), 0o644); err != nil {
+		t.Fatalf("failed to write test CSV file: %v", err)
+	}
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to get file info: %v", err)
+	}
+
+	newProcessor := func(accounts *mockAccountRepository, repo *mockRepository) *CSVFileProcessor {
+		processor := NewCSVFileProcessor(
+			repo,
+			&mockInfoExtractor{info: &datasource.SourceInfo{DataSource: "generic", AccountID: "1234"}},
+			&mockCSVParser{records: []map[string]string{
+				{"posting date": "01/31/2023", "description": "Coffee", "amount": "4.50"},
+			}},
+			tmpDir,
+			"",
+			false,
+			NewStats(),
+			*slog.New(slog.NewTextHandler(io.Discard, nil)),
+		)
+		processor.Accounts = accounts
+		return processor
+	}
+
+	// An unknown account is registered and its amounts read as signed.
+	accounts := &mockAccountRepository{}
+	repo := &mockRepository{}
+	if err = newProcessor(accounts, repo).processFile(ctx, newMockDirEntry(fileInfo)); err != nil {
+		t.Fatalf("processFile failed: %v", err)
+	}
+	if len(accounts.accounts) != 1 || !accounts.accounts[0].AutoRegistered || accounts.accounts[0].AccountID != "1234" {
+		t.Errorf("Expected the account to be auto-registered, got %+v", accounts.accounts)
+	}
+	if got := repo.transactions[0].Amount; got != money.New(450, "") {
+		t.Errorf("Expected a signed amount of 4.50, got %v", got)
+	}
+
+	// A credit card's charges are positive in the export and negated.
+	accounts.accounts[0].Type = model.AccountCreditCard
+	repo = &mockRepository{}
+	if err = newProcessor(accounts, repo).processFile(ctx, newMockDirEntry(fileInfo)); err != nil {
+		t.Fatalf("processFile failed: %v", err)
+	}
+	if got := repo.transactions[0].Amount; got != money.New(-450, "") {
+		t.Errorf("Expected a credit card charge of -4.50, got %v", got)
+	}
+
+	// Unregistered accounts fail when registration is required.
+	processor := newProcessor(&mockAccountRepository{}, &mockRepository{})
+	processor.RequireRegisteredAccounts = true
+	if err = processor.processFile(ctx, newMockDirEntry(fileInfo)); !errors.Is(err, errUnregisteredAccount) {
+		t.Errorf("Expected an unregistered account error, got %v", err)
+	}
+}
+
+func TestProcessFile_ResolvesAccountAliases(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "transactions.csv")
+	if err := os.WriteFile(filePath, []byte("placeholder"), 0o644); err != nil {
+		t.Fatalf("failed to write test CSV file: %v", err)
+	}
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to get file info: %v", err)
+	}
+
+	// The file names no account, so the masked card number in its rows identifies it.
+	accounts := &mockAccountRepository{accounts: []model.Account{
+		{DataSource: "capitalone", AccountID: "venture-sam", Aliases: []string{"*5678"}, Type: model.AccountCreditCard},
+		{DataSource: "capitalone", AccountID: "venture-alex", Aliases: []string{"*1234"}, Type: model.AccountCreditCard},
+	}}
+	mockRepo := &mockRepository{}
+	processor := NewCSVFileProcessor(
+		mockRepo,
+		&mockInfoExtractor{info: &datasource.SourceInfo{DataSource: "capitalone", AccountID: datasource.UnknownAccountID, AccountUnknown: true}},
+		&mockCSVParser{records: []map[string]string{
+			{"posted date": "01/31/2023", "card no.": "XXXX-XXXX-5678", "description": "Coffee", "debit": "4.50"},
+		}},
+		tmpDir,
+		"",
+		false,
+		NewStats(),
+		*slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	processor.Accounts = accounts
+	processor.Mappings = &mapping.Config{
+		Default: mapping.DefaultProfile(),
+		Sources: map[string]mapping.Profile{
+			"capitalone": {Columns: map[string][]string{mapping.FieldPostingDate: {"posted date"}}},
+		},
+	}
+
+	if err = processor.processFile(ctx, newMockDirEntry(fileInfo)); err != nil {
+		t.Fatalf("processFile failed: %v", err)
+	}
+	if len(accounts.accounts) != 2 {
+		t.Errorf("Expected no account to be registered, got %+v", accounts.accounts)
+	}
+	if got := mockRepo.transactions[0]; got.AccountID != "venture-sam" || got.Amount != money.New(-450, "") {
+		t.Errorf("Expected the transaction under the canonical account venture-sam, got %+v", got)
+	}
+}
+
+func TestProcessFile_UnknownAccount(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "export.csv")
+	if err := os.WriteFile(filePath, []byte("placeholder"), 0o644); err != nil {
+		t.Fatalf("failed to write test CSV file: %v", err)
+	}
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to get file info: %v", err)
+	}
+
+	process := func(info datasource.SourceInfo) (*mockAccountRepository, *mockRepository, error) {
+		t.Helper()
+		accounts, mockRepo := &mockAccountRepository{}, &mockRepository{}
+		processor := NewCSVFileProcessor(
+			mockRepo,
+			&mockInfoExtractor{info: &info},
+			&mockCSVParser{records: []map[string]string{
+				{"posting date": "01/31/2023", "description": "Coffee", "amount": "-4.50"},
+			}},
+			tmpDir,
+			"",
+			false,
+			NewStats(),
+			*slog.New(slog.NewTextHandler(io.Discard, nil)),
+		)
+		processor.Accounts = accounts
+		processor.Mappings = &mapping.Config{Default: mapping.DefaultProfile()}
+		return accounts, mockRepo, processor.processFile(ctx, newMockDirEntry(fileInfo))
+	}
+
+	// A file nothing names the account of is refused, and no placeholder account registered.
+	accounts, mockRepo, err := process(datasource.SourceInfo{
+		DataSource: "generic", AccountID: datasource.UnknownAccountID, AccountUnknown: true,
+	})
+	if !errors.Is(err, errUnknownAccount) {
+		t.Errorf("Expected an unknown account error, got %v", err)
+	}
+	if len(accounts.accounts) != 0 || len(mockRepo.transactions) != 0 {
+		t.Errorf("Expected nothing to be stored, got %+v and %+v", accounts.accounts, mockRepo.transactions)
+	}
+
+	// An account that happens to be 0000 is an account, not a gap to fill from the rows.
+	if _, mockRepo, err = process(datasource.SourceInfo{DataSource: "generic", AccountID: "0000"}); err != nil {
+		t.Fatalf("processFile failed: %v", err)
+	}
+	if got := mockRepo.transactions[0].AccountID; got != "0000" {
+		t.Errorf("Expected the transaction under account 0000, got %s", got)
+	}
+}
+
+func TestProcessFile_AutoRegisteredAccountMatchesOtherMasks(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "transactions.csv")
+	if err := os.WriteFile(filePath, []byte("placeholder"), 0o644); err != nil {
+		t.Fatalf("failed to write test CSV file: %v", err)
+	}
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to get file info: %v", err)
+	}
+
+	accounts := &mockAccountRepository{}
+	mockRepo := &mockRepository{}
+	process := func(cardNumber string) {
+		t.Helper()
+		processor := NewCSVFileProcessor(
+			mockRepo,
+			&mockInfoExtractor{info: &datasource.SourceInfo{DataSource: "capitalone", AccountID: datasource.UnknownAccountID, AccountUnknown: true}},
+			&mockCSVParser{records: []map[string]string{
+				{"posted date": "01/31/2023", "card no.": cardNumber, "description": "Coffee", "debit": "4.50"},
+			}},
+			tmpDir,
+			"",
+			false,
+			NewStats(),
+			*slog.New(slog.NewTextHandler(io.Discard, nil)),
+		)
+		processor.Accounts = accounts
+		processor.Mappings = &mapping.Config{
+			Default: mapping.DefaultProfile(),
+			Sources: map[string]mapping.Profile{
+				"capitalone": {Columns: map[string][]string{mapping.FieldPostingDate: {"posted date"}}},
+			},
+		}
+		if processErr := processor.processFile(ctx, newMockDirEntry(fileInfo)); processErr != nil {
+			t.Fatalf("processFile failed: %v", processErr)
+		}
+	}
+
+	// The first file registers the card; the second masks it differently.
+	process("XXXX-XXXX-1234")
+	process("****1234")
+
+	if len(accounts.accounts) != 1 || !slices.Equal(accounts.accounts[0].Aliases, []string{"*1234"}) {
+		t.Fatalf("Expected one account with the alias *1234, got %+v", accounts.accounts)
+	}
+	if len(mockRepo.transactions) != 2 || mockRepo.transactions[1].AccountID != "XXXX-XXXX-1234" {
+		t.Errorf("Expected both files under account XXXX-XXXX-1234, got %+v", mockRepo.transactions)
+	}
 }
@@ -0,0 +1,154 @@
+package datasource
+
+import (
+	"regexp"
+	"strings"
+
+	"babylon/dataloader/datalake/mapping"
+)
+
+// Priorities of the built-in profiles. Banks are tried before the synthetic test data source.
+const (
+	BankPriority      = 100
+	SyntheticPriority = 10
+)
+
+// filenamePattern matches any of a bank's names, not run into other words, optionally
+// followed directly by the account: four or more digits, which may be masked, e.g.
+// chase1234.csv, chase123456789.csv or chasexxxx1234.csv. Letters that directly follow the
+// digits and end at a separator are part of the account, as in chase1234sav.csv, but a word
+// that runs into more digits, such as a date, is not: chase1234activity20230131.csv is 1234.
+func filenamePattern(names ...string) *regexp.Regexp {
+	return regexp.MustCompile(`(?:^|[^a-z])(?:` + strings.Join(names, "|") + `)` +
+		`(?:((?:[x*]+)?\d{4,}[a-z]*)(?:[^a-z\d]|$)|((?:[x*]+)?\d{4,})[a-z]|[^a-z]|$)`)
+}
+
+// BankProfiles returns the built-in bank profiles, with the layouts of each bank's CSV exports.
+func BankProfiles() []BankProfile {
+	return []BankProfile{
+		{
+			DataSource:       Chase,
+			Priority:         BankPriority,
+			FilenamePatterns: []*regexp.Regexp{filenamePattern("chase")},
+			HeaderSignatures: [][]string{
+				{"details", "posting date", "description", "amount", "type", "balance", "check or slip #"},
+				{"transaction date", "post date", "description", "category", "type", "amount", "memo"},
+			},
+			Institutions: []string{"chase"},
+			FIDs:         []string{"10898"},
+			BICs:         []string{"CHAS"},
+			// The default mapping is Chase's. Card and checking exports alike are signed.
+			Mapping: mapping.Profile{AmountSign: mapping.SignSigned},
+		},
+		{
+			DataSource:       BankOfAmerica,
+			Priority:         BankPriority,
+			FilenamePatterns: []*regexp.Regexp{filenamePattern("bankofamerica", "bank of america", "bofa")},
+			HeaderSignatures: [][]string{
+				{"date", "description", "amount", "running bal."},
+				{"posted date", "reference number", "payee", "address", "amount"},
+			},
+			Institutions: []string{"bankofamerica"},
+			FIDs:         []string{"5959"},
+			BICs:         []string{"BOFA"},
+			Mapping: mapping.Profile{
+				Columns: map[string][]string{
+					mapping.FieldPostingDate: {"date", "posted date"},
+					mapping.FieldDescription: {"description", "payee"},
+					mapping.FieldBalance:     {"running bal."},
+					mapping.FieldExternalID:  {"reference number"},
+				},
+				AmountSign: mapping.SignSigned,
+			},
+		},
+		{
+			DataSource:       Amex,
+			Priority:         BankPriority,
+			FilenamePatterns: []*regexp.Regexp{filenamePattern("amex", "american express", "americanexpress")},
+			HeaderSignatures: [][]string{
+				{"date", "description", "card member", "account #", "amount"},
+			},
+			Institutions: []string{"americanexpress", "amex"},
+			FIDs:         []string{"3101"},
+			BICs:         []string{"AEIB"},
+			Mapping: mapping.Profile{
+				Columns: map[string][]string{
+					mapping.FieldPostingDate: {"date"},
+					mapping.FieldExternalID:  {"reference"},
+				},
+				AmountSign: mapping.SignInverted,
+			},
+		},
+		{
+			// Wells Fargo exports have no header row, so they have no header signature. Their
+			// columns are the date, amount, an unused "*", the check number and the description.
+			DataSource:       WellsFargo,
+			Priority:         BankPriority,
+			FilenamePatterns: []*regexp.Regexp{filenamePattern("wellsfargo", "wells fargo", "wells_fargo")},
+			Header:           []string{"date", "amount", "*", "check number", "description"},
+			Institutions:     []string{"wellsfargo"},
+			FIDs:             []string{"3000"},
+			BICs:             []string{"WFBI"},
+			Mapping: mapping.Profile{
+				Columns: map[string][]string{
+					mapping.FieldPostingDate:    {"date"},
+					mapping.FieldCheckOrSlipNum: {"check number"},
+				},
+				AmountSign: mapping.SignSigned,
+			},
+		},
+		{
+			DataSource:       CapitalOne,
+			Priority:         BankPriority,
+			FilenamePatterns: []*regexp.Regexp{filenamePattern("capitalone", "capital one", "capital_one")},
+			HeaderSignatures: [][]string{
+				{"transaction date", "posted date", "card no.", "description", "category", "debit", "credit"},
+			},
+			Institutions: []string{"capitalone"},
+			BICs:         []string{"HIBK"},
+			Mapping: mapping.Profile{
+				Columns: map[string][]string{
+					mapping.FieldPostingDate: {"posted date", "transaction date"},
+				},
+				DateLayouts: []string{mapping.ISODateLayout, mapping.DefaultDateLayout},
+			},
+		},
+		{
+			DataSource:       Citi,
+			Priority:         BankPriority,
+			FilenamePatterns: []*regexp.Regexp{filenamePattern("citibank", "citi")},
+			HeaderSignatures: [][]string{
+				{"status", "date", "description", "debit", "credit"},
+			},
+			Institutions: []string{"citibank", "citigroup", "citicards"},
+			FIDs:         []string{"24909"},
+			BICs:         []string{"CITI"},
+			Mapping: mapping.Profile{
+				Columns: map[string][]string{
+					mapping.FieldPostingDate: {"date"},
+				},
+			},
+		},
+		{
+			DataSource:       Discover,
+			Priority:         BankPriority,
+			FilenamePatterns: []*regexp.Regexp{filenamePattern("discover")},
+			HeaderSignatures: [][]string{
+				{"trans. date", "post date", "description", "amount", "category"},
+			},
+			Institutions: []string{"discover"},
+			FIDs:         []string{"7101"},
+			Mapping: mapping.Profile{
+				Columns: map[string][]string{
+					mapping.FieldPostingDate: {"post date", "trans. date"},
+				},
+				AmountSign: mapping.SignInverted,
+			},
+		},
+		{
+			DataSource:       Synthetic,
+			Priority:         SyntheticPriority,
+			FilenamePatterns: []*regexp.Regexp{regexp.MustCompile(`synthetic`)},
+		},
+	}
+}
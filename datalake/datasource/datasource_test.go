@@ -2,9 +2,12 @@ package datasource_test
 
 import (
 	"errors"
+	"math"
+	"regexp"
 	"testing"
 
 	"babylon/dataloader/datalake/datasource"
+	"babylon/dataloader/datalake/mapping"
 )
 
 func TestGenericExtractor_NewGenericExtractor(t *testing.T) {
@@ -66,3 +69,235 @@ func TestGenericExtractor_ExtractInfo_NoMatch(t *testing.T) {
 		})
 	}
 }
+
+func TestRegistry_ExtractInfo(t *testing.T) {
+	registry := datasource.DefaultRegistry()
+	tests := []struct {
+		filename    string
+		expectedDS  datasource.DataSource
+		expectedAcc string
+	}{
+		{"Chase1234_Activity_20230131.CSV", datasource.Chase, "1234"},
+		{"chase.csv", datasource.Chase, "0000"},
+		{"chase123456789.csv", datasource.Chase, "123456789"},
+		{"chasexxxx5678.csv", datasource.Chase, "xxxx5678"},
+		{"chase1234sav.csv", datasource.Chase, "1234sav"},
+		{"chase1234activity20230131.csv", datasource.Chase, "1234"},
+		{"chase1234_activity_20230131.csv", datasource.Chase, "1234"},
+		{"chase12345678 statement 2023-01-31.csv", datasource.Chase, "12345678"},
+		{"chase1234sav-20230131.csv", datasource.Chase, "1234sav"},
+		{"chasexxxx5678export2023.csv", datasource.Chase, "xxxx5678"},
+		{"chase_2023.csv", datasource.Chase, "0000"},
+		{"BofA5678.csv", datasource.BankOfAmerica, "5678"},
+		{"Bank of America stmt.csv", datasource.BankOfAmerica, "0000"},
+		{"amex_activity.csv", datasource.Amex, "0000"},
+		{"WellsFargo9012.csv", datasource.WellsFargo, "9012"},
+		{"capital_one_2023.csv", datasource.CapitalOne, "0000"},
+		{"citi4321.csv", datasource.Citi, "4321"},
+		{"Discover-Statement.csv", datasource.Discover, "0000"},
+		{"test-synthetic-data.csv", datasource.Synthetic, "0000"},
+		{"cities.csv", datasource.Generic, "0000"},
+		{"somefile.csv", datasource.Generic, "0000"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			info, err := registry.ExtractInfo(test.filename)
+			if err != nil {
+				t.Fatalf("ExtractInfo(%s) returned an unexpected error: %v", test.filename, err)
+			}
+			if info.DataSource != string(test.expectedDS) {
+				t.Errorf("ExtractInfo(%s) DataSource got %s, want %s", test.filename, info.DataSource, test.expectedDS)
+			}
+			if info.AccountID != test.expectedAcc {
+				t.Errorf("ExtractInfo(%s) AccountID got %s, want %s", test.filename, info.AccountID, test.expectedAcc)
+			}
+		})
+	}
+}
+
+func TestRegistry_ExtractInfo_UnknownAccount(t *testing.T) {
+	registry := datasource.DefaultRegistry()
+	tests := map[string]bool{
+		"chase.csv":     true,
+		"somefile.csv":  true,
+		"chase0000.csv": false,
+		"chase1234.csv": false,
+	}
+
+	for filename, unknown := range tests {
+		t.Run(filename, func(t *testing.T) {
+			info, err := registry.ExtractInfo(filename)
+			if err != nil {
+				t.Fatalf("ExtractInfo(%s) returned an unexpected error: %v", filename, err)
+			}
+			// An account that is 0000 is told apart from the placeholder for none.
+			if info.AccountUnknown != unknown {
+				t.Errorf("ExtractInfo(%s) AccountUnknown got %v, want %v", filename, info.AccountUnknown, unknown)
+			}
+		})
+	}
+}
+
+func TestRegistry_PriorityOrder(t *testing.T) {
+	registry := datasource.NewRegistry()
+	registry.Register(datasource.BankProfile{
+		DataSource:       datasource.Synthetic,
+		Priority:         datasource.SyntheticPriority,
+		FilenamePatterns: []*regexp.Regexp{regexp.MustCompile(`export`)},
+	})
+	registry.Register(datasource.BankProfile{
+		DataSource:       datasource.Chase,
+		Priority:         datasource.BankPriority,
+		FilenamePatterns: []*regexp.Regexp{regexp.MustCompile(`export(\d{4})`)},
+	})
+
+	info, err := registry.ExtractInfo("export1234.csv")
+	if err != nil {
+		t.Fatalf("ExtractInfo returned an unexpected error: %v", err)
+	}
+	if info.DataSource != string(datasource.Chase) || info.AccountID != "1234" {
+		t.Errorf("Expected the higher priority profile to match first, got %+v", info)
+	}
+	if profiles := registry.Profiles(); profiles[0].DataSource != datasource.Chase {
+		t.Errorf("Expected profiles in priority order, got %v first", profiles[0].DataSource)
+	}
+}
+
+func TestBankProfile_MatchHeaders(t *testing.T) {
+	profiles := make(map[datasource.DataSource]datasource.BankProfile)
+	for _, profile := range datasource.BankProfiles() {
+		profiles[profile.DataSource] = profile
+	}
+
+	capitalOne := []string{"Transaction Date", "Posted Date", "Card No.", "Description", "Category", "Debit", "Credit"}
+	if !profiles[datasource.CapitalOne].MatchHeaders(capitalOne) {
+		t.Error("Expected Capital One's header row to match its signature")
+	}
+	if profiles[datasource.Citi].MatchHeaders(capitalOne) {
+		t.Error("Expected Capital One's header row not to match Citi's signature")
+	}
+	if profiles[datasource.WellsFargo].MatchHeaders(capitalOne) {
+		t.Error("Expected a profile without signatures to match no headers")
+	}
+}
+
+func TestRegistry_MatchInstitution(t *testing.T) {
+	tests := map[string]struct {
+		org  string
+		fid  string
+		want datasource.DataSource
+	}{
+		"org name":          {"JPMorgan Chase Bank, N.A.", "", datasource.Chase},
+		"fid over org code": {"B1", "10898", datasource.Chase},
+		"org with spaces":   {"Wells Fargo Bank", "", datasource.WellsFargo},
+		"unknown fid":       {"Bank of America", "99999", datasource.BankOfAmerica},
+		"unknown bank":      {"First Community Credit Union", "1234", ""},
+		"no institution":    {"", "", ""},
+	}
+
+	registry := datasource.DefaultRegistry()
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			profile, ok := registry.MatchInstitution(tt.org, tt.fid)
+			if ok != (tt.want != "") || profile.DataSource != tt.want {
+				t.Errorf("Expected %q, got %q (matched %v)", tt.want, profile.DataSource, ok)
+			}
+		})
+	}
+}
+
+func TestRegistry_MatchBIC(t *testing.T) {
+	tests := map[string]datasource.DataSource{
+		"CHASUS33":    datasource.Chase,
+		"bofaus3n":    datasource.BankOfAmerica,
+		"CITIUS33XXX": datasource.Citi,
+		"DEUTDEFF":    "",
+		"CHA":         "",
+	}
+
+	registry := datasource.DefaultRegistry()
+	for bic, want := range tests {
+		profile, ok := registry.MatchBIC(bic)
+		if ok != (want != "") || profile.DataSource != want {
+			t.Errorf("Expected BIC %s to be %q, got %q (matched %v)", bic, want, profile.DataSource, ok)
+		}
+	}
+}
+
+func TestRegistry_MappingsValidate(t *testing.T) {
+	mappings := datasource.DefaultRegistry().Mappings()
+	if err := mapping.Default().WithDefaults(mappings).Validate(); err != nil {
+		t.Fatalf("Expected the built-in bank mappings to validate, got %v", err)
+	}
+	if sign := mapping.Default().WithDefaults(mappings).Resolve(string(datasource.Amex)).AmountSign; sign != mapping.SignInverted {
+		t.Errorf("Expected Amex amounts to be inverted, got %q", sign)
+	}
+}
+
+func TestRegistry_Detect(t *testing.T) {
+	registry := datasource.DefaultRegistry()
+	capitalOne := func(postedDate string, debit string) map[string]string {
+		return map[string]string{
+			"transaction date": "2023-01-30", "posted date": postedDate, "card no.": "1234",
+			"description": "Coffee", "category": "Dining", "debit": debit, "credit": "",
+		}
+	}
+
+	tests := []struct {
+		name       string
+		sample     datasource.Sample
+		expectedDS datasource.DataSource
+		confidence float64
+		detected   bool
+	}{
+		{
+			name:       "full signature and readable values",
+			sample:     datasource.Sample{Rows: []map[string]string{capitalOne("2023-01-31", "4.50")}},
+			expectedDS: datasource.CapitalOne,
+			confidence: 1,
+			detected:   true,
+		},
+		{
+			name: "unreadable values",
+			sample: datasource.Sample{Rows: []map[string]string{
+				capitalOne("2023-01-31", "4.50"),
+				capitalOne("not a date", "4.50"),
+			}},
+			expectedDS: datasource.CapitalOne,
+			confidence: 0.875,
+			detected:   true,
+		},
+		{
+			name: "partial signature",
+			sample: datasource.Sample{Rows: []map[string]string{
+				{"status": "Cleared", "date": "01/31/2023", "description": "Coffee", "debit": "4.50"},
+			}},
+			expectedDS: datasource.Citi,
+			confidence: 0.8,
+			detected:   true,
+		},
+		{
+			name: "unknown layout",
+			sample: datasource.Sample{Rows: []map[string]string{
+				{"date": "01/31/2023", "description": "Coffee", "amount": "-4.50"},
+			}},
+			expectedDS: datasource.BankOfAmerica,
+			confidence: 0.75,
+			detected:   false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			detection, detected := registry.Detect(test.sample)
+			if detection.DataSource != test.expectedDS || detected != test.detected {
+				t.Errorf("Detect got %s (detected %t), want %s (detected %t)",
+					detection.DataSource, detected, test.expectedDS, test.detected)
+			}
+			if math.Abs(detection.Confidence-test.confidence) > 1e-9 {
+				t.Errorf("Detect confidence got %v, want %v", detection.Confidence, test.confidence)
+			}
+		})
+	}
+}
@@ -8,6 +8,22 @@ const (
 	Generic DataSource = "generic"
 	// Chase represents the Chase data source.
 	Chase DataSource = "chase"
+	// BankOfAmerica represents the Bank of America data source.
+	BankOfAmerica DataSource = "bankofamerica"
+	// Amex represents the American Express data source.
+	Amex DataSource = "amex"
+	// WellsFargo represents the Wells Fargo data source.
+	WellsFargo DataSource = "wellsfargo"
+	// CapitalOne represents the Capital One data source.
+	CapitalOne DataSource = "capitalone"
+	// Citi represents the Citi data source.
+	Citi DataSource = "citi"
+	// Discover represents the Discover data source.
+	Discover DataSource = "discover"
 	// Synthetic represents a synthetic data source.
 	Synthetic DataSource = "synthetic"
 )
+
+// UnknownAccountID is the account ID given to files whose name does not carry one, with
+// SourceInfo.AccountUnknown set. It is never stored as an account.
+const UnknownAccountID = "0000"
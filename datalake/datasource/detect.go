@@ -0,0 +1,105 @@
+package datasource
+
+import (
+	"slices"
+	"strings"
+
+	"babylon/dataloader/datalake/mapping"
+)
+
+// MinConfidence is the lowest confidence at which a detection identifies a file.
+const MinConfidence = 0.8
+
+// Share of a detection's confidence that rests on the header row rather than the sample values.
+const headerWeight = 0.75
+
+// Sample is the start of a file: its first rows, keyed by lowercased header.
+type Sample struct {
+	Rows []map[string]string
+}
+
+// Headers returns the sample's columns, sorted.
+func (s Sample) Headers() []string {
+	var headers []string
+	for _, row := range s.Rows {
+		for header := range row {
+			if !slices.Contains(headers, header) {
+				headers = append(headers, header)
+			}
+		}
+	}
+	slices.Sort(headers)
+	return headers
+}
+
+// Detection is a data source identified from a file's contents.
+type Detection struct {
+	DataSource DataSource `json:"dataSource"`
+	// Confidence, from 0 to 1, is the share of the best matching header signature the file
+	// has, lowered when its sample values do not read as the bank's dates and amounts.
+	Confidence float64 `json:"confidence"`
+}
+
+// ContentDetector identifies a file's data source from a sample of its contents.
+type ContentDetector interface {
+	// Detect returns the most likely data source and whether it reaches MinConfidence.
+	Detect(sample Sample) (Detection, bool)
+}
+
+// Confidence scores how well a sample fits the profile's export layouts, from 0 to 1.
+func (p BankProfile) Confidence(sample Sample) float64 {
+	headers := sample.Headers()
+	var best float64
+	for _, signature := range p.HeaderSignatures {
+		if len(signature) == 0 {
+			continue
+		}
+		present := 0
+		for _, column := range signature {
+			if slices.Contains(headers, strings.ToLower(column)) {
+				present++
+			}
+		}
+		best = max(best, float64(present)/float64(len(signature)))
+	}
+	if best == 0 {
+		return 0
+	}
+	return best * (headerWeight + (1-headerWeight)*p.readableShare(sample))
+}
+
+// readableShare is the share of the sample's rows whose posting date and amount the profile's
+// mapping reads. A sample without rows is taken to be readable.
+func (p BankProfile) readableShare(sample Sample) float64 {
+	if len(sample.Rows) == 0 {
+		return 1
+	}
+	source := string(p.DataSource)
+	profile := mapping.Default().
+		WithDefaults(map[string]mapping.Profile{source: p.Mapping}).
+		Resolve(source)
+
+	readable := 0
+	for _, row := range sample.Rows {
+		if _, err := profile.ParseDate(profile.Value(row, mapping.FieldPostingDate)); err != nil {
+			continue
+		}
+		if _, err := profile.Amount(row, profile.Value(row, mapping.FieldCurrency)); err != nil {
+			continue
+		}
+		readable++
+	}
+	return float64(readable) / float64(len(sample.Rows))
+}
+
+// Detect scores the sample against every registered profile and returns the best match.
+// Of equally confident profiles, the one tried first by ExtractInfo wins.
+func (r *Registry) Detect(sample Sample) (Detection, bool) {
+	var best Detection
+	for _, profile := range r.profiles {
+		if confidence := profile.Confidence(sample); confidence > best.Confidence {
+			best = Detection{DataSource: profile.DataSource, Confidence: confidence}
+		}
+	}
+	return best, best.Confidence >= MinConfidence
+}
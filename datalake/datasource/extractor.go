@@ -8,6 +8,18 @@ import (
 type SourceInfo struct {
 	DataSource string
 	AccountID  string
+	// AccountUnknown is set when nothing named the file's account. AccountID then holds
+	// UnknownAccountID, which is a placeholder rather than an account.
+	AccountUnknown bool
+}
+
+// newSourceInfo returns the SourceInfo of a file from dataSource, whose account is unknown
+// when accountID is empty.
+func newSourceInfo(dataSource DataSource, accountID string) *SourceInfo {
+	if accountID == "" {
+		return &SourceInfo{DataSource: string(dataSource), AccountID: UnknownAccountID, AccountUnknown: true}
+	}
+	return &SourceInfo{DataSource: string(dataSource), AccountID: accountID}
 }
 
 // InfoExtractor defines the interface for extracting source information from a filename.
@@ -1,41 +1,28 @@
 package datasource
 
-import (
-	"regexp"
-	"strings"
-)
-
-// GenericExtractor provides a fallback for generic filenames.
-type GenericExtractor struct{}
+// GenericExtractor recognises Chase and synthetic filenames, and fails on any other.
+//
+// Deprecated: Use DefaultRegistry, which recognises more banks and falls back to Generic.
+type GenericExtractor struct {
+	registry *Registry
+}
 
 // NewGenericExtractor creates a new GenericExtractor.
 func NewGenericExtractor() *GenericExtractor {
-	return &GenericExtractor{}
+	registry := NewRegistry()
+	for _, profile := range BankProfiles() {
+		if profile.DataSource == Chase || profile.DataSource == Synthetic {
+			registry.Register(profile)
+		}
+	}
+	return &GenericExtractor{registry: registry}
 }
 
 // ExtractInfo extracts data source and account ID from generic filenames.
 func (e *GenericExtractor) ExtractInfo(filename string) (*SourceInfo, error) {
-	lowerFileName := strings.ToLower(filename)
-
-	if strings.Contains(lowerFileName, "chase") {
-		// Use a regular expression to find the 4-digit account number after "chase"
-		re := regexp.MustCompile(`chase(\d{4})`)
-		matches := re.FindStringSubmatch(lowerFileName)
-
-		if len(matches) > 1 {
-			return &SourceInfo{
-				DataSource: string(Chase),
-				AccountID:  matches[1],
-			}, nil
-		}
+	profile, accountID, ok := e.registry.Match(filename)
+	if !ok {
+		return nil, ErrUnableToExtractInfo
 	}
-
-	if strings.Contains(lowerFileName, "synthetic") {
-		return &SourceInfo{
-			DataSource: string(Synthetic),
-			AccountID:  "0000", // Assign a default account ID for synthetic files
-		}, nil
-	}
-
-	return nil, ErrUnableToExtractInfo
+	return newSourceInfo(profile.DataSource, accountID), nil
 }
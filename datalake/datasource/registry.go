@@ -0,0 +1,199 @@
+package datasource
+
+import (
+	"cmp"
+	"regexp"
+	"slices"
+	"strings"
+
+	"babylon/dataloader/datalake/mapping"
+)
+
+// BankProfile describes how a bank's exports are recognised and read.
+type BankProfile struct {
+	// DataSource is the data source the bank's files are stored under.
+	DataSource DataSource
+	// Priority orders the profiles a Registry tries; higher priorities are tried first.
+	Priority int
+	// FilenamePatterns match the lowercased filename. A pattern's first non-empty submatch,
+	// when it matches, is the account ID.
+	FilenamePatterns []*regexp.Regexp
+	// HeaderSignatures are the lowercased header rows of the bank's export layouts.
+	HeaderSignatures [][]string
+	// Header names, in order, the columns of exports that have no header row.
+	Header []string
+	// Institutions are the names the bank goes by in the FI organisation of its OFX files,
+	// lowercased and without spaces or punctuation. An organisation containing one of them
+	// is the bank's, e.g. "JPMorgan Chase Bank, N.A." contains "chase".
+	Institutions []string
+	// FIDs are the bank's OFX financial institution IDs.
+	FIDs []string
+	// BICs are the four-letter bank codes that begin the bank's BICs, e.g. "CHAS".
+	BICs []string
+	// Mapping is layered beneath the data source's profile from the mapping file.
+	Mapping mapping.Profile
+}
+
+// MatchFilename reports whether the filename looks like one of the bank's exports, and the
+// account ID it carries, if any. The account ID is the first non-empty group captured by
+// the pattern that matched.
+func (p BankProfile) MatchFilename(filename string) (string, bool) {
+	lowerFileName := strings.ToLower(filename)
+	for _, pattern := range p.FilenamePatterns {
+		matches := pattern.FindStringSubmatch(lowerFileName)
+		if matches == nil {
+			continue
+		}
+		for _, group := range matches[1:] {
+			if group != "" {
+				return group, true
+			}
+		}
+		return "", true
+	}
+	return "", false
+}
+
+// MatchHeaders reports whether a header row contains every column of one of the bank's
+// header signatures. Headers are compared case-insensitively.
+func (p BankProfile) MatchHeaders(headers []string) bool {
+	lowered := make([]string, 0, len(headers))
+	for _, header := range headers {
+		lowered = append(lowered, strings.ToLower(strings.TrimSpace(header)))
+	}
+	for _, signature := range p.HeaderSignatures {
+		if len(signature) > 0 && !slices.ContainsFunc(signature, func(column string) bool {
+			return !slices.Contains(lowered, column)
+		}) {
+			return true
+		}
+	}
+	return false
+}
+
+// Registry is an InfoExtractor that tries its bank profiles in priority order, and falls
+// back to the Generic data source when none of them recognises a filename.
+type Registry struct {
+	profiles []BankProfile
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// DefaultRegistry creates a Registry holding BankProfiles.
+func DefaultRegistry() *Registry {
+	registry := NewRegistry()
+	for _, profile := range BankProfiles() {
+		registry.Register(profile)
+	}
+	return registry
+}
+
+// Register adds a profile. Profiles of equal priority are tried in the order they were registered.
+func (r *Registry) Register(profile BankProfile) {
+	r.profiles = append(r.profiles, profile)
+	slices.SortStableFunc(r.profiles, func(a BankProfile, b BankProfile) int {
+		return cmp.Compare(b.Priority, a.Priority)
+	})
+}
+
+// Profiles returns the registered profiles in the order they are tried.
+func (r *Registry) Profiles() []BankProfile {
+	return slices.Clone(r.profiles)
+}
+
+// Match returns the first profile, in priority order, whose filename patterns match, and
+// the account ID the filename carries, which is empty when it carries none.
+func (r *Registry) Match(filename string) (BankProfile, string, bool) {
+	for _, profile := range r.profiles {
+		if accountID, ok := profile.MatchFilename(filename); ok {
+			return profile, accountID, true
+		}
+	}
+	return BankProfile{}, "", false
+}
+
+// MatchInstitution returns the first profile, in priority order, that an OFX file's FI
+// organisation and ID belong to. A profile that knows the FID is preferred over one whose
+// name the organisation contains, as some banks write a code such as "B1" as their ORG.
+func (r *Registry) MatchInstitution(org string, fid string) (BankProfile, bool) {
+	fid = strings.TrimSpace(fid)
+	for _, profile := range r.profiles {
+		if fid != "" && slices.Contains(profile.FIDs, fid) {
+			return profile, true
+		}
+	}
+	key := institutionKey(org)
+	for _, profile := range r.profiles {
+		if key != "" && slices.ContainsFunc(profile.Institutions, func(name string) bool {
+			return strings.Contains(key, name)
+		}) {
+			return profile, true
+		}
+	}
+	return BankProfile{}, false
+}
+
+// MatchBIC returns the first profile, in priority order, whose bank codes begin bic.
+func (r *Registry) MatchBIC(bic string) (BankProfile, bool) {
+	const bankCodeLength = 4
+	bic = strings.ToUpper(strings.TrimSpace(bic))
+	if len(bic) < bankCodeLength {
+		return BankProfile{}, false
+	}
+	for _, profile := range r.profiles {
+		if slices.Contains(profile.BICs, bic[:bankCodeLength]) {
+			return profile, true
+		}
+	}
+	return BankProfile{}, false
+}
+
+// institutionKey lowercases an organisation name and drops everything but letters and digits,
+// e.g. "Bank of America, N.A." to "bankofamericana".
+func institutionKey(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		default:
+			return -1
+		}
+	}, strings.ToLower(name))
+}
+
+// ExtractInfo identifies a file's data source and account by its name. Files no profile
+// recognises belong to the Generic data source.
+func (r *Registry) ExtractInfo(filename string) (*SourceInfo, error) {
+	profile, accountID, ok := r.Match(filename)
+	if !ok {
+		return newSourceInfo(Generic, ""), nil
+	}
+	return newSourceInfo(profile.DataSource, accountID), nil
+}
+
+// Mappings returns each registered data source's mapping defaults, for mapping.Config.WithDefaults.
+// When two profiles share a data source, the one tried first wins.
+func (r *Registry) Mappings() map[string]mapping.Profile {
+	mappings := make(map[string]mapping.Profile, len(r.profiles))
+	for _, profile := range r.profiles {
+		if _, ok := mappings[string(profile.DataSource)]; !ok {
+			mappings[string(profile.DataSource)] = profile.Mapping
+		}
+	}
+	return mappings
+}
+
+// Headers returns the column names of each registered data source whose exports have no
+// header row, for csvparser.DefaultParser.Headers.
+func (r *Registry) Headers() map[string][]string {
+	headers := make(map[string][]string)
+	for _, profile := range r.profiles {
+		if _, ok := headers[string(profile.DataSource)]; !ok && len(profile.Header) > 0 {
+			headers[string(profile.DataSource)] = profile.Header
+		}
+	}
+	return headers
+}
@@ -0,0 +1,170 @@
+// Package fx converts transaction amounts to a single reporting currency using a table of daily rates.
+package fx
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"babylon/dataloader/money"
+)
+
+// DateLayout is the layout of the dates in a rate file.
+const DateLayout = "2006-01-02"
+
+// DefaultReportingCurrency is the currency amounts are converted to when none is configured.
+const DefaultReportingCurrency = "USD"
+
+// DefaultMaxAge is how old the latest rate before a date may be and still be used,
+// so that weekends and bank holidays without a fixing are covered.
+const DefaultMaxAge = 7 * 24 * time.Hour
+
+var (
+	errInvalidRates = errors.New("invalid FX rate file")
+	errNoRate       = errors.New("no FX rate")
+)
+
+// InvalidRatesError is returned when a rate file cannot be read.
+func InvalidRatesError(path string, line int, reason string) error {
+	return fmt.Errorf("%w %s, line %d: %s", errInvalidRates, path, line, reason)
+}
+
+// NoRateError is returned when the table holds no recent enough rate for a currency.
+func NoRateError(currency string, date time.Time) error {
+	return fmt.Errorf("%w for %s on %s", errNoRate, currency, date.Format(DateLayout))
+}
+
+// Table holds daily rates from other currencies to the reporting currency.
+type Table struct {
+	// Reporting is the ISO 4217 code of the currency amounts are converted to.
+	Reporting string
+	// MaxAge is how old the latest rate before a date may be and still be used.
+	MaxAge time.Duration
+	// rates holds each currency's rates, sorted by date.
+	rates map[string][]dailyRate
+}
+
+// dailyRate is the number of reporting currency units one unit of a currency bought on a date.
+type dailyRate struct {
+	date time.Time
+	rate *big.Rat
+	text string
+}
+
+// NewTable returns an empty table converting to the reporting currency.
+func NewTable(reporting string) *Table {
+	return &Table{
+		Reporting: strings.ToUpper(reporting),
+		MaxAge:    DefaultMaxAge,
+		rates:     make(map[string][]dailyRate),
+	}
+}
+
+// Load reads a CSV file of daily rates with the header date,currency,rate, e.g.
+// 2023-01-31,EUR,1.0856 for one euro buying 1.0856 units of the reporting currency.
+func Load(path string, reporting string) (*Table, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open FX rate file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, InvalidRatesError(path, 1, err.Error())
+	}
+	if !slices.Equal(lower(header), []string{"date", "currency", "rate"}) {
+		return nil, InvalidRatesError(path, 1, fmt.Sprintf("expected header date,currency,rate, got %s",
+			strings.Join(header, ",")))
+	}
+
+	table := NewTable(reporting)
+	for {
+		record, readErr := reader.Read()
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if readErr != nil {
+			return nil, InvalidRatesError(path, line, readErr.Error())
+		}
+
+		date, dateErr := time.Parse(DateLayout, record[0])
+		if dateErr != nil {
+			return nil, InvalidRatesError(path, line, fmt.Sprintf("date %q is not %s", record[0], DateLayout))
+		}
+		if addErr := table.Add(record[1], date, record[2]); addErr != nil {
+			return nil, InvalidRatesError(path, line, addErr.Error())
+		}
+	}
+
+	return table, nil
+}
+
+// Add records the rate of currency on date. The rate is a decimal number of reporting
+// currency units per unit of currency.
+func (t *Table) Add(currency string, date time.Time, rate string) error {
+	parsed, ok := new(big.Rat).SetString(strings.TrimSpace(rate))
+	if !ok || parsed.Sign() <= 0 {
+		return fmt.Errorf("rate %q is not a positive decimal number", rate)
+	}
+	code := strings.ToUpper(strings.TrimSpace(currency))
+	if len(code) != 3 {
+		return fmt.Errorf("currency %q is not an ISO 4217 code", currency)
+	}
+
+	// Keep the rates sorted by date; a later rate for the same date replaces the earlier one.
+	entry := dailyRate{date: date, rate: parsed, text: strings.TrimSpace(rate)}
+	rates := t.rates[code]
+	i, found := slices.BinarySearchFunc(rates, date, func(r dailyRate, d time.Time) int {
+		return r.date.Compare(d)
+	})
+	if found {
+		rates[i] = entry
+	} else {
+		t.rates[code] = slices.Insert(rates, i, entry)
+	}
+	return nil
+}
+
+// Convert returns amount in the reporting currency at the latest rate on or before date,
+// along with the rate used. Amounts without a currency are taken to be in the reporting currency.
+func (t *Table) Convert(amount money.Money, date time.Time) (money.Money, string, error) {
+	if amount.Currency == "" || amount.Currency == t.Reporting {
+		return amount.Convert(big.NewRat(1, 1), t.Reporting), "1", nil
+	}
+
+	rates := t.rates[amount.Currency]
+	// Find the first rate after date; the one before it is the latest on or before date.
+	i, _ := slices.BinarySearchFunc(rates, date, func(r dailyRate, d time.Time) int {
+		if r.date.After(d) {
+			return 1
+		}
+		return -1
+	})
+	if i == 0 || date.Sub(rates[i-1].date) > t.MaxAge {
+		return money.Money{}, "", NoRateError(amount.Currency, date)
+	}
+
+	rate := rates[i-1]
+	return amount.Convert(rate.rate, t.Reporting), rate.text, nil
+}
+
+// lower lowercases and trims each value, dropping a leading byte order mark.
+func lower(values []string) []string {
+	lowered := make([]string, len(values))
+	for i, value := range values {
+		lowered[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(value, "\ufeff")))
+	}
+	return lowered
+}
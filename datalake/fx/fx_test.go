@@ -0,0 +1,98 @@
+package fx_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"babylon/dataloader/datalake/fx"
+	"babylon/dataloader/money"
+)
+
+// writeRates writes a rate file to a temporary directory.
+func writeRates(t *testing.T, content string) string {
+	filePath := filepath.Join(t.TempDir(), "rates.csv")
+	if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write rate file: %v", err)
+	}
+	return filePath
+}
+
+func date(value string) time.Time {
+	parsed, err := time.Parse(fx.DateLayout, value)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+func TestLoad_Convert(t *testing.T) {
+	table, err := fx.Load(writeRates(t, `Date,Currency,Rate
+2023-01-31,EUR,1.0856
+2023-01-27,EUR,1.0870
+2023-01-31,jpy,0.0077
+2023-01-31,GBP,1.2334
+`), "usd")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	tests := []struct {
+		amount   money.Money
+		date     string
+		expected string
+		rate     string
+	}{
+		{money.New(-7577, "EUR"), "2023-01-31", "-82.26 USD", "1.0856"},
+		// A weekend uses the latest rate before it.
+		{money.New(-7577, "EUR"), "2023-01-29", "-82.36 USD", "1.0870"},
+		{money.New(1200, "JPY"), "2023-01-31", "9.24 USD", "0.0077"},
+		{money.New(-7577, "USD"), "2023-01-31", "-75.77 USD", "1"},
+		// Amounts without a currency are already in the reporting currency.
+		{money.New(-7577, ""), "2023-01-31", "-75.77 USD", "1"},
+	}
+	for _, tt := range tests {
+		got, rate, convErr := table.Convert(tt.amount, date(tt.date))
+		if convErr != nil {
+			t.Errorf("Convert(%s, %s) failed: %v", tt.amount, tt.date, convErr)
+			continue
+		}
+		if got.String() != tt.expected || rate != tt.rate {
+			t.Errorf("Convert(%s, %s): expected %s at %s, got %s at %s",
+				tt.amount, tt.date, tt.expected, tt.rate, got, rate)
+		}
+	}
+
+	for _, tt := range []struct {
+		amount money.Money
+		date   string
+	}{
+		{money.New(100, "EUR"), "2023-01-26"},
+		{money.New(100, "EUR"), "2023-02-08"},
+		{money.New(100, "CHF"), "2023-01-31"},
+	} {
+		if _, _, convErr := table.Convert(tt.amount, date(tt.date)); convErr == nil {
+			t.Errorf("Expected no rate for %s on %s", tt.amount, tt.date)
+		}
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"wrong header":  "day,ccy,fx\n2023-01-31,EUR,1.08\n",
+		"bad date":      "date,currency,rate\n31.01.2023,EUR,1.08\n",
+		"bad rate":      "date,currency,rate\n2023-01-31,EUR,abc\n",
+		"negative rate": "date,currency,rate\n2023-01-31,EUR,-1\n",
+		"bad currency":  "date,currency,rate\n2023-01-31,EURO,1.08\n",
+		"missing field": "date,currency,rate\n2023-01-31,EUR\n",
+		"empty file":    "",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := fx.Load(writeRates(t, content), fx.DefaultReportingCurrency); err == nil {
+				t.Error("Expected Load to fail")
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package datalake
+
+import (
+	"babylon/dataloader/datalake/model"
+)
+
+// transactionIDs derives each transaction's ID from its content, so that loading a file
+// again upserts the same documents. Identical transactions within a file, such as two equal
+// purchases on one day, are told apart by the order they appear in.
+type transactionIDs struct {
+	// seen counts the transactions assigned an ID so far, by content key.
+	seen map[string]int
+}
+
+func newTransactionIDs() *transactionIDs {
+	return &transactionIDs{seen: make(map[string]int)}
+}
+
+// assign sets the TransactionID of each transaction, in file order.
+func (ids *transactionIDs) assign(transactions []model.Transaction) {
+	for i := range transactions {
+		key := model.ContentKey(transactions[i])
+		occurrence := ids.seen[key]
+		ids.seen[key]++
+		transactions[i].TransactionID = model.NewTransactionID(key, occurrence)
+	}
+}
@@ -0,0 +1,169 @@
+package datalake
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	csvparser "babylon/dataloader/csv"
+	"babylon/dataloader/datalake/model"
+)
+
+var (
+	errSourceNotFound = errors.New("source file not found")
+	errSourceChanged  = errors.New("source file has changed since it was ingested")
+	errRowUnavailable = errors.New("raw row not available")
+)
+
+// lineFormats are the extensions of the formats whose records each start on a line of their
+// own. The line of an OFX, camt or MT940 record is one tag of it, and an XLSX file is a zip
+// archive, so their raw rows cannot be read back from the file.
+var lineFormats = map[string]bool{
+	".csv":       true,
+	qifExtension: true,
+}
+
+// QIF markers that bound an entry: the extension, section headers and the entry's end.
+const (
+	qifExtension = ".qif"
+	qifHeader    = "!"
+	qifEntryEnd  = "^"
+)
+
+// SourceNotFoundError is returned when a transaction's source file is in none of the searched directories.
+func SourceNotFoundError(file string, dirs []string) error {
+	return fmt.Errorf("%w, %s in %v", errSourceNotFound, file, dirs)
+}
+
+// SourceChangedError is returned when a source file no longer hashes to its lineage's FileHash.
+func SourceChangedError(filePath string) error {
+	return fmt.Errorf("%w, %s", errSourceChanged, filePath)
+}
+
+// RowUnavailableError is returned when a source file's format is not line-oriented.
+func RowUnavailableError(file string) error {
+	return fmt.Errorf("%w, %s is not a line-oriented format", errRowUnavailable, file)
+}
+
+// newRunID returns an ID for an ingest run that sorts by the time the run started.
+func newRunID(start time.Time) string {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return start.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+}
+
+// hashFile returns the hex SHA-256 of a file's contents.
+func hashFile(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to hash file %s: %w", filePath, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// SourceRow finds the file a transaction was read from in dirs, and returns its path and the
+// text of its row: the line the row starts on, or for QIF the whole entry up to its ^. The
+// file must be unchanged since it was ingested, and in one of the lineFormats. Its text is
+// decoded to UTF-8 the way the CSV parser decodes it.
+func SourceRow(lineage model.Lineage, dirs ...string) (string, string, error) {
+	ext := strings.ToLower(filepath.Ext(lineage.SourceFile))
+	if !lineFormats[ext] {
+		return "", "", RowUnavailableError(lineage.SourceFile)
+	}
+	for _, dir := range dirs {
+		filePath := filepath.Join(dir, filepath.Base(lineage.SourceFile))
+		if _, err := os.Stat(filePath); err != nil {
+			continue
+		}
+
+		hash, err := hashFile(filePath)
+		if err != nil {
+			return "", "", err
+		}
+		if hash != lineage.FileHash {
+			return filePath, "", SourceChangedError(filePath)
+		}
+
+		row, err := readRow(filePath, lineage.Line, ext == qifExtension)
+		if err != nil {
+			return filePath, "", err
+		}
+		return filePath, row, nil
+	}
+	return "", "", SourceNotFoundError(lineage.SourceFile, dirs)
+}
+
+// readRow returns the text of a file's 1-based line. With toEntryEnd set, it returns the
+// non-blank lines from there up to and including the QIF entry's closing ^, or up to the
+// next section or the end of the file for an entry left open.
+func readRow(filePath string, line int64, toEntryEnd bool) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	decoded, err := csvparser.NewDecoder(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file %s: %w", filePath, err)
+	}
+
+	reader := bufio.NewReader(decoded)
+	var entry []string
+	for current := int64(1); ; current++ {
+		text, readErr := reader.ReadString('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return "", fmt.Errorf("failed to read file %s: %w", filePath, readErr)
+		}
+		atEOF := readErr != nil
+		if atEOF && text == "" {
+			if len(entry) > 0 {
+				return strings.Join(entry, "\n"), nil
+			}
+			return "", fmt.Errorf("file %s has no line %d", filePath, line)
+		}
+		if current < line {
+			continue
+		}
+
+		text = trimLineEnding(text)
+		if !toEntryEnd {
+			return text, nil
+		}
+		trimmed := strings.TrimSpace(text)
+		if len(entry) > 0 && strings.HasPrefix(trimmed, qifHeader) {
+			return strings.Join(entry, "\n"), nil
+		}
+		if trimmed != "" {
+			entry = append(entry, text)
+		}
+		if trimmed == qifEntryEnd || atEOF {
+			return strings.Join(entry, "\n"), nil
+		}
+	}
+}
+
+// trimLineEnding drops a trailing \n or \r\n.
+func trimLineEnding(text string) string {
+	if n := len(text); n > 0 && text[n-1] == '\n' {
+		text = text[:n-1]
+	}
+	if n := len(text); n > 0 && text[n-1] == '\r' {
+		text = text[:n-1]
+	}
+	return text
+}
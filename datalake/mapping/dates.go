@@ -0,0 +1,141 @@
+package mapping
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+var errAmbiguousDates = errors.New("ambiguous dates")
+
+// AmbiguousDatesError is returned when a file's dates can be read with two layouts that
+// give different days, e.g. 01/02/2006 and 02/01/2006, and no date rules either out.
+func AmbiguousDatesError(layout string, other string) error {
+	return fmt.Errorf("%w, dates match both %q and %q: declare only one for the data source",
+		errAmbiguousDates, layout, other)
+}
+
+// location returns the time zone dates are read in.
+func (p Profile) location() *time.Location {
+	if p.loc != nil {
+		return p.loc
+	}
+	// validate has already checked the time zone exists.
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// ParseDate parses value with each of the profile's date layouts in turn. The result is in
+// the profile's time zone.
+func (p Profile) ParseDate(value string) (time.Time, error) {
+	loc := p.location()
+	var firstErr error
+	for _, layout := range p.DateLayouts {
+		parsed, err := time.ParseInLocation(layout, value, loc)
+		if err == nil {
+			return parsed.In(loc), nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return time.Time{}, fmt.Errorf("date %q does not match any layout: %w", value, firstErr)
+}
+
+// layoutPair is two date layouts that read some dates as different days.
+type layoutPair struct {
+	layout, other string
+	// layoutOnly and otherOnly record that a date matched one layout but not the other.
+	layoutOnly, otherOnly bool
+	// conflict records that a date matched both layouts as different days.
+	conflict bool
+}
+
+// ambiguousPairs returns the pairs of the profile's layouts that read some dates as
+// different days. A date whose day and month are both 12 or less is formatted with each
+// layout and parsed with the other.
+func (p Profile) ambiguousPairs() []layoutPair {
+	reference := time.Date(2006, time.January, 2, 0, 0, 0, 0, time.UTC)
+	readsDifferently := func(layout string, other string) bool {
+		parsed, err := time.Parse(other, reference.Format(layout))
+		return err == nil && !sameDay(parsed, reference)
+	}
+
+	var pairs []layoutPair
+	for i, layout := range p.DateLayouts {
+		for _, other := range p.DateLayouts[i+1:] {
+			if readsDifferently(layout, other) || readsDifferently(other, layout) {
+				pairs = append(pairs, layoutPair{layout: layout, other: other})
+			}
+		}
+	}
+	return pairs
+}
+
+// HasAmbiguousLayouts reports whether two of the profile's layouts read some dates as
+// different days, so a file's dates must be examined to tell which one it uses.
+func (p Profile) HasAmbiguousLayouts() bool {
+	return len(p.ambiguousPairs()) > 0
+}
+
+// DateDetector works out which of a profile's ambiguous layouts a file uses from its dates.
+type DateDetector struct {
+	profile Profile
+	pairs   []layoutPair
+}
+
+// NewDateDetector returns a detector for the profile's ambiguous layouts.
+func (p Profile) NewDateDetector() *DateDetector {
+	return &DateDetector{profile: p, pairs: p.ambiguousPairs()}
+}
+
+// Observe records one of the file's dates.
+func (d *DateDetector) Observe(value string) {
+	loc := d.profile.location()
+	for i := range d.pairs {
+		pair := &d.pairs[i]
+		first, firstErr := time.ParseInLocation(pair.layout, value, loc)
+		second, secondErr := time.ParseInLocation(pair.other, value, loc)
+		switch {
+		case firstErr == nil && secondErr != nil:
+			pair.layoutOnly = true
+		case firstErr != nil && secondErr == nil:
+			pair.otherOnly = true
+		case firstErr == nil && !sameDay(first, second):
+			pair.conflict = true
+		}
+	}
+}
+
+// Resolve returns the profile without the layouts the file's dates ruled out. It fails when
+// the dates fit two layouts that read them as different days and none of them tells which.
+func (d *DateDetector) Resolve() (Profile, error) {
+	ruledOut := make(map[string]bool)
+	for _, pair := range d.pairs {
+		switch {
+		case pair.layoutOnly && !pair.otherOnly:
+			ruledOut[pair.other] = true
+		case pair.otherOnly && !pair.layoutOnly:
+			ruledOut[pair.layout] = true
+		case pair.conflict:
+			return d.profile, AmbiguousDatesError(pair.layout, pair.other)
+		}
+	}
+
+	resolved := d.profile
+	resolved.DateLayouts = slices.DeleteFunc(slices.Clone(d.profile.DateLayouts), func(layout string) bool {
+		return ruledOut[layout]
+	})
+	return resolved, nil
+}
+
+// sameDay reports whether two times fall on the same calendar day.
+func sameDay(a time.Time, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
@@ -0,0 +1,559 @@
+// Package mapping describes how the columns of a bank export map onto model.Transaction fields.
+package mapping
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"babylon/dataloader/money"
+)
+
+// Transaction fields a profile can populate.
+const (
+	FieldDetails        = "details"
+	FieldPostingDate    = "postingDate"
+	FieldDescription    = "description"
+	FieldAmount         = "amount"
+	FieldCategory       = "category"
+	FieldType           = "type"
+	FieldBalance        = "balance"
+	FieldCheckOrSlipNum = "checkOrSlipNum"
+	FieldExternalID     = "externalID"
+	FieldMemo           = "memo"
+	FieldValueDate      = "valueDate"
+	FieldCurrency       = "currency"
+	FieldEndToEndID     = "endToEndID"
+	FieldStatementID    = "statementID"
+	FieldDebit          = "debit"
+	FieldCredit         = "credit"
+	// FieldAccount is the account a row belongs to, as a full or masked account number. It
+	// identifies the file's account when neither the filename nor a sidecar does.
+	FieldAccount = "account"
+)
+
+// Sign conventions of a source's amount column.
+const (
+	// SignSigned amounts are negative for money out of the account. It is the default.
+	SignSigned = "signed"
+	// SignInverted amounts are positive for money out, as credit card exports often report
+	// charges, and are negated. Amounts marked DR, CR or with parentheses are not.
+	SignInverted = "inverted"
+)
+
+// DefaultDateLayout is the layout posting dates are stored in.
+const DefaultDateLayout = "01/02/2006"
+
+// ISODateLayout is the layout statement parsers such as OFX emit posting dates in.
+const ISODateLayout = "2006-01-02"
+
+// ISODateTimeLayout is the layout spreadsheet date cells with a time of day are read as.
+const ISODateTimeLayout = "2006-01-02T15:04:05"
+
+var (
+	errInvalidMapping = errors.New("invalid mapping")
+	errUnknownField   = errors.New("unknown transaction field")
+	errMissingAmount  = errors.New("missing amount")
+	errYAMLMapping    = errors.New("mapping files are JSON; YAML is not supported")
+)
+
+// YAMLMappingError is returned when the mapping file is a YAML file.
+func YAMLMappingError(path string) error {
+	return fmt.Errorf("%w, convert %s to JSON", errYAMLMapping, path)
+}
+
+// InvalidMappingError is returned when a data source's profile fails validation.
+func InvalidMappingError(source string, cause error) error {
+	return fmt.Errorf("%w for %s: %w", errInvalidMapping, source, cause)
+}
+
+// MissingAmountError is returned when a row has neither an amount nor a debit or credit.
+func MissingAmountError() error {
+	return fmt.Errorf("%w, no amount, debit or credit value", errMissingAmount)
+}
+
+// UnknownFieldError is returned when a mapping refers to a field model.Transaction does not have.
+func UnknownFieldError(field string) error {
+	return fmt.Errorf("%w, %s", errUnknownField, field)
+}
+
+// Profile declares how one data source's rows are mapped to transactions.
+type Profile struct {
+	// Columns maps each transaction field to the header aliases it may be read from, in priority order.
+	Columns map[string][]string `json:"columns,omitempty"`
+	// DateLayouts are the Go time layouts tried, in order, when parsing the posting date.
+	DateLayouts []string `json:"dateLayouts,omitempty"`
+	// Timezone is the IANA time zone dates without an offset are read in, and dates with
+	// one are converted to before taking their calendar day. Defaults to UTC.
+	Timezone string `json:"timezone,omitempty"`
+	// Locale is the BCP 47 tag, e.g. de-DE, whose number format amounts are written in.
+	// Defaults to money.DefaultLocale.
+	Locale string `json:"locale,omitempty"`
+	// AmountSign is the sign convention of the amount column, SignSigned or SignInverted.
+	// Amounts read from debit and credit columns are negative and positive whatever their sign.
+	AmountSign string `json:"amountSign,omitempty"`
+	// RawColumns names the columns kept in each transaction's raw sub-document. All columns
+	// are kept when it is unset, and none when it is an empty list.
+	RawColumns []string `json:"rawColumns,omitempty"`
+	// Defaults supplies a value for a field when none of its columns hold one.
+	Defaults map[string]string `json:"defaults,omitempty"`
+	// ErrorBudget bounds how many of a file's rows may be rejected before the file fails.
+	ErrorBudget ErrorBudget `json:"errorBudget,omitempty"`
+
+	// loc is Timezone loaded by normalized.
+	loc *time.Location
+}
+
+// ErrorBudget bounds the rows of a file that may be rejected. A nil limit is not enforced.
+type ErrorBudget struct {
+	// MaxRows is the largest number of rejected rows a file may have.
+	MaxRows *int `json:"maxRows,omitempty"`
+	// MaxPercent is the largest share of a file's rows, from 0 to 100, that may be rejected.
+	MaxPercent *float64 `json:"maxPercent,omitempty"`
+}
+
+// Config holds the mapping profile of every configured data source.
+type Config struct {
+	// Default is used for data sources without a profile, and fills the gaps in those with one.
+	Default Profile `json:"default"`
+	// Sources holds per-data-source profiles keyed by datasource.DataSource.
+	Sources map[string]Profile `json:"sources,omitempty"`
+}
+
+// fields lists every field a profile may declare.
+func fields() []string {
+	return []string{
+		FieldDetails,
+		FieldPostingDate,
+		FieldDescription,
+		FieldAmount,
+		FieldCategory,
+		FieldType,
+		FieldBalance,
+		FieldCheckOrSlipNum,
+		FieldExternalID,
+		FieldMemo,
+		FieldValueDate,
+		FieldCurrency,
+		FieldEndToEndID,
+		FieldStatementID,
+		FieldDebit,
+		FieldCredit,
+		FieldAccount,
+	}
+}
+
+// DefaultProfile returns the mapping for the column names used by Chase-style exports.
+func DefaultProfile() Profile {
+	return Profile{
+		Columns: map[string][]string{
+			FieldDetails:        {"details"},
+			FieldPostingDate:    {"post date", "posting date"},
+			FieldDescription:    {"description"},
+			FieldAmount:         {"amount"},
+			FieldCategory:       {"category"},
+			FieldType:           {"type"},
+			FieldBalance:        {"balance"},
+			FieldCheckOrSlipNum: {"check or slip #"},
+			FieldExternalID:     {"fitid", "entry reference"},
+			FieldMemo:           {"memo"},
+			FieldValueDate:      {"value date"},
+			FieldCurrency:       {"currency"},
+			FieldEndToEndID:     {"end to end id"},
+			FieldStatementID:    {"statement id"},
+			FieldDebit:          {"debit", "debit amount"},
+			FieldCredit:         {"credit", "credit amount"},
+			FieldAccount:        {"account #", "account number", "card no."},
+		},
+		DateLayouts: []string{DefaultDateLayout, ISODateLayout, ISODateTimeLayout},
+	}
+}
+
+// Default returns a Config that maps every data source with DefaultProfile.
+func Default() *Config {
+	return &Config{Default: DefaultProfile()}
+}
+
+// Load reads a JSON mapping file, layers it over the built-in defaults and validates the result.
+// A .yaml or .yml file is refused with a YAMLMappingError rather than misread as JSON.
+func Load(path string) (*Config, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return nil, YAMLMappingError(path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mapping file %s: %w", path, err)
+	}
+
+	var file Config
+	if err = json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to decode mapping file %s: %w", path, err)
+	}
+
+	cfg := &Config{
+		Default: file.Default.over(DefaultProfile()),
+		Sources: file.Sources,
+	}
+	if err = cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Validate checks every profile after it has been layered over the default.
+func (c *Config) Validate() error {
+	if err := c.Default.validate(); err != nil {
+		return InvalidMappingError("default", err)
+	}
+	for source := range c.Sources {
+		if err := c.Resolve(source).validate(); err != nil {
+			return InvalidMappingError(source, err)
+		}
+	}
+	return nil
+}
+
+// Resolve returns the effective profile for a data source.
+func (c *Config) Resolve(dataSource string) Profile {
+	profile, ok := c.Sources[dataSource]
+	if !ok {
+		return c.Default.normalized()
+	}
+	return profile.over(c.Default).normalized()
+}
+
+// WithDefaults returns a copy of c with each of defaults, keyed by data source, layered
+// beneath that source's configured profile. The built-in bank profiles are applied this
+// way, so a mapping file only needs to declare where a bank's layout differs.
+func (c *Config) WithDefaults(defaults map[string]Profile) *Config {
+	layered := &Config{
+		Default: c.Default,
+		Sources: make(map[string]Profile, len(defaults)+len(c.Sources)),
+	}
+	maps.Copy(layered.Sources, defaults)
+	for source, profile := range c.Sources {
+		if base, ok := defaults[source]; ok {
+			profile = profile.over(base)
+		}
+		layered.Sources[source] = profile
+	}
+	return layered
+}
+
+// over returns p with any field it leaves unset taken from base.
+func (p Profile) over(base Profile) Profile {
+	merged := Profile{
+		Columns:     make(map[string][]string, len(base.Columns)),
+		DateLayouts: p.DateLayouts,
+		Timezone:    p.Timezone,
+		Locale:      p.Locale,
+		AmountSign:  p.AmountSign,
+		RawColumns:  p.RawColumns,
+		Defaults:    make(map[string]string, len(base.Defaults)),
+		ErrorBudget: p.ErrorBudget,
+	}
+	maps.Copy(merged.Columns, base.Columns)
+	maps.Copy(merged.Columns, p.Columns)
+	maps.Copy(merged.Defaults, base.Defaults)
+	maps.Copy(merged.Defaults, p.Defaults)
+	if len(merged.DateLayouts) == 0 {
+		merged.DateLayouts = base.DateLayouts
+	}
+	if merged.Timezone == "" {
+		merged.Timezone = base.Timezone
+	}
+	if merged.Locale == "" {
+		merged.Locale = base.Locale
+	}
+	if merged.AmountSign == "" {
+		merged.AmountSign = base.AmountSign
+	}
+	if merged.RawColumns == nil {
+		merged.RawColumns = base.RawColumns
+	}
+	if merged.ErrorBudget.MaxRows == nil {
+		merged.ErrorBudget.MaxRows = base.ErrorBudget.MaxRows
+	}
+	if merged.ErrorBudget.MaxPercent == nil {
+		merged.ErrorBudget.MaxPercent = base.ErrorBudget.MaxPercent
+	}
+	return merged
+}
+
+// Override returns p with every field overrides sets replaced by the override.
+func (p Profile) Override(overrides Profile) Profile {
+	return overrides.over(p).normalized()
+}
+
+// normalized lowercases header aliases so they match the parser's lowercased headers, and
+// loads the time zone.
+func (p Profile) normalized() Profile {
+	columns := make(map[string][]string, len(p.Columns))
+	for field, aliases := range p.Columns {
+		lowered := make([]string, 0, len(aliases))
+		for _, alias := range aliases {
+			lowered = append(lowered, strings.ToLower(strings.TrimSpace(alias)))
+		}
+		columns[field] = lowered
+	}
+	p.Columns = columns
+	if p.RawColumns != nil {
+		raw := make([]string, 0, len(p.RawColumns))
+		for _, column := range p.RawColumns {
+			raw = append(raw, strings.ToLower(strings.TrimSpace(column)))
+		}
+		p.RawColumns = raw
+	}
+	p.loc, _ = time.LoadLocation(p.Timezone)
+	return p
+}
+
+// validate checks that the profile only names known fields and can produce a posting date and amount.
+func (p Profile) validate() error {
+	if _, err := money.FormatFor(p.Locale); err != nil {
+		return err
+	}
+
+	known := fields()
+	for field := range p.Columns {
+		if !slices.Contains(known, field) {
+			return UnknownFieldError(field)
+		}
+	}
+	for field, value := range p.Defaults {
+		if !slices.Contains(known, field) {
+			return UnknownFieldError(field)
+		}
+		if field == FieldAmount || field == FieldBalance || field == FieldDebit || field == FieldCredit {
+			if _, err := p.ParseAmount(value, p.Defaults[FieldCurrency]); err != nil {
+				return fmt.Errorf("default %s: %w", field, err)
+			}
+		}
+	}
+
+	if !p.declares(FieldPostingDate) {
+		return fmt.Errorf("no column or default for required field %s", FieldPostingDate)
+	}
+	if !p.declares(FieldAmount) && !p.declares(FieldDebit) && !p.declares(FieldCredit) {
+		return fmt.Errorf("no column or default for required field %s, %s or %s", FieldAmount, FieldDebit, FieldCredit)
+	}
+	if p.AmountSign != "" && p.AmountSign != SignSigned && p.AmountSign != SignInverted {
+		return fmt.Errorf("amountSign %q is not %s or %s", p.AmountSign, SignSigned, SignInverted)
+	}
+
+	if err := p.ErrorBudget.validate(); err != nil {
+		return err
+	}
+
+	if len(p.DateLayouts) == 0 {
+		return errors.New("no date layouts declared")
+	}
+	for _, layout := range p.DateLayouts {
+		if err := ValidateDateLayout(layout); err != nil {
+			return err
+		}
+	}
+	if _, err := time.LoadLocation(p.Timezone); err != nil {
+		return fmt.Errorf("timezone %q: %w", p.Timezone, err)
+	}
+
+	return nil
+}
+
+// ValidateDateLayout checks that a Go time layout round-trips a full calendar date.
+func ValidateDateLayout(layout string) error {
+	reference := time.Date(2006, time.January, 2, 0, 0, 0, 0, time.UTC)
+	parsed, err := time.Parse(layout, reference.Format(layout))
+	if err != nil {
+		return fmt.Errorf("date layout %q cannot be parsed: %w", layout, err)
+	}
+	if y, m, d := parsed.Date(); y != reference.Year() || m != reference.Month() || d != reference.Day() {
+		return fmt.Errorf("date layout %q does not contain a full date", layout)
+	}
+	return nil
+}
+
+// RawFields returns the non-empty values of the record's columns that are kept with the
+// transaction. Column names become BSON field names, so dots and a leading $ are replaced
+// with underscores.
+func (p Profile) RawFields(record map[string]string) map[string]string {
+	raw := make(map[string]string, len(record))
+	for column, value := range record {
+		if value == "" || (p.RawColumns != nil && !slices.Contains(p.RawColumns, strings.ToLower(column))) {
+			continue
+		}
+		key := strings.ReplaceAll(column, ".", "_")
+		if strings.HasPrefix(key, "$") {
+			key = "_" + key[1:]
+		}
+		raw[key] = value
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+	return raw
+}
+
+// declares reports whether the profile has a column or default for field.
+func (p Profile) declares(field string) bool {
+	return len(p.Columns[field]) > 0 || p.Defaults[field] != ""
+}
+
+// Numeric is the set of a record's columns whose values are plain decimal numbers with a
+// '.' separator, as statement parsers and spreadsheet number cells produce them, rather than
+// text in the source's locale. Keys are the record's own column names.
+type Numeric map[string]bool
+
+// Value returns the first non-empty value among field's columns, falling back to its default.
+// Headers are matched case-insensitively.
+func (p Profile) Value(record map[string]string, field string) string {
+	value, _ := p.column(record, field)
+	return value
+}
+
+// column returns field's value like Value, and the record column it was read from, or ""
+// for a default.
+func (p Profile) column(record map[string]string, field string) (string, string) {
+	for _, alias := range p.Columns[field] {
+		if value, key := lookup(record, alias); value != "" {
+			return value, key
+		}
+	}
+	return p.Defaults[field], ""
+}
+
+// ParseAmount reads an amount written in the profile's locale, e.g. 1.234,56 € for de-DE.
+func (p Profile) ParseAmount(value string, currency string) (money.Money, error) {
+	amount, _, err := p.parseAmount(value, currency)
+	return amount, err
+}
+
+// parseAmount reads an amount like ParseAmount, and reports whether its direction was
+// marked explicitly, e.g. by a DR or CR suffix.
+func (p Profile) parseAmount(value string, currency string) (money.Money, bool, error) {
+	format, err := money.FormatFor(p.Locale)
+	if err != nil {
+		return money.Money{}, false, err
+	}
+	return money.ParseFormatted(value, currency, format)
+}
+
+// Amount reads a row's amount so that money out of the account is negative. A value in the
+// amount column follows the profile's AmountSign, unless parentheses or a DR or CR marker
+// say which way it goes. Otherwise the credit less the debit is used, so either may be left
+// empty or zero.
+func (p Profile) Amount(record map[string]string, currency string) (money.Money, error) {
+	return p.ReadAmount(record, nil, currency)
+}
+
+// ReadAmount reads a row's amount like Amount. Values in numeric columns are read as plain
+// decimals whatever the profile's locale.
+func (p Profile) ReadAmount(record map[string]string, numeric Numeric, currency string) (money.Money, error) {
+	if value, key := p.column(record, FieldAmount); value != "" {
+		amount, marked, err := p.parseColumn(value, numeric[key], currency)
+		if err != nil {
+			return money.Money{}, err
+		}
+		if p.AmountSign == SignInverted && !marked {
+			amount = amount.Neg()
+		}
+		return amount, nil
+	}
+
+	debitValue, debitKey := p.column(record, FieldDebit)
+	creditValue, creditKey := p.column(record, FieldCredit)
+	if debitValue == "" && creditValue == "" {
+		return money.Money{}, MissingAmountError()
+	}
+	amount := money.New(0, currency)
+	if creditValue != "" {
+		credit, _, err := p.parseColumn(creditValue, numeric[creditKey], currency)
+		if err != nil {
+			return money.Money{}, fmt.Errorf("credit: %w", err)
+		}
+		if amount, err = amount.Add(credit.Abs()); err != nil {
+			return money.Money{}, err
+		}
+	}
+	if debitValue != "" {
+		debit, _, err := p.parseColumn(debitValue, numeric[debitKey], currency)
+		if err != nil {
+			return money.Money{}, fmt.Errorf("debit: %w", err)
+		}
+		if amount, err = amount.Sub(debit.Abs()); err != nil {
+			return money.Money{}, err
+		}
+	}
+	return amount, nil
+}
+
+// ReadBalance reads a row's balance, if it has one, the way ReadAmount reads its amount but
+// without changing its sign.
+func (p Profile) ReadBalance(record map[string]string, numeric Numeric, currency string) (money.Money, bool, error) {
+	value, key := p.column(record, FieldBalance)
+	if value == "" {
+		return money.Money{}, false, nil
+	}
+	balance, _, err := p.parseColumn(value, numeric[key], currency)
+	return balance, true, err
+}
+
+// parseColumn reads a numeric column's value as a plain decimal, and any other in the
+// profile's locale.
+func (p Profile) parseColumn(value string, numeric bool, currency string) (money.Money, bool, error) {
+	if numeric {
+		amount, err := money.Parse(value, currency)
+		return amount, false, err
+	}
+	return p.parseAmount(value, currency)
+}
+
+// lookup finds header in record, trying an exact match before a case-insensitive one, and
+// returns its value and the record's key for it.
+func lookup(record map[string]string, header string) (string, string) {
+	if value, ok := record[header]; ok {
+		return value, header
+	}
+	for key, value := range record {
+		if strings.EqualFold(key, header) {
+			return value, key
+		}
+	}
+	return "", ""
+}
+
+// validate checks that the budget's limits are within range.
+func (b ErrorBudget) validate() error {
+	if b.MaxRows != nil && *b.MaxRows < 0 {
+		return fmt.Errorf("error budget maxRows %d is negative", *b.MaxRows)
+	}
+	if b.MaxPercent != nil && (*b.MaxPercent < 0 || *b.MaxPercent > 100) {
+		return fmt.Errorf("error budget maxPercent %g is not between 0 and 100", *b.MaxPercent)
+	}
+	return nil
+}
+
+// Enforced reports whether the budget sets any limit.
+func (b ErrorBudget) Enforced() bool {
+	return b.MaxRows != nil || b.MaxPercent != nil
+}
+
+// Exceeded reports whether rejecting rejected of total rows goes over the budget.
+func (b ErrorBudget) Exceeded(rejected int, total int) bool {
+	if b.MaxRows != nil && rejected > *b.MaxRows {
+		return true
+	}
+	if b.MaxPercent != nil && total > 0 && float64(rejected)*100/float64(total) > *b.MaxPercent {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,381 @@
+package mapping_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"babylon/dataloader/datalake/mapping"
+)
+
+// writeMappingFile writes a mapping file to a temporary directory.
+func writeMappingFile(t *testing.T, content string) string {
+	filePath := filepath.Join(t.TempDir(), "mapping.json")
+	if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write mapping file: %v", err)
+	}
+	return filePath
+}
+
+func TestDefault_ResolveUnknownSource(t *testing.T) {
+	profile := mapping.Default().Resolve("unknown")
+
+	record := map[string]string{"posting date": "01/31/2023", "amount": "-1.00", "check or slip #": "101"}
+	if got := profile.Value(record, mapping.FieldPostingDate); got != "01/31/2023" {
+		t.Errorf("Expected posting date 01/31/2023, got %q", got)
+	}
+	if got := profile.Value(record, mapping.FieldCheckOrSlipNum); got != "101" {
+		t.Errorf("Expected check number 101, got %q", got)
+	}
+	if err := mapping.Default().Validate(); err != nil {
+		t.Errorf("Expected default mapping to be valid, got %v", err)
+	}
+}
+
+func TestLoad_SourceProfileLayersOverDefault(t *testing.T) {
+	filePath := writeMappingFile(t, `{
+		"sources": {
+			"dkb": {
+				"columns": {
+					"postingDate": ["Buchungstag"],
+					"description": ["Verwendungszweck", "Auftraggeber / Begünstigter"],
+					"amount": ["Betrag (EUR)"]
+				},
+				"dateLayouts": ["02.01.2006"],
+				"defaults": {"category": "uncategorized"}
+			}
+		}
+	}`)
+
+	cfg, err := mapping.Load(filePath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	profile := cfg.Resolve("dkb")
+	record := map[string]string{
+		"buchungstag":                 "31.01.2023",
+		"verwendungszweck":            "",
+		"auftraggeber / begünstigter": "Bäckerei",
+		"betrag (eur)":                "-4.50",
+		"type":                        "DEBIT",
+	}
+
+	if got := profile.Value(record, mapping.FieldDescription); got != "Bäckerei" {
+		t.Errorf("Expected description to fall through to the second alias, got %q", got)
+	}
+	if got := profile.Value(record, mapping.FieldCategory); got != "uncategorized" {
+		t.Errorf("Expected default category, got %q", got)
+	}
+	// Fields the source does not declare are inherited from the default profile.
+	if got := profile.Value(record, mapping.FieldType); got != "DEBIT" {
+		t.Errorf("Expected inherited type column, got %q", got)
+	}
+
+	date, err := profile.ParseDate(profile.Value(record, mapping.FieldPostingDate))
+	if err != nil {
+		t.Fatalf("ParseDate failed: %v", err)
+	}
+	if !date.Equal(time.Date(2023, time.January, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected 2023-01-31, got %v", date)
+	}
+
+	// Other sources still use the default profile.
+	if _, err = cfg.Resolve("chase").ParseDate("31.01.2023"); err == nil {
+		t.Error("Expected the default profile to reject a DD.MM.YYYY date")
+	}
+}
+
+func TestWithDefaults_ConfiguredProfileLayersOverDefaults(t *testing.T) {
+	filePath := writeMappingFile(t, `{
+		"sources": {
+			"citi": {"columns": {"description": ["Merchant"]}}
+		}
+	}`)
+
+	cfg, err := mapping.Load(filePath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	cfg = cfg.WithDefaults(map[string]mapping.Profile{
+		"citi": {Columns: map[string][]string{mapping.FieldPostingDate: {"Date"}}},
+		"amex": {AmountSign: mapping.SignInverted},
+	})
+
+	record := map[string]string{"date": "01/31/2023", "merchant": "Coffee", "description": "ignored"}
+	profile := cfg.Resolve("citi")
+	if got := profile.Value(record, mapping.FieldPostingDate); got != "01/31/2023" {
+		t.Errorf("Expected the built-in posting date column, got %q", got)
+	}
+	if got := profile.Value(record, mapping.FieldDescription); got != "Coffee" {
+		t.Errorf("Expected the configured description column, got %q", got)
+	}
+	if got := cfg.Resolve("amex").AmountSign; got != mapping.SignInverted {
+		t.Errorf("Expected a source only in the defaults to use them, got sign %q", got)
+	}
+	if err = cfg.Validate(); err != nil {
+		t.Errorf("Expected the layered mapping to be valid, got %v", err)
+	}
+}
+
+func TestLoad_RefusesYAML(t *testing.T) {
+	for _, name := range []string{"mapping.yaml", "mapping.YML"} {
+		filePath := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(filePath, []byte("sources:\n  bank:\n    locale: de-DE\n"), 0o644); err != nil {
+			t.Fatalf("failed to write mapping file: %v", err)
+		}
+		_, err := mapping.Load(filePath)
+		if err == nil || err.Error() != mapping.YAMLMappingError(filePath).Error() {
+			t.Errorf("Expected %s to be refused as YAML, got %v", name, err)
+		}
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":       `{"sources": {"bank": {"columns": {"notAField": ["Memo"]}}}}`,
+		"unknown default":     `{"sources": {"bank": {"defaults": {"notAField": "x"}}}}`,
+		"non-numeric amount":  `{"sources": {"bank": {"columns": {"amount": []}, "defaults": {"amount": "abc"}}}}`,
+		"missing amount":      `{"sources": {"bank": {"columns": {"amount": [], "debit": [], "credit": []}}}}`,
+		"unknown amount sign": `{"sources": {"bank": {"amountSign": "backwards"}}}`,
+		"layout without date": `{"sources": {"bank": {"dateLayouts": ["15:04"]}}}`,
+		"negative max rows":   `{"sources": {"bank": {"errorBudget": {"maxRows": -1}}}}`,
+		"unknown timezone":    `{"sources": {"bank": {"timezone": "Mars/Olympus_Mons"}}}`,
+		"unknown locale":      `{"sources": {"bank": {"locale": "xx-YY"}}}`,
+		"percent over 100":    `{"default": {"errorBudget": {"maxPercent": 150}}}`,
+		"malformed json":      `{"sources": `,
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := mapping.Load(writeMappingFile(t, content)); err == nil {
+				t.Error("Expected Load to fail")
+			}
+		})
+	}
+}
+
+func TestLoad_ErrorBudgetLayersOverDefault(t *testing.T) {
+	filePath := writeMappingFile(t, `{
+		"default": {"errorBudget": {"maxRows": 10, "maxPercent": 5}},
+		"sources": {"dkb": {"errorBudget": {"maxPercent": 50}}}
+	}`)
+
+	cfg, err := mapping.Load(filePath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	budget := cfg.Resolve("dkb").ErrorBudget
+	if budget.MaxRows == nil || *budget.MaxRows != 10 || budget.MaxPercent == nil || *budget.MaxPercent != 50 {
+		t.Fatalf("Expected maxRows 10 from the default and maxPercent 50, got %+v", budget)
+	}
+
+	tests := []struct {
+		rejected int
+		total    int
+		exceeded bool
+	}{
+		{0, 0, false},
+		{5, 10, false},
+		{6, 10, true},
+		{10, 100, false},
+		{11, 100, true},
+	}
+	for _, tt := range tests {
+		if got := budget.Exceeded(tt.rejected, tt.total); got != tt.exceeded {
+			t.Errorf("Exceeded(%d, %d): expected %v, got %v", tt.rejected, tt.total, tt.exceeded, got)
+		}
+	}
+
+	if mapping.Default().Resolve("chase").ErrorBudget.Exceeded(100, 100) {
+		t.Error("Expected the built-in default to have no error budget")
+	}
+}
+
+func TestParseAmount_SourceLocale(t *testing.T) {
+	filePath := writeMappingFile(t, `{"sources": {"dkb": {"locale": "de-DE", "defaults": {"balance": "0,00"}}}}`)
+
+	cfg, err := mapping.Load(filePath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	amount, err := cfg.Resolve("dkb").ParseAmount("-1.234,56 €", "EUR")
+	if err != nil {
+		t.Fatalf("ParseAmount failed: %v", err)
+	}
+	if amount.String() != "-1234.56 EUR" {
+		t.Errorf("Expected -1234.56 EUR, got %s", amount)
+	}
+
+	// Other sources read amounts with the default locale.
+	amount, err = cfg.Resolve("chase").ParseAmount("(1,234.56)", "USD")
+	if err != nil {
+		t.Fatalf("ParseAmount failed: %v", err)
+	}
+	if amount.String() != "-1234.56 USD" {
+		t.Errorf("Expected -1234.56 USD, got %s", amount)
+	}
+}
+
+func TestAmount_SignConventions(t *testing.T) {
+	filePath := writeMappingFile(t, `{
+		"sources": {
+			"amex": {"amountSign": "inverted"},
+			"barclays": {"columns": {"amount": [], "debit": ["Paid out"], "credit": ["Paid in"]}}
+		}
+	}`)
+
+	cfg, err := mapping.Load(filePath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	tests := []struct {
+		source   string
+		record   map[string]string
+		expected string
+	}{
+		{"chase", map[string]string{"amount": "-45.00"}, "-45.00 USD"},
+		{"chase", map[string]string{"amount": "", "debit": "45.00", "credit": ""}, "-45.00 USD"},
+		{"chase", map[string]string{"amount": "", "debit": "-45.00", "credit": ""}, "-45.00 USD"},
+		{"amex", map[string]string{"amount": "45.00"}, "-45.00 USD"},
+		{"amex", map[string]string{"amount": "-12.00"}, "12.00 USD"},
+		// Markers say which way an amount goes, whatever the source's sign convention.
+		{"amex", map[string]string{"amount": "45.00 DR"}, "-45.00 USD"},
+		{"amex", map[string]string{"amount": "12.00 CR"}, "12.00 USD"},
+		{"amex", map[string]string{"amount": "(45.00)"}, "-45.00 USD"},
+		{"barclays", map[string]string{"paid out": "45.00", "paid in": "0.00"}, "-45.00 USD"},
+		{"barclays", map[string]string{"paid out": "", "paid in": "1,200.00"}, "1200.00 USD"},
+	}
+	for _, tt := range tests {
+		amount, amountErr := cfg.Resolve(tt.source).Amount(tt.record, "USD")
+		if amountErr != nil {
+			t.Errorf("Amount(%v) for %s failed: %v", tt.record, tt.source, amountErr)
+			continue
+		}
+		if amount.String() != tt.expected {
+			t.Errorf("Amount(%v) for %s: expected %s, got %s", tt.record, tt.source, tt.expected, amount)
+		}
+	}
+
+	if _, err = cfg.Resolve("barclays").Amount(map[string]string{"paid out": "", "paid in": ""}, "USD"); err == nil {
+		t.Error("Expected a row without an amount, debit or credit to fail")
+	}
+}
+
+func TestRawFields(t *testing.T) {
+	filePath := writeMappingFile(t, `{
+		"sources": {
+			"amex": {"rawColumns": ["Reference", "MCC"]},
+			"private": {"rawColumns": []}
+		}
+	}`)
+
+	cfg, err := mapping.Load(filePath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	record := map[string]string{
+		"date":      "01/31/2023",
+		"reference": "320230310594835620",
+		"mcc":       "5812",
+		"memo":      "",
+		"ref.no":    "A1",
+		"$type":     "card",
+	}
+
+	// Every non-empty column is kept by default.
+	raw := cfg.Resolve("chase").RawFields(record)
+	if len(raw) != 5 || raw["mcc"] != "5812" || raw["ref_no"] != "A1" || raw["_type"] != "card" {
+		t.Errorf("Expected every non-empty column with safe field names, got %v", raw)
+	}
+	if _, ok := raw["memo"]; ok {
+		t.Error("Expected empty columns to be left out")
+	}
+
+	raw = cfg.Resolve("amex").RawFields(record)
+	if len(raw) != 2 || raw["reference"] != "320230310594835620" || raw["mcc"] != "5812" {
+		t.Errorf("Expected only the reference and MCC columns, got %v", raw)
+	}
+
+	if raw = cfg.Resolve("private").RawFields(record); raw != nil {
+		t.Errorf("Expected no raw columns, got %v", raw)
+	}
+}
+
+func TestParseDate_LayoutsAndTimezone(t *testing.T) {
+	filePath := writeMappingFile(t, `{
+		"sources": {
+			"amex": {"dateLayouts": ["01/02/06", "Jan 2, 2006"]},
+			"revolut": {"dateLayouts": ["2006-01-02 15:04:05Z07:00"], "timezone": "Europe/Berlin"}
+		}
+	}`)
+
+	cfg, err := mapping.Load(filePath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	tests := []struct {
+		source   string
+		value    string
+		expected string
+	}{
+		{"amex", "01/31/23", "2023-01-31"},
+		{"amex", "Jan 31, 2023", "2023-01-31"},
+		// A UTC time late in the evening is already the next day in Berlin.
+		{"revolut", "2023-01-31 23:30:00Z", "2023-02-01"},
+		{"revolut", "2023-01-31 23:30:00+01:00", "2023-01-31"},
+	}
+	for _, tt := range tests {
+		date, parseErr := cfg.Resolve(tt.source).ParseDate(tt.value)
+		if parseErr != nil {
+			t.Errorf("ParseDate(%q) for %s failed: %v", tt.value, tt.source, parseErr)
+			continue
+		}
+		if got := date.Format(mapping.ISODateLayout); got != tt.expected {
+			t.Errorf("ParseDate(%q) for %s: expected %s, got %s", tt.value, tt.source, tt.expected, got)
+		}
+	}
+}
+
+func TestDateDetector(t *testing.T) {
+	profile := mapping.DefaultProfile()
+	profile.DateLayouts = []string{"01/02/2006", "02/01/2006", mapping.ISODateLayout}
+	if !profile.HasAmbiguousLayouts() {
+		t.Fatal("Expected MM/DD and DD/MM layouts to be ambiguous")
+	}
+	if mapping.DefaultProfile().HasAmbiguousLayouts() {
+		t.Error("Expected the default layouts not to be ambiguous")
+	}
+
+	// A day past the 12th tells the layouts apart.
+	detector := profile.NewDateDetector()
+	for _, value := range []string{"03/04/2023", "25/04/2023", "2023-04-26"} {
+		detector.Observe(value)
+	}
+	resolved, err := detector.Resolve()
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	date, err := resolved.ParseDate("03/04/2023")
+	if err != nil {
+		t.Fatalf("ParseDate failed: %v", err)
+	}
+	if !date.Equal(time.Date(2023, time.April, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected 3 April 2023 once DD/MM is detected, got %v", date)
+	}
+
+	// Without one the file could be read either way.
+	detector = profile.NewDateDetector()
+	for _, value := range []string{"03/04/2023", "12/11/2023"} {
+		detector.Observe(value)
+	}
+	if _, err = detector.Resolve(); err == nil {
+		t.Error("Expected Resolve to fail for dates that fit both MM/DD and DD/MM")
+	}
+}
@@ -0,0 +1,247 @@
+package datalake
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"babylon/dataloader/datalake/datasource"
+	"babylon/dataloader/datalake/mapping"
+)
+
+// SidecarSuffix is appended to a data file's name to name its sidecar metadata file,
+// e.g. Activity.csv.meta.json.
+const SidecarSuffix = ".meta.json"
+
+// ManifestFile is the name of the metadata file that describes every file in its directory.
+const ManifestFile = "manifest" + SidecarSuffix
+
+// dataSourcePattern matches the data source names metadata may declare. A data source
+// names its transactions collection, so it is kept to lowercase letters, digits, _ and -.
+var dataSourcePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// currencyPattern matches an ISO 4217 currency code once trimmed and uppercased.
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+var (
+	errInvalidMetadata = errors.New("invalid metadata file")
+	errUnknownProfile  = errors.New("unknown mapping profile")
+)
+
+// InvalidMetadataError is returned when a sidecar or manifest cannot be read.
+func InvalidMetadataError(path string, cause error) error {
+	return fmt.Errorf("%w %s: %w", errInvalidMetadata, path, cause)
+}
+
+// UnknownProfileError is returned when metadata names a mapping profile that is not configured.
+func UnknownProfileError(profile string) error {
+	return fmt.Errorf("%w, %s", errUnknownProfile, profile)
+}
+
+// Metadata declares what a file is, ahead of what its name and contents say. Fields left
+// empty are identified as usual or taken from the mapping.
+type Metadata struct {
+	DataSource string `json:"dataSource,omitempty"`
+	AccountID  string `json:"accountID,omitempty"`
+	// Currency is the currency of the amounts in rows without a currency column.
+	Currency string `json:"currency,omitempty"`
+	// DateLayout is the Go time layout of the file's dates, e.g. 02.01.2006.
+	DateLayout string `json:"dateLayout,omitempty"`
+	// Profile names the mapping file source whose profile reads the file, when it is not
+	// the data source's own.
+	Profile string `json:"profile,omitempty"`
+}
+
+// manifest declares the metadata of the files in a directory.
+type manifest struct {
+	// Files are matched against a file's name in order, and the first match applies.
+	Files []manifestEntry `json:"files"`
+}
+
+type manifestEntry struct {
+	// Match is a filepath.Match pattern for file names, e.g. Activity*.csv.
+	Match string `json:"match"`
+	Metadata
+}
+
+// Report whether a file in the unprocessed directory is a sidecar or manifest rather than data.
+func isMetadataFile(fileName string) bool {
+	return strings.HasSuffix(strings.ToLower(fileName), SidecarSuffix)
+}
+
+// Read the metadata declared for a file by its sidecar and its directory's manifest. The
+// sidecar's fields take precedence. It returns the sidecar's path, or "" if it has none.
+func loadMetadata(dir string, fileName string) (Metadata, string, error) {
+	var fromManifest Metadata
+	manifestPath := filepath.Join(dir, ManifestFile)
+	var listing manifest
+	found, err := readMetadataFile(manifestPath, &listing)
+	if err != nil {
+		return Metadata{}, "", err
+	}
+	if found {
+		for _, entry := range listing.Files {
+			matched, matchErr := filepath.Match(entry.Match, fileName)
+			if matchErr != nil {
+				return Metadata{}, "", InvalidMetadataError(manifestPath, matchErr)
+			}
+			if matched {
+				fromManifest = entry.normalized()
+				if err = fromManifest.validate(); err != nil {
+					return Metadata{}, "", InvalidMetadataError(manifestPath, err)
+				}
+				break
+			}
+		}
+	}
+
+	sidecarPath := filepath.Join(dir, fileName+SidecarSuffix)
+	var fromSidecar Metadata
+	found, err = readMetadataFile(sidecarPath, &fromSidecar)
+	if err != nil {
+		return Metadata{}, "", err
+	}
+	if !found {
+		return fromManifest, "", nil
+	}
+	fromSidecar = fromSidecar.normalized()
+	if err = fromSidecar.validate(); err != nil {
+		return Metadata{}, "", InvalidMetadataError(sidecarPath, err)
+	}
+	return fromSidecar.over(fromManifest), sidecarPath, nil
+}
+
+// validate checks the fields the mapping would otherwise check, so that a bad value fails
+// the file with the metadata file's name rather than surfacing as rejected rows.
+func (m Metadata) validate() error {
+	if m.DataSource != "" && !dataSourcePattern.MatchString(m.DataSource) {
+		return fmt.Errorf("dataSource %q is not lowercase letters, digits, _ and -", m.DataSource)
+	}
+	if m.Currency != "" && !currencyPattern.MatchString(m.Currency) {
+		return fmt.Errorf("currency %q is not an ISO 4217 code", m.Currency)
+	}
+	if m.DateLayout != "" {
+		if err := mapping.ValidateDateLayout(m.DateLayout); err != nil {
+			return fmt.Errorf("dateLayout: %w", err)
+		}
+	}
+	return nil
+}
+
+// Archive the metadata a file was read with as its sidecar in the processed directory. The
+// manifest stays in place for the files it has yet to describe, so the fields its entry
+// contributed are written into the archived sidecar, and the original sidecar is removed.
+func (p *CSVFileProcessor) archiveMetadata(fileName string, metadata Metadata, sidecarPath string) error {
+	if metadata == (Metadata{}) {
+		return nil
+	}
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata of %s: %w", fileName, err)
+	}
+	archivedPath := filepath.Join(p.ProcessedDir, fileName+SidecarSuffix)
+	if err = os.WriteFile(archivedPath, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write sidecar %s: %w", archivedPath, err)
+	}
+	if sidecarPath != "" {
+		if err = os.Remove(sidecarPath); err != nil {
+			return fmt.Errorf("failed to remove sidecar %s: %w", sidecarPath, err)
+		}
+	}
+	return nil
+}
+
+// Decode a metadata file into target, reporting whether it exists.
+func readMetadataFile(path string, target any) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, InvalidMetadataError(path, err)
+	}
+	if err = json.Unmarshal(data, target); err != nil {
+		return false, InvalidMetadataError(path, err)
+	}
+	return true, nil
+}
+
+// normalized returns m with its currency code trimmed and uppercased, e.g. " eur" as EUR.
+func (m Metadata) normalized() Metadata {
+	m.Currency = strings.ToUpper(strings.TrimSpace(m.Currency))
+	return m
+}
+
+// over returns m with any field it leaves empty taken from base.
+func (m Metadata) over(base Metadata) Metadata {
+	if m.DataSource == "" {
+		m.DataSource = base.DataSource
+	}
+	if m.AccountID == "" {
+		m.AccountID = base.AccountID
+	}
+	if m.Currency == "" {
+		m.Currency = base.Currency
+	}
+	if m.DateLayout == "" {
+		m.DateLayout = base.DateLayout
+	}
+	if m.Profile == "" {
+		m.Profile = base.Profile
+	}
+	return m
+}
+
+// Identify a file, taking its data source and account from its metadata where it declares
+// them, and from its name or contents otherwise.
+func (p *CSVFileProcessor) identify(
+	ctx context.Context,
+	fileName string,
+	filePath string,
+	metadata Metadata,
+) (*datasource.SourceInfo, error) {
+	if metadata.DataSource != "" && metadata.AccountID != "" {
+		return &datasource.SourceInfo{DataSource: metadata.DataSource, AccountID: metadata.AccountID}, nil
+	}
+
+	extracted, err := p.extractSourceInfo(ctx, fileName, filePath)
+	if err != nil && (metadata.DataSource == "" || !errors.Is(err, datasource.ErrUnableToExtractInfo)) {
+		return nil, err
+	}
+	sourceInfo := datasource.SourceInfo{AccountID: datasource.UnknownAccountID, AccountUnknown: true}
+	if extracted != nil {
+		sourceInfo = *extracted
+	}
+	if metadata.DataSource != "" {
+		sourceInfo.DataSource = metadata.DataSource
+	}
+	if metadata.AccountID != "" {
+		sourceInfo.AccountID, sourceInfo.AccountUnknown = metadata.AccountID, false
+	}
+	return &sourceInfo, nil
+}
+
+// Resolve the mapping profile a file is read with: the one its metadata names, or its data
+// source's, with the metadata's currency and date layout applied.
+func (p *CSVFileProcessor) metadataProfile(dataSource string, metadata Metadata) (mapping.Profile, error) {
+	if metadata.Profile != "" {
+		if _, ok := p.Mappings.Sources[metadata.Profile]; !ok {
+			return mapping.Profile{}, UnknownProfileError(metadata.Profile)
+		}
+		dataSource = metadata.Profile
+	}
+
+	var overrides mapping.Profile
+	if metadata.DateLayout != "" {
+		overrides.DateLayouts = []string{metadata.DateLayout}
+	}
+	if metadata.Currency != "" {
+		overrides.Defaults = map[string]string{mapping.FieldCurrency: metadata.Currency}
+	}
+	return p.Mappings.Resolve(dataSource).Override(overrides), nil
+}
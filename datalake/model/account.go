@@ -0,0 +1,83 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// AccountType is the kind of account a data source's files are exported from.
+type AccountType string
+
+const (
+	// AccountChecking is a current or checking account.
+	AccountChecking AccountType = "checking"
+	// AccountSavings is a savings account.
+	AccountSavings AccountType = "savings"
+	// AccountCreditCard is a credit card, whose exports often report charges as positive amounts.
+	AccountCreditCard AccountType = "credit_card"
+)
+
+// AccountTypes lists the known account types.
+func AccountTypes() []AccountType {
+	return []AccountType{AccountChecking, AccountSavings, AccountCreditCard}
+}
+
+// Account is a registered account, in the accounts collection. It is identified by its data
+// source and account ID.
+type Account struct {
+	DataSource string `bson:"dataSource"`
+	// AccountID is the canonical ID transactions are stored under.
+	AccountID string `bson:"accountID"`
+	// Aliases are the other forms the account is identified by in filenames, file contents and
+	// sidecars, such as a card's last four digits or a masked number, normalized by
+	// NormalizeAccountAlias.
+	Aliases []string `bson:"aliases,omitempty"`
+	// Name is a friendly name for the account, e.g. "Joint checking".
+	Name string `bson:"name,omitempty"`
+	// Type is the kind of account, or empty when it is not known.
+	Type        AccountType `bson:"type,omitempty"`
+	Owner       string      `bson:"owner,omitempty"`
+	Institution string      `bson:"institution,omitempty"`
+	// AutoRegistered marks accounts registered by an ingest run rather than by hand.
+	AutoRegistered bool      `bson:"autoRegistered"`
+	CreatedAt      time.Time `bson:"createdAt"`
+	UpdatedAt      time.Time `bson:"updatedAt"`
+}
+
+// NormalizeAccountAlias returns the form an account identifier is matched against aliases
+// in: lowercased, without spaces, hyphens or slashes, and with each run of mask characters
+// replaced by a single *. XXXX-XXXX-1234, ****1234 and ...1234 are all *1234. A lone x is
+// taken to be part of the identifier.
+func NormalizeAccountAlias(identifier string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' || r == '/' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(identifier)))
+
+	var normalized strings.Builder
+	runes := []rune(cleaned)
+	for i := 0; i < len(runes); {
+		end := i
+		for end < len(runes) && isMaskRune(runes[end]) {
+			end++
+		}
+		switch {
+		case end == i:
+			normalized.WriteRune(runes[i])
+			end++
+		case end-i == 1 && runes[i] == 'x':
+			normalized.WriteRune('x')
+		default:
+			normalized.WriteRune('*')
+		}
+		i = end
+	}
+	return normalized.String()
+}
+
+// isMaskRune reports whether r is used to mask the digits of account numbers.
+func isMaskRune(r rune) bool {
+	return r == 'x' || r == '*' || r == '•' || r == '.'
+}
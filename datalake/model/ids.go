@@ -0,0 +1,34 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContentKey identifies a transaction by its account and, when the institution assigns
+// one, its external ID, or otherwise by the fields a bank export repeats verbatim.
+func ContentKey(t Transaction) string {
+	fields := []string{t.DataSource, t.AccountID}
+	if t.ExternalID != "" {
+		fields = append(fields, "externalID", t.ExternalID)
+	} else {
+		fields = append(fields,
+			t.PostingDate.Format(time.DateOnly),
+			strconv.FormatInt(t.Amount.Minor, 10),
+			t.Amount.Currency,
+			t.Description,
+			t.Details,
+			t.CheckOrSlipNum,
+		)
+	}
+	return strings.Join(fields, "\x1f")
+}
+
+// NewTransactionID hashes a content key and the occurrence of that key within its file.
+func NewTransactionID(key string, occurrence int) string {
+	sum := sha256.Sum256([]byte(key + "\x1e" + strconv.Itoa(occurrence)))
+	return hex.EncodeToString(sum[:16])
+}
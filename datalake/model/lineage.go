@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// Lineage records where a stored transaction came from.
+type Lineage struct {
+	// SourceFile is the name of the file the transaction was read from.
+	SourceFile string `bson:"sourceFile"`
+	// FileHash is the hex SHA-256 of the file's contents.
+	FileHash string `bson:"fileHash"`
+	// Line is the 1-based line the transaction's row starts on in the file. For an XLSX file
+	// it is the row of the sheet.
+	Line int64 `bson:"line"`
+	// RunID identifies the ingest run that last wrote the transaction.
+	RunID string `bson:"runID"`
+	// IngestedAt is when that run read the file.
+	IngestedAt time.Time `bson:"ingestedAt"`
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+
+	"babylon/dataloader/money"
+)
+
+// Statement records the balances an account statement reported and whether the
+// transactions upserted from it account for the movement between them.
+type Statement struct {
+	// SchemaVersion is the schema version the document was written or last migrated in.
+	SchemaVersion  int      `bson:"schemaVersion"`
+	StatementID    string   `bson:"statementID"`
+	Kind           string   `bson:"kind"`
+	DataSource     string   `bson:"dataSource"`
+	AccountID      string   `bson:"accountID"`
+	SourceFile     string   `bson:"sourceFile"`
+	OpeningBalance *Balance `bson:"openingBalance,omitempty"`
+	ClosingBalance *Balance `bson:"closingBalance,omitempty"`
+	// Entries and EntriesTotal count and sum the transactions upserted from the statement.
+	Entries      int         `bson:"entries"`
+	EntriesTotal money.Money `bson:"entriesTotal"`
+	// Difference is the closing balance less the opening balance and EntriesTotal.
+	Difference   money.Money `bson:"difference"`
+	Reconciled   bool        `bson:"reconciled"`
+	ReconciledAt time.Time   `bson:"reconciledAt"`
+}
+
+// Balance is an account balance on a given date.
+type Balance struct {
+	Amount money.Money `bson:"amount"`
+	Date   string      `bson:"date"`
+}
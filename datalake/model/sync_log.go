@@ -4,7 +4,16 @@ import "time"
 
 // SyncLog represents a record in the dataSync collection.
 type SyncLog struct {
-	CollectionName  string    `bson:"collection_name"`
-	SyncTimestamp   time.Time `bson:"sync_timestamp"`
-	RecordsUploaded int64     `bson:"records_uploaded"`
+	CollectionName  string    `bson:"collectionName"`
+	SyncTimestamp   time.Time `bson:"syncTimestamp"`
+	RecordsUploaded int64     `bson:"recordsUploaded"`
+}
+
+// SchemaMigration records a migration applied to the datalake, in the schemaMigrations collection.
+type SchemaMigration struct {
+	Version   int       `bson:"version"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"appliedAt"`
+	// Documents is the number of documents the migration rewrote.
+	Documents int64 `bson:"documents"`
 }
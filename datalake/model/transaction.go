@@ -1,15 +1,56 @@
 package model
 
+import (
+	"time"
+
+	"babylon/dataloader/money"
+)
+
+// SchemaVersion is the version of the schema transactions and statements are stored in. It is
+// the version of the last migration in storage.Migrations.
+const SchemaVersion = 4
+
 // Transaction represents a single row from the CSV file, mapped for storage.
 type Transaction struct {
-	Details        string  `bson:"Details"`
-	PostingDate    string  `bson:"PostingDate"`
-	Description    string  `bson:"Description"`
-	Amount         float64 `bson:"Amount"`
-	Category       string  `bson:"category"`
-	Type           string  `bson:"Type"`
-	Balance        float64 `bson:"Balance"`
-	CheckOrSlipNum string  `bson:"CheckOrSlipNum"`
-	DataSource     string  `bson:"dataSource"`
-	AccountID      string  `bson:"accountID"`
+	// SchemaVersion is the schema version the document was written or last migrated in.
+	SchemaVersion int `bson:"schemaVersion"`
+	// TransactionID is derived from the transaction's content and its occurrence within the
+	// file, and is unique within the data source's collection.
+	TransactionID string `bson:"transactionID"`
+	Details       string `bson:"details"`
+	// PostingDate is the day the transaction was posted, at midnight UTC.
+	PostingDate time.Time `bson:"postingDate"`
+	// RawPostingDate is the posting date as the source wrote it.
+	RawPostingDate string `bson:"rawPostingDate,omitempty"`
+	Description    string `bson:"description"`
+	// Amount is in the currency the source states, if any.
+	Amount   money.Money `bson:"amount"`
+	Category string      `bson:"category"`
+	Type     string      `bson:"type"`
+	// Balance is the account balance after the transaction, in the same currency as Amount.
+	Balance        money.Money `bson:"balance"`
+	CheckOrSlipNum string      `bson:"checkOrSlipNum"`
+	DataSource     string      `bson:"dataSource"`
+	AccountID      string      `bson:"accountID"`
+	// ExternalID is the institution's own identifier for the transaction, e.g. an OFX FITID.
+	ExternalID string `bson:"externalID,omitempty"`
+	// Memo is free text the account holder or institution attached to the transaction.
+	Memo string `bson:"memo,omitempty"`
+	// ValueDate is the date funds became available, where it differs from the posting date.
+	ValueDate string `bson:"valueDate,omitempty"`
+	// EndToEndID is the payment's end-to-end reference, as assigned by the initiating party.
+	EndToEndID string `bson:"endToEndID,omitempty"`
+	// StatementID identifies the account statement the transaction was reported in.
+	StatementID string `bson:"statementID,omitempty"`
+	// ReportingAmount is Amount converted to the reporting currency, so that totals can be
+	// compared across accounts. It is unset when no rate was available.
+	ReportingAmount *money.Money `bson:"reportingAmount,omitempty"`
+	// FXRate is the rate ReportingAmount was converted at, in reporting currency units per
+	// unit of Amount's currency.
+	FXRate string `bson:"fxRate,omitempty"`
+	// Raw holds the source row's non-empty columns, keyed by lowercased header, so that fields
+	// the mapping does not read are kept and history can be mapped again without the files.
+	Raw map[string]string `bson:"raw,omitempty"`
+	// Lineage records the file, line and ingest run the transaction was read from.
+	Lineage Lineage `bson:"lineage"`
 }
@@ -0,0 +1,98 @@
+package datalake
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	csvparser "babylon/dataloader/csv"
+	"babylon/dataloader/datalake/datasource"
+	"babylon/dataloader/datalake/model"
+)
+
+// Check each statement's opening and closing balances against the transactions upserted
+// from it, store the result alongside the transactions and record it in the stats.
+// Statements are stored under the canonical ID of the account they name.
+// A statement that does not reconcile is logged but does not fail the file.
+func (p *CSVFileProcessor) reconcileStatements(
+	ctx context.Context,
+	fileName string,
+	sourceInfo *datasource.SourceInfo,
+	statements []csvparser.Statement,
+	batch *recordBatch,
+) error {
+	now := time.Now()
+	docs := make([]model.Statement, 0, len(statements))
+	for _, statement := range statements {
+		doc, err := reconcile(statement, batch.statements[statement.ID])
+		if err != nil {
+			return fmt.Errorf("failed to reconcile statement %s: %w", statement.ID, err)
+		}
+		doc.DataSource = sourceInfo.DataSource
+		if doc.AccountID == "" {
+			doc.AccountID = sourceInfo.AccountID
+		} else if doc.AccountID, err = p.canonicalAccountID(ctx, doc.DataSource, doc.AccountID); err != nil {
+			return err
+		}
+		doc.SourceFile = fileName
+		doc.ReconciledAt = now
+		docs = append(docs, doc)
+
+		p.Stats.RecordReconciliation(fileName, doc)
+		// Statements without both balances, such as OFX statements, cannot be checked.
+		if !doc.Reconciled && doc.OpeningBalance != nil && doc.ClosingBalance != nil {
+			p.Logger.WarnContext(
+				ctx,
+				"statement balances do not reconcile",
+				"file", fileName,
+				"statementID", doc.StatementID,
+				"difference", doc.Difference,
+			)
+		}
+	}
+
+	if err := p.Repo.UpsertStatements(ctx, docs); err != nil {
+		return fmt.Errorf("failed to upsert statements: %w", err)
+	}
+
+	return nil
+}
+
+// reconcile compares a statement's balance movement with the total of its upserted entries.
+// Statements missing either balance cannot be reconciled.
+func reconcile(statement csvparser.Statement, total *statementTotal) (model.Statement, error) {
+	doc := model.Statement{
+		SchemaVersion:  model.SchemaVersion,
+		StatementID:    statement.ID,
+		Kind:           statement.Kind,
+		AccountID:      statement.AccountID,
+		OpeningBalance: toBalance(statement.Opening),
+		ClosingBalance: toBalance(statement.Closing),
+	}
+	if total != nil {
+		doc.Entries = total.entries
+		doc.EntriesTotal = total.amount
+	}
+	if doc.OpeningBalance == nil || doc.ClosingBalance == nil {
+		return doc, nil
+	}
+
+	movement, err := doc.ClosingBalance.Amount.Sub(doc.OpeningBalance.Amount)
+	if err != nil {
+		return doc, err
+	}
+	difference, err := movement.Sub(doc.EntriesTotal)
+	if err != nil {
+		return doc, err
+	}
+	doc.Difference = difference
+	doc.Reconciled = difference.IsZero()
+	return doc, nil
+}
+
+func toBalance(balance *csvparser.Balance) *model.Balance {
+	if balance == nil {
+		return nil
+	}
+	return &model.Balance{Amount: balance.Amount, Date: balance.Date}
+}
@@ -0,0 +1,110 @@
+package datalake
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	csvparser "babylon/dataloader/csv"
+)
+
+// Reasons a row is rejected while being mapped to a transaction. Rows the parser could
+// not read carry the parser's own reason, e.g. csvparser.RejectShortRow.
+const (
+	RejectMissingPostingDate = "missing_posting_date"
+	RejectInvalidPostingDate = "invalid_posting_date"
+	RejectInvalidAmount      = "invalid_amount"
+)
+
+var errErrorBudgetExceeded = errors.New("too many rows rejected")
+
+// ErrorBudgetExceededError is returned when a file rejects more rows than its data source's
+// error budget allows. The message breaks the rejections down by reason.
+func ErrorBudgetExceededError(rejected int, total int, counts map[string]int) error {
+	breakdown := make([]string, 0, len(counts))
+	for _, reason := range slices.Sorted(maps.Keys(counts)) {
+		breakdown = append(breakdown, fmt.Sprintf("%s=%d", reason, counts[reason]))
+	}
+	return fmt.Errorf("%w, %d of %d (%s)", errErrorBudgetExceeded, rejected, total, strings.Join(breakdown, ", "))
+}
+
+// rejectsSuffix is appended to a data file's name to name its rejects file.
+const rejectsSuffix = ".rejects.csv"
+
+// rejection is a row that could not be turned into a transaction.
+type rejection struct {
+	record csvparser.Record
+	reason string
+	// detail is a human-readable explanation, e.g. the value that failed to parse.
+	detail string
+}
+
+// rejectWriter quarantines a file's rejected rows to a CSV file of line number, reason
+// code, detail and original row. The file is only created once a row is rejected.
+type rejectWriter struct {
+	path   string
+	file   *os.File
+	writer *csv.Writer
+}
+
+func newRejectWriter(dir string, fileName string) *rejectWriter {
+	return &rejectWriter{path: filepath.Join(dir, fileName+rejectsSuffix)}
+}
+
+// write appends a rejected row, creating the rejects file on first use.
+func (w *rejectWriter) write(rej rejection) error {
+	if w.writer == nil {
+		if err := os.MkdirAll(filepath.Dir(w.path), 0o750); err != nil {
+			return CreateDirectoryError(err.Error())
+		}
+		file, err := os.Create(w.path)
+		if err != nil {
+			return fmt.Errorf("failed to create rejects file %s: %w", w.path, err)
+		}
+		w.file, w.writer = file, csv.NewWriter(file)
+		if err = w.writer.Write([]string{"line", "reason", "detail", "raw"}); err != nil {
+			return fmt.Errorf("failed to write rejects file %s: %w", w.path, err)
+		}
+	}
+
+	raw := rej.record.Raw
+	if raw == "" && rej.record.Fields != nil {
+		// Formats without a textual row keep the parsed fields instead.
+		encoded, err := json.Marshal(rej.record.Fields)
+		if err != nil {
+			return fmt.Errorf("failed to encode rejected row: %w", err)
+		}
+		raw = string(encoded)
+	}
+
+	row := []string{strconv.FormatInt(rej.record.Line, 10), rej.reason, rej.detail, raw}
+	if err := w.writer.Write(row); err != nil {
+		return fmt.Errorf("failed to write rejects file %s: %w", w.path, err)
+	}
+	return nil
+}
+
+// close flushes and closes the rejects file, if one was created. It is safe to call twice.
+func (w *rejectWriter) close() error {
+	if w.file == nil {
+		return nil
+	}
+	w.writer.Flush()
+	flushErr := w.writer.Error()
+	closeErr := w.file.Close()
+	w.file, w.writer = nil, nil
+	if flushErr != nil {
+		return fmt.Errorf("failed to write rejects file %s: %w", w.path, flushErr)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("failed to close rejects file %s: %w", w.path, closeErr)
+	}
+	return nil
+}
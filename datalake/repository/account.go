@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"babylon/dataloader/datalake/model"
+)
+
+// ErrAccountNotFound is returned when no account is registered for a data source and account ID.
+var ErrAccountNotFound = errors.New("account not found")
+
+// AccountRepository looks up and registers the accounts files are loaded into.
+type AccountRepository interface {
+	FindAccount(ctx context.Context, dataSource string, accountID string) (model.Account, error)
+	AddAccount(ctx context.Context, account model.Account) error
+}
@@ -9,4 +9,5 @@ import (
 // Repository defines the interface for data storage operations.
 type Repository interface {
 	BulkUpsertTransactions(ctx context.Context, transactions []model.Transaction) error
+	UpsertStatements(ctx context.Context, statements []model.Statement) error
 }
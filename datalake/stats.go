@@ -3,20 +3,48 @@ package datalake
 import (
 	"encoding/json"
 	"log/slog"
+
+	csvparser "babylon/dataloader/csv"
+	"babylon/dataloader/datalake/datasource"
+	"babylon/dataloader/datalake/model"
+	"babylon/dataloader/money"
 )
 
 // Stats holds statistics about the file processing.
 type Stats struct {
+	// RunID identifies the ingest run, as recorded in the lineage of the transactions it wrote.
+	RunID          string            `json:"runID,omitempty"`
 	TotalFiles     int               `json:"totalFiles"`
 	ProcessedFiles int               `json:"processedFiles"`
 	FailedFiles    int               `json:"failedFiles"`
 	Failures       map[string]string `json:"failures"`
+	// Dialects records the delimiter, quote style, encoding and BOM each file was read with.
+	Dialects map[string]csvparser.Dialect `json:"dialects,omitempty"`
+	// Detections records, per file identified by its contents, the best matching data source
+	// and its confidence, whether or not it was confident enough to be used.
+	Detections map[string]datasource.Detection `json:"detections,omitempty"`
+	// Rejections counts, per file, the rows quarantined to its rejects file, by reason.
+	Rejections map[string]map[string]int `json:"rejections,omitempty"`
+	// Reconciliations records, per file, whether each statement's balances matched its entries.
+	Reconciliations map[string][]Reconciliation `json:"reconciliations,omitempty"`
+}
+
+// Reconciliation is the outcome of checking one statement's balances.
+type Reconciliation struct {
+	StatementID string      `json:"statementID"`
+	Entries     int         `json:"entries"`
+	Difference  money.Money `json:"difference"`
+	Reconciled  bool        `json:"reconciled"`
 }
 
 // NewStats creates and initializes a new Stats object.
 func NewStats() *Stats {
 	return &Stats{
-		Failures: make(map[string]string),
+		Failures:        make(map[string]string),
+		Dialects:        make(map[string]csvparser.Dialect),
+		Detections:      make(map[string]datasource.Detection),
+		Rejections:      make(map[string]map[string]int),
+		Reconciliations: make(map[string][]Reconciliation),
 	}
 }
 
@@ -26,6 +54,34 @@ func (s *Stats) AddFailure(file, reason string) {
 	s.Failures[file] = reason
 }
 
+// RecordDialect records the dialect a file was parsed with.
+func (s *Stats) RecordDialect(file string, dialect csvparser.Dialect) {
+	s.Dialects[file] = dialect
+}
+
+// RecordDetection records how a file's contents matched the known data sources.
+func (s *Stats) RecordDetection(file string, detection datasource.Detection) {
+	s.Detections[file] = detection
+}
+
+// RecordRejections records how many of a file's rows were rejected for each reason.
+func (s *Stats) RecordRejections(file string, counts map[string]int) {
+	if len(counts) == 0 {
+		return
+	}
+	s.Rejections[file] = counts
+}
+
+// RecordReconciliation records the reconciliation of one of a file's statements.
+func (s *Stats) RecordReconciliation(file string, statement model.Statement) {
+	s.Reconciliations[file] = append(s.Reconciliations[file], Reconciliation{
+		StatementID: statement.StatementID,
+		Entries:     statement.Entries,
+		Difference:  statement.Difference,
+		Reconciled:  statement.Reconciled,
+	})
+}
+
 // IncrementProcessed increments the count of successfully processed files.
 func (s *Stats) IncrementProcessed() {
 	s.ProcessedFiles++
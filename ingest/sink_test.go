@@ -34,6 +34,10 @@ func (m *mockRepo) BulkUpsertTransactions(ctx context.Context, transactions []mo
 	return m.err
 }
 
+func (m *mockRepo) UpsertStatements(ctx context.Context, statements []model.Statement) error {
+	return m.err
+}
+
 type mockExtractor struct {
 	extractInfoCalled bool
 	info              *datasource.SourceInfo
@@ -51,9 +55,20 @@ type mockParser struct {
 	err         error
 }
 
-func (m *mockParser) Parse(ctx context.Context, filePath string, dataSource string, accountID string) ([]map[string]string, int64, error) {
+func (m *mockParser) Parse(
+	ctx context.Context,
+	filePath string,
+	dataSource string,
+	accountID string,
+	handle csvparser.RecordHandler,
+) (csvparser.Summary, error) {
 	m.parseCalled = true
-	return m.records, int64(len(m.records)), m.err
+	for i, fields := range m.records {
+		if err := handle(ctx, csvparser.Record{Line: int64(i + 2), Fields: fields}); err != nil {
+			return csvparser.Summary{Records: int64(i)}, err
+		}
+	}
+	return csvparser.Summary{Records: int64(len(m.records))}, m.err
 }
 
 type mockClient struct {
@@ -4,23 +4,41 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log/slog"
 	"os"
+	"slices"
 
 	bcontext "babylon/dataloader/appcontext"
+	camtparser "babylon/dataloader/camt"
 	"babylon/dataloader/config"
 	csvparser "babylon/dataloader/csv"
 	"babylon/dataloader/datalake"
 	"babylon/dataloader/datalake/datasource"
+	"babylon/dataloader/datalake/fx"
+	"babylon/dataloader/datalake/mapping"
+	"babylon/dataloader/datalake/model"
 	_ "babylon/dataloader/datalake/repository"
 	"babylon/dataloader/ingest"
+	mt940parser "babylon/dataloader/mt940"
+	ofxparser "babylon/dataloader/ofx"
+	qifparser "babylon/dataloader/qif"
 	"babylon/dataloader/storage"
 	"babylon/dataloader/synthetic"
+	xlsxparser "babylon/dataloader/xlsx"
 )
 
 const (
 	minArgs = 2
+	// lineageArgs are the data source and transaction ID the lineage command takes.
+	lineageArgs = 2
+	// accountArgs are the data source and account ID the accounts add and update commands take.
+	accountArgs   = 2
+	accountsUsage = "usage: go run main.go accounts list | accounts add|update " +
+		"[-name N] [-type checking|savings|credit_card] [-owner O] [-institution I] <dataSource> <accountID> | " +
+		"accounts alias <dataSource> <accountID> <alias>..."
 )
 
 func main() {
@@ -62,6 +80,56 @@ func run(logger *slog.Logger, command string, args []string) error {
 	// Generate synthetic data for testing.
 	// todo: Add env-specific config to avoid this being ran when deployed.
 	case "ingest":
+		// Load and validate per-source configuration before touching the database.
+		extractor := datasource.DefaultRegistry()
+		csvParser := csvparser.NewDefaultParser()
+		csvParser.Headers = extractor.Headers()
+		if cfg.CSVDialectsFile != "" {
+			dialects, err := csvparser.LoadDialects(cfg.CSVDialectsFile)
+			if err != nil {
+				return fmt.Errorf("failed to load CSV dialect overrides: %w", err)
+			}
+			csvParser.Overrides = dialects
+		}
+		xlsxParser := xlsxparser.NewParser()
+		if cfg.XLSXSheetsFile != "" {
+			sheets, err := xlsxparser.LoadSheets(cfg.XLSXSheetsFile)
+			if err != nil {
+				return fmt.Errorf("failed to load XLSX sheet settings: %w", err)
+			}
+			xlsxParser.Sheets = sheets
+		}
+		mappings := mapping.Default()
+		if cfg.MappingFile != "" {
+			loaded, err := mapping.Load(cfg.MappingFile)
+			if err != nil {
+				return fmt.Errorf("failed to load column mappings: %w", err)
+			}
+			mappings = loaded
+		}
+
+		var rates *fx.Table
+		if cfg.FXRatesFile != "" {
+			loaded, err := fx.Load(cfg.FXRatesFile, cfg.ReportingCurrency)
+			if err != nil {
+				return fmt.Errorf("failed to load FX rates: %w", err)
+			}
+			rates = loaded
+		}
+
+		ofxParser := ofxparser.NewParser()
+		ofxParser.Banks = extractor
+		camtParser := camtparser.NewParser()
+		camtParser.Banks = extractor
+
+		parser := csvparser.NewRegistry()
+		parser.Register(csvParser, ".csv")
+		parser.Register(ofxParser, ".ofx", ".qfx")
+		parser.Register(qifparser.NewParser(), ".qif")
+		parser.Register(camtParser, ".xml")
+		parser.Register(mt940parser.NewParser(), ".sta", ".mt940", ".940", ".mt942", ".942")
+		parser.Register(xlsxParser, ".xlsx")
+
 		// Instantiate dependencies
 		client, err := storage.ConnectToMongoDB(ctx, cfg.MongoURI)
 		if err != nil {
@@ -75,21 +143,251 @@ func run(logger *slog.Logger, command string, args []string) error {
 		}()
 
 		mongoProvider := storage.NewMongoProvider(client)
+		// Documents stored by an earlier version must be migrated before new ones are upserted
+		// next to them, or they would not be matched and the transactions would be duplicated.
+		collections, err := storage.TransactionCollections(ctx, client)
+		if err != nil {
+			return err
+		}
+		if err = storage.NewMigrator(mongoProvider, collections).Check(ctx); err != nil {
+			return err
+		}
+
 		repo := storage.NewMongoRepository(mongoProvider)
-		genericExtractor := datasource.NewGenericExtractor()
-		csvParser := csvparser.NewDefaultParser()
-		datalakeClient := datalake.NewClient()
+		datalakeClient := datalake.NewClient(datalake.Options{
+			BatchSize: cfg.IngestBatchSize,
+			Mappings:  mappings.WithDefaults(extractor.Mappings()),
+			Rates:     rates,
+			// Unknown accounts are registered with a warning unless they must be added first.
+			RequireRegisteredAccounts: cfg.RequireAccounts,
+		})
 
 		// Create and run sink
 		sink := ingest.NewSink(ingest.SinkDependencies{
 			Config:         cfg,
 			Repo:           repo,
-			Extractor:      genericExtractor,
-			Parser:         csvParser,
+			Extractor:      extractor,
+			Parser:         parser,
 			DatalakeClient: datalakeClient,
 		})
 		return sink.Ingest(ctx)
+	// Apply pending schema migrations: migrate [-dry-run] | migrate status.
+	case "migrate":
+		migrateFlags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+		dryRun := migrateFlags.Bool("dry-run", false, "Count the documents each pending migration would rewrite")
+		if err := migrateFlags.Parse(args); err != nil {
+			return fmt.Errorf("failed to parse flags: %w", err)
+		}
+		showStatus := migrateFlags.Arg(0) == "status"
+		if migrateFlags.NArg() > 0 && !showStatus {
+			return fmt.Errorf("unknown migrate subcommand: %s", migrateFlags.Arg(0))
+		}
+
+		client, err := storage.ConnectToMongoDB(ctx, cfg.MongoURI)
+		if err != nil {
+			return fmt.Errorf("connection to MongoDB failed: %w", err)
+		}
+		defer func() {
+			if deferErr := client.Disconnect(ctx); deferErr != nil {
+				logger.ErrorContext(ctx, "Error disconnecting from MongoDB", "error", deferErr)
+			}
+		}()
+
+		collections, err := storage.TransactionCollections(ctx, client)
+		if err != nil {
+			return err
+		}
+		migrator := storage.NewMigrator(storage.NewMongoProvider(client), collections)
+
+		var statuses []storage.MigrationStatus
+		if showStatus {
+			statuses, err = migrator.Status(ctx)
+		} else {
+			statuses, err = migrator.Migrate(ctx, *dryRun)
+		}
+		for _, status := range statuses {
+			logger.InfoContext(ctx, "Migration",
+				"version", status.Version,
+				"name", status.Name,
+				"applied", status.Applied,
+				"appliedAt", status.AppliedAt,
+				"documents", status.Documents,
+			)
+		}
+		if err != nil {
+			return err
+		}
+		if !showStatus && len(statuses) == 0 {
+			logger.InfoContext(ctx, "Schema is up to date", "version", model.SchemaVersion)
+		}
+		return nil
+	// Show where a stored transaction came from: lineage <dataSource> <transactionID>.
+	case "lineage":
+		if len(args) != lineageArgs {
+			return errors.New("usage: go run main.go lineage <dataSource> <transactionID>")
+		}
+		client, err := storage.ConnectToMongoDB(ctx, cfg.MongoURI)
+		if err != nil {
+			return fmt.Errorf("connection to MongoDB failed: %w", err)
+		}
+		defer func() {
+			if deferErr := client.Disconnect(ctx); deferErr != nil {
+				logger.ErrorContext(ctx, "Error disconnecting from MongoDB", "error", deferErr)
+			}
+		}()
+
+		repo := storage.NewMongoRepository(storage.NewMongoProvider(client))
+		transaction, err := repo.FindTransaction(ctx, args[0], args[1])
+		if err != nil {
+			return err
+		}
+		lineage := transaction.Lineage
+		logger.InfoContext(ctx, "Transaction origin",
+			"transactionID", transaction.TransactionID,
+			"sourceFile", lineage.SourceFile,
+			"fileHash", lineage.FileHash,
+			"line", lineage.Line,
+			"runID", lineage.RunID,
+			"ingestedAt", lineage.IngestedAt,
+			"raw", transaction.Raw,
+		)
+
+		// The file is archived to the processed directory, unless it was left in place.
+		path, row, err := datalake.SourceRow(lineage, cfg.ProcessedDir, cfg.UnprocessedDir)
+		if err != nil {
+			logger.WarnContext(ctx, "Raw row unavailable", "error", err)
+			return nil
+		}
+		logger.InfoContext(ctx, "Raw row", "file", path, "row", row)
+		return nil
+	// Manage the registered accounts: accounts list | accounts add|update [flags] <dataSource> <accountID> |
+	// accounts alias <dataSource> <accountID> <alias>...
+	case "accounts":
+		if len(args) == 0 {
+			return errors.New(accountsUsage)
+		}
+		subcommand := args[0]
+		var account model.Account
+		var changed map[string]bool
+		switch subcommand {
+		case "list":
+			// list takes no arguments.
+		case "alias":
+			if len(args) <= 1+accountArgs {
+				return errors.New(accountsUsage)
+			}
+			account = model.Account{DataSource: args[1], AccountID: args[2], Aliases: args[3:]}
+		default:
+			var err error
+			if account, changed, err = parseAccountArgs(subcommand, args[1:]); err != nil {
+				return err
+			}
+		}
+
+		client, err := storage.ConnectToMongoDB(ctx, cfg.MongoURI)
+		if err != nil {
+			return fmt.Errorf("connection to MongoDB failed: %w", err)
+		}
+		defer func() {
+			if deferErr := client.Disconnect(ctx); deferErr != nil {
+				logger.ErrorContext(ctx, "Error disconnecting from MongoDB", "error", deferErr)
+			}
+		}()
+		repo := storage.NewMongoRepository(storage.NewMongoProvider(client))
+
+		switch subcommand {
+		case "list":
+			accounts, listErr := repo.ListAccounts(ctx)
+			if listErr != nil {
+				return listErr
+			}
+			for _, registered := range accounts {
+				logger.InfoContext(ctx, "Account",
+					"dataSource", registered.DataSource,
+					"accountID", registered.AccountID,
+					"name", registered.Name,
+					"type", registered.Type,
+					"owner", registered.Owner,
+					"institution", registered.Institution,
+					"aliases", registered.Aliases,
+					"autoRegistered", registered.AutoRegistered,
+				)
+			}
+			return nil
+		case "alias":
+			if err = repo.AddAccountAliases(ctx, account.DataSource, account.AccountID, account.Aliases...); err != nil {
+				return err
+			}
+			logger.InfoContext(ctx, "Added account aliases",
+				"dataSource", account.DataSource, "accountID", account.AccountID, "aliases", account.Aliases)
+			return nil
+		case "add":
+			if err = repo.AddAccount(ctx, account); err != nil {
+				return err
+			}
+			logger.InfoContext(ctx, "Registered account", "dataSource", account.DataSource, "accountID", account.AccountID)
+			return nil
+		default:
+			// Only the details given on the command line are changed.
+			stored, findErr := repo.FindAccount(ctx, account.DataSource, account.AccountID)
+			if findErr != nil {
+				return findErr
+			}
+			if changed["name"] {
+				stored.Name = account.Name
+			}
+			if changed["type"] {
+				stored.Type = account.Type
+			}
+			if changed["owner"] {
+				stored.Owner = account.Owner
+			}
+			if changed["institution"] {
+				stored.Institution = account.Institution
+			}
+			if err = repo.UpdateAccount(ctx, stored); err != nil {
+				return err
+			}
+			logger.InfoContext(ctx, "Updated account", "dataSource", stored.DataSource, "accountID", stored.AccountID)
+			return nil
+		}
 	default:
 		return fmt.Errorf("unknown command: %s", command)
 	}
 }
+
+// Parse the flags and arguments of the accounts add and update commands. It returns the
+// account they describe and which of its details were given.
+func parseAccountArgs(subcommand string, args []string) (model.Account, map[string]bool, error) {
+	if subcommand != "add" && subcommand != "update" {
+		return model.Account{}, nil, fmt.Errorf("unknown accounts subcommand: %s", subcommand)
+	}
+
+	accountFlags := flag.NewFlagSet("accounts "+subcommand, flag.ContinueOnError)
+	name := accountFlags.String("name", "", "Friendly name of the account")
+	accountType := accountFlags.String("type", "", "Account type: checking, savings or credit_card")
+	owner := accountFlags.String("owner", "", "Owner of the account")
+	institution := accountFlags.String("institution", "", "Institution that holds the account")
+	if err := accountFlags.Parse(args); err != nil {
+		return model.Account{}, nil, fmt.Errorf("failed to parse flags: %w", err)
+	}
+	if accountFlags.NArg() != accountArgs {
+		return model.Account{}, nil, errors.New(accountsUsage)
+	}
+	if *accountType != "" && !slices.Contains(model.AccountTypes(), model.AccountType(*accountType)) {
+		return model.Account{}, nil, fmt.Errorf("unknown account type: %s", *accountType)
+	}
+
+	changed := make(map[string]bool)
+	accountFlags.Visit(func(f *flag.Flag) {
+		changed[f.Name] = true
+	})
+	return model.Account{
+		DataSource:  accountFlags.Arg(0),
+		AccountID:   accountFlags.Arg(1),
+		Name:        *name,
+		Type:        model.AccountType(*accountType),
+		Owner:       *owner,
+		Institution: *institution,
+	}, changed, nil
+}
@@ -0,0 +1,261 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultLocale is the locale amounts are read in when a source does not declare one.
+const DefaultLocale = "en"
+
+var errUnknownLocale = errors.New("unknown locale")
+
+// UnknownLocaleError is returned when no number format is known for a locale.
+func UnknownLocaleError(locale string) error {
+	return fmt.Errorf("%w, %s", errUnknownLocale, locale)
+}
+
+// Format is how a locale writes the digits of an amount.
+type Format struct {
+	// Decimal separates the whole units from the fraction, e.g. "." or ",".
+	Decimal string
+	// Group separates each three digits of the whole units, e.g. "," or ".". It is optional
+	// in the amounts read.
+	Group string
+}
+
+// formats holds the number format of each locale, keyed by language or language-region tag.
+//
+//nolint:gochecknoglobals // Read-only lookup table.
+var formats = map[string]Format{
+	"en":    {Decimal: ".", Group: ","},
+	"ja":    {Decimal: ".", Group: ","},
+	"zh":    {Decimal: ".", Group: ","},
+	"de":    {Decimal: ",", Group: "."},
+	"de-ch": {Decimal: ".", Group: "'"},
+	"es":    {Decimal: ",", Group: "."},
+	"it":    {Decimal: ",", Group: "."},
+	"it-ch": {Decimal: ".", Group: "'"},
+	"nl":    {Decimal: ",", Group: "."},
+	"pt":    {Decimal: ",", Group: "."},
+	"da":    {Decimal: ",", Group: "."},
+	"tr":    {Decimal: ",", Group: "."},
+	"fr":    {Decimal: ",", Group: " "},
+	"fr-ch": {Decimal: ".", Group: "'"},
+	"sv":    {Decimal: ",", Group: " "},
+	"nb":    {Decimal: ",", Group: " "},
+	"fi":    {Decimal: ",", Group: " "},
+	"pl":    {Decimal: ",", Group: " "},
+	"cs":    {Decimal: ",", Group: " "},
+	"ru":    {Decimal: ",", Group: " "},
+}
+
+// symbols lists the currency symbols stripped from amounts, longest first so that e.g. US$
+// is not read as $.
+//
+//nolint:gochecknoglobals // Read-only lookup table.
+var symbols = []string{"US$", "CA$", "AU$", "NZ$", "HK$", "C$", "A$", "R$", "$", "€", "£", "¥", "₹", "₩", "₽", "₺", "₪"}
+
+// separators normalises the spaces and apostrophes locales group digits with, and the
+// minus sign.
+//
+//nolint:gochecknoglobals // Read-only replacer.
+var separators = strings.NewReplacer("\u00a0", " ", "\u202f", " ", "\u2009", " ", "\u2019", "'", "\u2212", "-")
+
+// FormatFor returns the number format of a BCP 47 locale such as de-DE, falling back to its
+// language when the region writes numbers no differently.
+func FormatFor(locale string) (Format, error) {
+	if locale == "" {
+		locale = DefaultLocale
+	}
+	tag := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+	if format, ok := formats[tag]; ok {
+		return format, nil
+	}
+	language, _, _ := strings.Cut(tag, "-")
+	if format, ok := formats[language]; ok {
+		return format, nil
+	}
+	return Format{}, UnknownLocaleError(locale)
+}
+
+// ParseFormatted reads an amount as bank exports write it in format, e.g. $1,234.56,
+// 1.234,56 €, (45.00), 45.00-, or 45.00 DR. Parentheses, a leading or trailing sign and a
+// DR suffix make the amount negative; a CR suffix keeps it positive. A currency code
+// written with the amount is used when currency is empty, and must match it otherwise.
+// It also reports whether the amount's direction was marked explicitly, by parentheses or
+// a DR or CR suffix, rather than by its sign alone.
+func ParseFormatted(value string, currency string, format Format) (Money, bool, error) {
+	var affix affixes
+	text, err := affix.strip(value, separators.Replace(value))
+	if err != nil {
+		return Money{}, false, err
+	}
+	if affix.code != "" {
+		switch {
+		case currency == "":
+			currency = affix.code
+		case !strings.EqualFold(currency, affix.code):
+			return Money{}, false, CurrencyMismatchError(strings.ToUpper(currency), affix.code)
+		}
+	}
+
+	plain, err := format.plain(value, text)
+	if err != nil {
+		return Money{}, false, err
+	}
+	parsed, err := parse(value, plain, currency)
+	if err != nil {
+		return Money{}, false, err
+	}
+	if affix.negative {
+		parsed = parsed.Neg()
+	}
+	return parsed, affix.marked, nil
+}
+
+// plain rewrites text, stripped of its sign and currency, as a decimal number Parse reads.
+// Group separators must split the whole units into threes.
+func (f Format) plain(value string, text string) (string, error) {
+	whole, fraction, hasFraction := strings.Cut(text, f.Decimal)
+	if strings.Contains(fraction, f.Decimal) || (f.Group != "" && strings.Contains(fraction, f.Group)) {
+		return "", InvalidAmountError(value, "separator after the decimal "+f.Decimal)
+	}
+	if f.Group != "" && strings.Contains(whole, f.Group) {
+		groups := strings.Split(whole, f.Group)
+		for i, group := range groups {
+			if (i == 0 && (group == "" || len(group) > 3)) || (i > 0 && len(group) != 3) {
+				return "", InvalidAmountError(value, fmt.Sprintf("misplaced group separator %q", f.Group))
+			}
+		}
+		whole = strings.Join(groups, "")
+	}
+	if hasFraction {
+		return whole + "." + fraction, nil
+	}
+	return whole, nil
+}
+
+// affixes records what was written around an amount's digits.
+type affixes struct {
+	negative bool
+	signed   bool
+	// marked is set when the sign came from parentheses or a DR or CR marker.
+	marked bool
+	code   string
+}
+
+// strip removes signs, sign markers and currencies from both ends of text.
+func (a *affixes) strip(value string, text string) (string, error) {
+	for {
+		text = strings.TrimSpace(text)
+		next, err := a.stripOne(value, text)
+		if err != nil {
+			return "", err
+		}
+		if next == text {
+			return text, nil
+		}
+		text = next
+	}
+}
+
+// stripOne removes one sign, sign marker or currency from either end of text.
+func (a *affixes) stripOne(value string, text string) (string, error) {
+	if len(text) >= 2 && strings.HasPrefix(text, "(") && strings.HasSuffix(text, ")") {
+		a.marked = true
+		return text[1 : len(text)-1], a.sign(value, true)
+	}
+	for _, mark := range []string{"-", "+"} {
+		if rest, ok := strings.CutPrefix(text, mark); ok {
+			return rest, a.sign(value, mark == "-")
+		}
+		if rest, ok := strings.CutSuffix(text, mark); ok {
+			return rest, a.sign(value, mark == "-")
+		}
+	}
+	for _, symbol := range symbols {
+		if rest, ok := strings.CutPrefix(text, symbol); ok {
+			return rest, nil
+		}
+		if rest, ok := strings.CutSuffix(text, symbol); ok {
+			return rest, nil
+		}
+	}
+
+	if word := trailingWord(text); word != "" {
+		return strings.TrimSuffix(text, word), a.word(value, word)
+	}
+	if word := leadingWord(text); word != "" {
+		return strings.TrimPrefix(text, word), a.word(value, word)
+	}
+	return text, nil
+}
+
+// sign records the amount's sign, which may only be given once.
+func (a *affixes) sign(value string, negative bool) error {
+	if a.signed {
+		return InvalidAmountError(value, "more than one sign")
+	}
+	a.negative, a.signed = negative, true
+	return nil
+}
+
+// word records a DR or CR marker, an ISO 4217 code, or a currency written in letters.
+func (a *affixes) word(value string, word string) error {
+	upper := strings.ToUpper(word)
+	switch {
+	case upper == "DR" || upper == "CR":
+		a.marked = true
+		return a.sign(value, upper == "DR")
+	case upper == "KR" || upper == "ZŁ" || upper == "KČ" || upper == "FT":
+		return nil
+	case len(word) == 3 && isASCIILetters(word):
+		if a.code != "" {
+			return InvalidAmountError(value, "more than one currency")
+		}
+		a.code = upper
+		return nil
+	default:
+		return InvalidAmountError(value, fmt.Sprintf("unexpected %q", word))
+	}
+}
+
+// trailingWord returns the letters text ends with.
+func trailingWord(text string) string {
+	end := len(text)
+	for end > 0 {
+		r, size := utf8.DecodeLastRuneInString(text[:end])
+		if !unicode.IsLetter(r) {
+			break
+		}
+		end -= size
+	}
+	return text[end:]
+}
+
+// leadingWord returns the letters text starts with.
+func leadingWord(text string) string {
+	start := 0
+	for start < len(text) {
+		r, size := utf8.DecodeRuneInString(text[start:])
+		if !unicode.IsLetter(r) {
+			break
+		}
+		start += size
+	}
+	return text[:start]
+}
+
+// isASCIILetters reports whether s holds nothing but ASCII letters.
+func isASCIILetters(s string) bool {
+	for _, r := range s {
+		if (r < 'A' || r > 'Z') && (r < 'a' || r > 'z') {
+			return false
+		}
+	}
+	return true
+}
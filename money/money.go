@@ -0,0 +1,269 @@
+// Package money represents monetary amounts exactly, as integer minor units of a currency.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// defaultExponent is the number of minor unit digits of currencies not listed in exponents,
+// and of amounts whose currency is not known.
+const defaultExponent = 2
+
+// exponents lists the ISO 4217 currencies whose minor unit is not a hundredth.
+//
+//nolint:gochecknoglobals // Read-only lookup table.
+var exponents = map[string]int{
+	"BHD": 3, "BIF": 0, "CLF": 4, "CLP": 0, "DJF": 0, "GNF": 0, "IQD": 3, "ISK": 0,
+	"JOD": 3, "JPY": 0, "KMF": 0, "KRW": 0, "KWD": 3, "LYD": 3, "OMR": 3, "PYG": 0,
+	"RWF": 0, "TND": 3, "UGX": 0, "UYI": 0, "UYW": 4, "VND": 0, "VUV": 0, "XAF": 0,
+	"XOF": 0, "XPF": 0,
+}
+
+var (
+	errInvalidAmount    = errors.New("invalid amount")
+	errCurrencyMismatch = errors.New("currencies do not match")
+)
+
+// InvalidAmountError is returned when a value cannot be read as an exact amount.
+func InvalidAmountError(value string, reason string) error {
+	return fmt.Errorf("%w %q: %s", errInvalidAmount, value, reason)
+}
+
+// CurrencyMismatchError is returned when amounts in different currencies are combined.
+func CurrencyMismatchError(a string, b string) error {
+	return fmt.Errorf("%w, %s, %s", errCurrencyMismatch, a, b)
+}
+
+// Money is an amount held as an integer number of minor units, e.g. cents, of a currency.
+type Money struct {
+	// Minor is the signed amount in minor units of Currency.
+	Minor int64 `bson:"minor" json:"minor"`
+	// Currency is the ISO 4217 currency code, or empty when the source does not state it.
+	Currency string `bson:"currency" json:"currency"`
+}
+
+// New returns an amount of minor units of currency.
+func New(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: strings.ToUpper(currency)}
+}
+
+// Exponent returns the number of minor unit digits of currency.
+func Exponent(currency string) int {
+	if exponent, ok := exponents[strings.ToUpper(currency)]; ok {
+		return exponent
+	}
+	return defaultExponent
+}
+
+// Exponents returns the ISO 4217 currencies whose minor unit is not a hundredth, with
+// their number of minor unit digits.
+func Exponents() map[string]int {
+	return maps.Clone(exponents)
+}
+
+// Parse reads a decimal amount, e.g. -1234.5, in currency without going through a float.
+// Digits beyond the currency's minor unit are only accepted when they are zeros.
+func Parse(value string, currency string) (Money, error) {
+	return parse(value, strings.TrimSpace(value), currency)
+}
+
+// parse reads text, a plain decimal number written as value in the source, in currency.
+func parse(value string, text string, currency string) (Money, error) {
+	negative := false
+	switch {
+	case strings.HasPrefix(text, "-"):
+		negative, text = true, text[1:]
+	case strings.HasPrefix(text, "+"):
+		text = text[1:]
+	}
+
+	whole, fraction, _ := strings.Cut(text, ".")
+	if whole == "" && fraction == "" {
+		return Money{}, InvalidAmountError(value, "no digits")
+	}
+	if !digitsOnly(whole) || !digitsOnly(fraction) {
+		return Money{}, InvalidAmountError(value, "not a decimal number")
+	}
+
+	exponent := Exponent(currency)
+	if len(fraction) > exponent {
+		if strings.Trim(fraction[exponent:], "0") != "" {
+			return Money{}, InvalidAmountError(value, fmt.Sprintf("more than %d decimal places", exponent))
+		}
+		fraction = fraction[:exponent]
+	}
+	fraction += strings.Repeat("0", exponent-len(fraction))
+
+	var minor int64
+	if digits := whole + fraction; digits != "" {
+		parsed, err := strconv.ParseInt(digits, 10, 64)
+		if err != nil {
+			return Money{}, InvalidAmountError(value, "out of range")
+		}
+		minor = parsed
+	}
+	if negative {
+		minor = -minor
+	}
+	return New(minor, currency), nil
+}
+
+// digitsOnly reports whether s holds nothing but ASCII digits.
+func digitsOnly(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// FromFloat converts a legacy floating point amount, rounding to the nearest minor unit.
+func FromFloat(amount float64, currency string) Money {
+	scale := math.Pow10(Exponent(currency))
+	return New(int64(math.Round(amount*scale)), currency)
+}
+
+// Add returns the sum of m and other. An amount without a currency takes the other's.
+func (m Money) Add(other Money) (Money, error) {
+	currency, err := m.common(other)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Minor: m.Minor + other.Minor, Currency: currency}, nil
+}
+
+// Sub returns m less other. An amount without a currency takes the other's.
+func (m Money) Sub(other Money) (Money, error) {
+	return m.Add(other.Neg())
+}
+
+// Neg returns m with its sign flipped.
+func (m Money) Neg() Money {
+	return Money{Minor: -m.Minor, Currency: m.Currency}
+}
+
+// Abs returns m without its sign.
+func (m Money) Abs() Money {
+	if m.Minor < 0 {
+		return m.Neg()
+	}
+	return m
+}
+
+// Convert returns m in currency at rate, the units of currency one unit of m's currency
+// buys, rounded half away from zero to currency's minor unit.
+func (m Money) Convert(rate *big.Rat, currency string) Money {
+	scale := Exponent(currency) - Exponent(m.Currency)
+	value := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Minor), rate)
+	factor := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(absInt(scale))), nil))
+	if scale >= 0 {
+		value.Mul(value, factor)
+	} else {
+		value.Quo(value, factor)
+	}
+
+	// Round the magnitude half up: floor((2n + d) / 2d).
+	num := new(big.Int).Abs(value.Num())
+	den := value.Denom()
+	num.Add(num.Lsh(num, 1), den)
+	minor := num.Quo(num, new(big.Int).Lsh(den, 1)).Int64()
+	if value.Sign() < 0 {
+		minor = -minor
+	}
+	return New(minor, currency)
+}
+
+// absInt returns the magnitude of n.
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// IsZero reports whether m is an amount of zero, in any currency.
+func (m Money) IsZero() bool {
+	return m.Minor == 0
+}
+
+// common returns the currency two amounts share.
+func (m Money) common(other Money) (string, error) {
+	switch {
+	case m.Currency == other.Currency || other.Currency == "":
+		return m.Currency, nil
+	case m.Currency == "":
+		return other.Currency, nil
+	default:
+		return "", CurrencyMismatchError(m.Currency, other.Currency)
+	}
+}
+
+// Decimal formats m as a plain decimal number with the currency's minor unit digits, e.g. -1234.50.
+func (m Money) Decimal() string {
+	exponent := Exponent(m.Currency)
+	minor := m.Minor
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+	}
+	digits := strconv.FormatUint(absUint(minor), 10)
+	if exponent == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+	split := len(digits) - exponent
+	return sign + digits[:split] + "." + digits[split:]
+}
+
+// absUint returns the magnitude of n, including for math.MinInt64.
+func absUint(n int64) uint64 {
+	if n < 0 {
+		return uint64(-(n + 1)) + 1
+	}
+	return uint64(n)
+}
+
+// String formats m as its decimal amount followed by its currency, e.g. -1234.50 EUR.
+func (m Money) String() string {
+	if m.Currency == "" {
+		return m.Decimal()
+	}
+	return m.Decimal() + " " + m.Currency
+}
+
+// UnmarshalBSONValue decodes an amount stored either as a {minor, currency} document or,
+// for documents written before amounts were exact, as a double of major units.
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	raw := bson.RawValue{Type: t, Value: data}
+	switch t {
+	case bson.TypeDouble:
+		*m = FromFloat(raw.Double(), "")
+		return nil
+	case bson.TypeNull:
+		*m = Money{}
+		return nil
+	case bson.TypeEmbeddedDocument:
+		// The alias drops this method so the document is decoded field by field.
+		type document Money
+		var doc document
+		if err := raw.Unmarshal(&doc); err != nil {
+			return fmt.Errorf("failed to decode amount: %w", err)
+		}
+		*m = Money(doc)
+		return nil
+	default:
+		return fmt.Errorf("failed to decode amount: unexpected BSON type %s", t)
+	}
+}
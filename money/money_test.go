@@ -0,0 +1,222 @@
+package money_test
+
+import (
+	"math/big"
+	"testing"
+
+	"babylon/dataloader/money"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value    string
+		currency string
+		minor    int64
+		decimal  string
+	}{
+		{"-75.77", "usd", -7577, "-75.77"},
+		{"11190.76", "", 1119076, "11190.76"},
+		{"+5", "EUR", 500, "5.00"},
+		{".5", "EUR", 50, "0.50"},
+		{"1.500", "EUR", 150, "1.50"},
+		{"1200", "JPY", 1200, "1200"},
+		{"-0.125", "KWD", -125, "-0.125"},
+	}
+	for _, tt := range tests {
+		got, err := money.Parse(tt.value, tt.currency)
+		if err != nil {
+			t.Errorf("Parse(%q, %q) failed: %v", tt.value, tt.currency, err)
+			continue
+		}
+		if got.Minor != tt.minor || got.Decimal() != tt.decimal {
+			t.Errorf("Parse(%q, %q): expected %d (%s), got %d (%s)",
+				tt.value, tt.currency, tt.minor, tt.decimal, got.Minor, got.Decimal())
+		}
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, value := range []string{"", "-", "abc", "1,000.00", "1.005", "1e3", "99999999999999999999"} {
+		if _, err := money.Parse(value, "USD"); err == nil {
+			t.Errorf("Expected Parse(%q) to fail", value)
+		}
+	}
+}
+
+func TestAdd_DoesNotDrift(t *testing.T) {
+	total := money.New(0, "USD")
+	cent := money.New(1, "USD")
+	for range 100000 {
+		var err error
+		if total, err = total.Add(cent); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	if total.String() != "1000.00 USD" {
+		t.Errorf("Expected 1000.00 USD, got %s", total)
+	}
+
+	// An amount without a currency takes the other's; different currencies do not mix.
+	if sum, err := money.New(100, "").Add(money.New(1, "EUR")); err != nil || sum.Currency != "EUR" {
+		t.Errorf("Expected 1.01 EUR, got %s (%v)", sum, err)
+	}
+	if _, err := money.New(100, "USD").Add(money.New(1, "EUR")); err == nil {
+		t.Error("Expected adding EUR to USD to fail")
+	}
+}
+
+func TestUnmarshalBSONValue_ReadsLegacyDoubles(t *testing.T) {
+	type document struct {
+		Amount  money.Money `bson:"Amount"`
+		Balance money.Money `bson:"Balance"`
+	}
+
+	legacy, err := bson.Marshal(bson.M{"Amount": -75.77, "Balance": 11190.76})
+	if err != nil {
+		t.Fatalf("failed to marshal legacy document: %v", err)
+	}
+	var doc document
+	if err = bson.Unmarshal(legacy, &doc); err != nil {
+		t.Fatalf("failed to decode legacy document: %v", err)
+	}
+	if doc.Amount.Minor != -7577 || doc.Balance.Minor != 1119076 {
+		t.Errorf("Expected -7577 and 1119076 minor units, got %+v", doc)
+	}
+
+	// Current documents round-trip through their {minor, currency} form.
+	current, err := bson.Marshal(document{Amount: money.New(-7577, "USD")})
+	if err != nil {
+		t.Fatalf("failed to marshal document: %v", err)
+	}
+	doc = document{}
+	if err = bson.Unmarshal(current, &doc); err != nil {
+		t.Fatalf("failed to decode document: %v", err)
+	}
+	if doc.Amount != money.New(-7577, "USD") {
+		t.Errorf("Expected -75.77 USD, got %s", doc.Amount)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		amount   money.Money
+		rate     string
+		currency string
+		expected string
+	}{
+		{money.New(-7577, "EUR"), "1.0856", "USD", "-82.26 USD"},
+		{money.New(1000, "EUR"), "1", "USD", "10.00 USD"},
+		{money.New(1200, "JPY"), "0.0068", "USD", "8.16 USD"},
+		{money.New(100, "USD"), "147.255", "JPY", "147 JPY"},
+		{money.New(5, "USD"), "0.5", "EUR", "0.03 EUR"},
+		{money.New(-5, "USD"), "0.5", "EUR", "-0.03 EUR"},
+	}
+	for _, tt := range tests {
+		rate, ok := new(big.Rat).SetString(tt.rate)
+		if !ok {
+			t.Fatalf("invalid rate %q", tt.rate)
+		}
+		if got := tt.amount.Convert(rate, tt.currency).String(); got != tt.expected {
+			t.Errorf("Convert(%s at %s): expected %s, got %s", tt.amount, tt.rate, tt.expected, got)
+		}
+	}
+}
+
+func TestParseFormatted(t *testing.T) {
+	tests := []struct {
+		value    string
+		locale   string
+		currency string
+		expected string
+	}{
+		{"$1,234.56", "en-US", "USD", "1234.56 USD"},
+		{"-$1,234.56", "en-US", "USD", "-1234.56 USD"},
+		{"$-1,234.56", "en-US", "USD", "-1234.56 USD"},
+		{"(45.00)", "en-US", "USD", "-45.00 USD"},
+		{"($1,045.00)", "en-US", "USD", "-1045.00 USD"},
+		{"45.00 CR", "en-GB", "GBP", "45.00 GBP"},
+		{"45.00 DR", "en-GB", "GBP", "-45.00 GBP"},
+		{"£45.00Dr", "en-GB", "GBP", "-45.00 GBP"},
+		{"45.00-", "en-US", "USD", "-45.00 USD"},
+		{"1,000", "en-US", "USD", "1000.00 USD"},
+		{"US$ 12.50", "en", "", "12.50"},
+		{"12.50 EUR", "en", "", "12.50 EUR"},
+		{"1.234,56", "de-DE", "EUR", "1234.56 EUR"},
+		{"-1.234,56 €", "de-DE", "EUR", "-1234.56 EUR"},
+		{"1.234,56-", "de-DE", "EUR", "-1234.56 EUR"},
+		{"4,5", "de_AT", "EUR", "4.50 EUR"},
+		{"1 234,56 €", "fr-FR", "EUR", "1234.56 EUR"},
+		{"1\u202f234,56\u00a0€", "fr-FR", "EUR", "1234.56 EUR"},
+		{"\u22121 234,56 kr", "sv-SE", "SEK", "-1234.56 SEK"},
+		{"1'234.56", "de-CH", "CHF", "1234.56 CHF"},
+		{"CHF 1\u2019234.50", "de-CH", "", "1234.50 CHF"},
+		{"¥1,200", "ja-JP", "JPY", "1200 JPY"},
+	}
+	for _, tt := range tests {
+		format, err := money.FormatFor(tt.locale)
+		if err != nil {
+			t.Fatalf("FormatFor(%q) failed: %v", tt.locale, err)
+		}
+		got, _, err := money.ParseFormatted(tt.value, tt.currency, format)
+		if err != nil {
+			t.Errorf("ParseFormatted(%q, %s) failed: %v", tt.value, tt.locale, err)
+			continue
+		}
+		if got.String() != tt.expected {
+			t.Errorf("ParseFormatted(%q, %s): expected %s, got %s", tt.value, tt.locale, tt.expected, got)
+		}
+	}
+}
+
+func TestParseFormatted_Marked(t *testing.T) {
+	tests := map[string]bool{
+		"45.00":    false,
+		"-45.00":   false,
+		"45.00-":   false,
+		"45.00 DR": true,
+		"45.00 CR": true,
+		"(45.00)":  true,
+	}
+	for value, expected := range tests {
+		_, marked, err := money.ParseFormatted(value, "USD", money.Format{Decimal: ".", Group: ","})
+		if err != nil || marked != expected {
+			t.Errorf("ParseFormatted(%q): expected marked %t, got %t (%v)", value, expected, marked, err)
+		}
+	}
+}
+
+func TestParseFormatted_Invalid(t *testing.T) {
+	tests := []struct {
+		value  string
+		locale string
+	}{
+		{"", "en"},
+		{"1.234,56", "en"},
+		{"12,34.56", "en"},
+		{"1,234,5", "en"},
+		{"1.234.56", "de"},
+		{"-(45.00)", "en"},
+		{"45.00- DR", "en"},
+		{"45.00 USD EUR", "en"},
+		{"45.00 dollars", "en"},
+		{"$", "en"},
+	}
+	for _, tt := range tests {
+		format, err := money.FormatFor(tt.locale)
+		if err != nil {
+			t.Fatalf("FormatFor(%q) failed: %v", tt.locale, err)
+		}
+		if got, _, parseErr := money.ParseFormatted(tt.value, "USD", format); parseErr == nil {
+			t.Errorf("Expected ParseFormatted(%q, %s) to fail, got %s", tt.value, tt.locale, got)
+		}
+	}
+
+	if _, _, err := money.ParseFormatted("45.00 EUR", "USD", money.Format{Decimal: "."}); err == nil {
+		t.Error("Expected an amount in EUR to fail for a USD account")
+	}
+	if _, err := money.FormatFor("xx-YY"); err == nil {
+		t.Error("Expected an unknown locale to fail")
+	}
+}
@@ -0,0 +1,486 @@
+// Package mt940parser reads SWIFT MT940 customer statements and MT942 interim transaction reports.
+package mt940parser
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	csvparser "babylon/dataloader/csv"
+	"babylon/dataloader/datalake/datasource"
+	"babylon/dataloader/money"
+)
+
+// Field tags read by the parser.
+const (
+	tagReference       = "20"
+	tagAccount         = "25"
+	tagStatementNumber = "28C"
+	tagFloorLimit      = "34F" // MT942 only
+	tagOpening         = "60F"
+	tagOpeningInterim  = "60M"
+	tagLine            = "61"
+	tagNarrative       = "86"
+	tagClosing         = "62F"
+	tagClosingInterim  = "62M"
+)
+
+// Keys of the records produced by the parser. They line up with the default column mapping.
+const (
+	FieldPostingDate    = "posting date"
+	FieldValueDate      = "value date"
+	FieldAmount         = "amount"
+	FieldCurrency       = "currency"
+	FieldDescription    = "description"
+	FieldDetails        = "details"
+	FieldType           = "type"
+	FieldCheckNum       = "check or slip #"
+	FieldMemo           = "memo"
+	FieldEntryReference = "entry reference"
+	FieldStatementID    = "statement id"
+)
+
+// Kind is reported in csvparser.Statement.Kind.
+const Kind = "mt940"
+
+const (
+	// swiftDateLayout is the YYMMDD date used by balances and statement lines.
+	swiftDateLayout = "060102"
+	// recordDateLayout is the layout posting dates are emitted in.
+	recordDateLayout = "2006-01-02"
+	// noReference is the customer reference used when there is none.
+	noReference = "NONREF"
+	// checkTypeCode is the transaction type of a cheque, whose customer reference is the cheque number.
+	checkTypeCode = "NCHK"
+)
+
+var (
+	// tagPattern matches the start of a field, e.g. ":61:" or ":28C:".
+	tagPattern = regexp.MustCompile(`^:(\d{2}[A-Z]?):`)
+	// linePattern splits the fixed part of a :61: statement line: value date, optional entry
+	// date, debit/credit mark, optional funds code, amount and transaction type.
+	linePattern = regexp.MustCompile(`^(\d{6})(\d{4})?(RC|RD|C|D)([A-Z])?(\d+,\d*)([NFS][A-Z0-9]{3})(.*)$`)
+	// balancePattern splits a balance: debit/credit mark, date, currency and amount.
+	balancePattern = regexp.MustCompile(`^([CD])(\d{6})([A-Z]{3})(\d+,\d*)$`)
+	// numericFields are the record fields written as plain decimals, which are read whatever
+	// the data source's locale.
+	numericFields = map[string]bool{FieldAmount: true}
+)
+
+var (
+	errInvalidMT940 = errors.New("invalid MT940 statement")
+	// errStopReading ends readFields early once ParseInfo has what it needs.
+	errStopReading = errors.New("stop reading")
+)
+
+// InvalidMT940Error is returned when a statement cannot be read.
+func InvalidMT940Error(filePath string, line int64, reason string) error {
+	return fmt.Errorf("%w, %s line %d: %s", errInvalidMT940, filePath, line, reason)
+}
+
+// Parser is a csvparser.Parser for MT940 and MT942 files.
+type Parser struct{}
+
+// NewParser creates a new Parser.
+func NewParser() *Parser {
+	return &Parser{}
+}
+
+// field is one tag and its value, which may span several lines.
+type field struct {
+	tag   string
+	lines []string
+	line  int64
+}
+
+// statementLine is a :61: line waiting for its :86: narrative.
+type statementLine struct {
+	line      int64
+	fields    map[string]string
+	narrative []string
+}
+
+// Parse streams every :61: statement line in the file to handle, together with the
+// :86: narrative that follows it, and reports each statement's balances.
+func (p *Parser) Parse(
+	ctx context.Context,
+	filePath string,
+	_ string,
+	_ string,
+	handle csvparser.RecordHandler,
+) (csvparser.Summary, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return csvparser.Summary{}, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	var (
+		summary   csvparser.Summary
+		statement *csvparser.Statement
+		reference string
+		currency  string
+		pending   *statementLine
+	)
+
+	// emit hands the pending statement line to handle once its narrative, if any, is complete.
+	emit := func() error {
+		if pending == nil {
+			return nil
+		}
+		applyNarrative(pending.fields, pending.narrative)
+		record := csvparser.Record{Line: pending.line, Fields: pending.fields, Numeric: numericFields}
+		pending = nil
+		if handleErr := handle(ctx, record); handleErr != nil {
+			return handleErr
+		}
+		summary.Records++
+		return nil
+	}
+	closeStatement := func() {
+		if statement != nil {
+			summary.Statements = append(summary.Statements, *statement)
+			statement = nil
+		}
+	}
+
+	err = readFields(ctx, file, func(f field) error {
+		if f.tag != tagNarrative {
+			if emitErr := emit(); emitErr != nil {
+				return emitErr
+			}
+		}
+
+		value := strings.Join(f.lines, "\n")
+		switch f.tag {
+		case tagReference:
+			closeStatement()
+			reference = strings.TrimSpace(value)
+			currency = ""
+			statement = &csvparser.Statement{ID: reference, Kind: Kind}
+		case tagAccount:
+			if statement != nil {
+				statement.AccountID = accountIdentification(value)
+			}
+		case tagStatementNumber:
+			if statement != nil {
+				statement.ID = reference + "/" + strings.TrimSpace(value)
+			}
+		case tagFloorLimit:
+			// MT942 reports carry no opening balance; the floor limit names the currency.
+			if currency == "" && len(value) >= 3 {
+				currency = value[:3]
+			}
+		case tagOpening, tagOpeningInterim, tagClosing, tagClosingInterim:
+			balance, balanceErr := parseBalance(value)
+			if balanceErr != nil {
+				return InvalidMT940Error(filePath, f.line, balanceErr.Error())
+			}
+			if f.tag == tagOpening || f.tag == tagOpeningInterim {
+				currency = balance.Amount.Currency
+			}
+			if statement == nil {
+				return nil
+			}
+			if f.tag == tagOpening || f.tag == tagOpeningInterim {
+				statement.Opening = balance
+			} else {
+				statement.Closing = balance
+			}
+		case tagLine:
+			fields, lineErr := parseStatementLine(f.lines, currency)
+			if lineErr != nil {
+				// A statement line that cannot be read is rejected, with its narrative, not the file.
+				reject := csvparser.Record{
+					Line:   f.line,
+					Raw:    ":" + tagLine + ":" + strings.Join(f.lines, "\n"),
+					Reject: csvparser.RejectInvalidEntry,
+					Detail: lineErr.Error(),
+				}
+				if handleErr := handle(ctx, reject); handleErr != nil {
+					return handleErr
+				}
+				summary.Records++
+				return nil
+			}
+			if statement != nil {
+				fields[FieldStatementID] = statement.ID
+			}
+			pending = &statementLine{line: f.line, fields: fields}
+		case tagNarrative:
+			// A :86: after the closing balance describes the statement, not a transaction.
+			if pending != nil {
+				pending.narrative = f.lines
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = emit()
+	}
+	if err != nil {
+		return summary, err
+	}
+	closeStatement()
+
+	return summary, nil
+}
+
+// ParseInfo reads the account of the file's first statement from tag :25:. MT940 does not
+// name the institution in a form that maps to a data source, so DataSource is left empty.
+func (p *Parser) ParseInfo(ctx context.Context, filePath string) (*datasource.SourceInfo, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	var accountID string
+	err = readFields(ctx, file, func(f field) error {
+		switch f.tag {
+		case tagAccount:
+			accountID = accountIdentification(strings.Join(f.lines, ""))
+			return errStopReading
+		case tagLine:
+			// The account always precedes the statement lines.
+			return errStopReading
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopReading) {
+		return nil, err
+	}
+	if accountID == "" {
+		return nil, datasource.ErrUnableToExtractInfo
+	}
+
+	return &datasource.SourceInfo{AccountID: accountID}, nil
+}
+
+// readFields splits the file into tagged fields, skipping the SWIFT block headers and
+// message trailers that wrap block 4, and calls handle with each field once it is complete.
+func readFields(ctx context.Context, file *os.File, handle func(field) error) error {
+	var (
+		current *field
+		line    int64
+	)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("parsing %s was interrupted: %w", file.Name(), ctxErr)
+		}
+		line++
+
+		text := strings.TrimRight(scanner.Text(), "\r ")
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+		if i := strings.Index(text, "{4:"); i >= 0 {
+			text = text[i+len("{4:"):]
+		}
+
+		match := tagPattern.FindStringSubmatch(text)
+		endOfMessage := text == "-" || strings.HasPrefix(text, "-}") || strings.HasPrefix(text, "{")
+		if match == nil && !endOfMessage {
+			if current != nil && text != "" {
+				current.lines = append(current.lines, text)
+			}
+			continue
+		}
+
+		if current != nil {
+			if err := handle(*current); err != nil {
+				return err
+			}
+			current = nil
+		}
+		if match != nil {
+			current = &field{tag: match[1], lines: []string{text[len(match[0]):]}, line: line}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read MT940 from file %s: %w", file.Name(), err)
+	}
+	if current != nil {
+		return handle(*current)
+	}
+	return nil
+}
+
+// parseBalance reads an opening or closing balance, e.g. C230130EUR1000,00.
+func parseBalance(value string) (*csvparser.Balance, error) {
+	match := balancePattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return nil, fmt.Errorf("invalid balance %q", value)
+	}
+	date, err := time.Parse(swiftDateLayout, match[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid balance date %q: %w", match[2], err)
+	}
+	amount, err := parseAmount(match[4], match[3])
+	if err != nil {
+		return nil, err
+	}
+	if match[1] == "D" {
+		amount = amount.Neg()
+	}
+	return &csvparser.Balance{Amount: amount, Date: date.Format(recordDateLayout)}, nil
+}
+
+// parseStatementLine reads a :61: line, in the statement's currency, and its optional
+// supplementary details line.
+func parseStatementLine(lines []string, currency string) (map[string]string, error) {
+	match := linePattern.FindStringSubmatch(strings.TrimSpace(lines[0]))
+	if match == nil {
+		return nil, fmt.Errorf("invalid statement line %q", lines[0])
+	}
+
+	valueDate, err := time.Parse(swiftDateLayout, match[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid value date %q: %w", match[1], err)
+	}
+	postingDate := valueDate
+	if match[2] != "" {
+		postingDate, err = entryDate(valueDate, match[2])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	amount, err := parseAmount(match[5], currency)
+	if err != nil {
+		return nil, err
+	}
+	// A reversal of a credit takes money out, a reversal of a debit puts it back.
+	details := "CREDIT"
+	if match[3] == "D" || match[3] == "RC" {
+		amount, details = amount.Neg(), "DEBIT"
+	}
+
+	typeCode := match[6]
+	customerRef, bankRef, _ := strings.Cut(match[7], "//")
+	checkNum := ""
+	if typeCode == checkTypeCode && customerRef != noReference {
+		checkNum = customerRef
+	}
+
+	fields := map[string]string{
+		FieldPostingDate:    postingDate.Format(recordDateLayout),
+		FieldValueDate:      valueDate.Format(recordDateLayout),
+		FieldAmount:         amount.Decimal(),
+		FieldCurrency:       amount.Currency,
+		FieldDetails:        details,
+		FieldType:           typeCode,
+		FieldCheckNum:       checkNum,
+		FieldEntryReference: strings.TrimSpace(bankRef),
+	}
+	if len(lines) > 1 {
+		fields[FieldMemo] = strings.TrimSpace(strings.Join(lines[1:], " "))
+	}
+	return fields, nil
+}
+
+// entryDate resolves the MMDD booking date of a statement line against its value date,
+// allowing for bookings that fall either side of a year end.
+func entryDate(valueDate time.Time, mmdd string) (time.Time, error) {
+	month, monthErr := strconv.Atoi(mmdd[:2])
+	day, dayErr := strconv.Atoi(mmdd[2:])
+	if monthErr != nil || dayErr != nil || month < 1 || month > 12 {
+		return time.Time{}, fmt.Errorf("invalid entry date %q", mmdd)
+	}
+
+	year := valueDate.Year()
+	switch date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC); {
+	case date.Sub(valueDate) > 180*24*time.Hour:
+		year--
+	case valueDate.Sub(date) > 180*24*time.Hour:
+		year++
+	}
+	// time.Date normalizes days past the end of the month, e.g. 0231 to March 3rd.
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if date.Month() != time.Month(month) || date.Day() != day {
+		return time.Time{}, fmt.Errorf("invalid entry date %q", mmdd)
+	}
+	return date, nil
+}
+
+// parseAmount reads a SWIFT amount, which uses a comma as decimal separator.
+func parseAmount(value string, currency string) (money.Money, error) {
+	return money.Parse(strings.Replace(value, ",", ".", 1), currency)
+}
+
+// applyNarrative maps a :86: narrative onto the record. Structured narratives, as used by
+// German banks, put the counterparty in Description and the purpose in Details; free-text
+// narratives fill both.
+func applyNarrative(fields map[string]string, narrative []string) {
+	if len(narrative) == 0 {
+		return
+	}
+
+	joined := strings.Join(narrative, "")
+	if subfields := structuredNarrative(joined); subfields != nil {
+		purpose := joinSubfields(subfields, "20", "21", "22", "23", "24", "25", "26", "27", "28", "29",
+			"60", "61", "62", "63")
+		if purpose == "" {
+			purpose = subfields["00"]
+		}
+		counterparty := joinSubfields(subfields, "32", "33")
+		if counterparty == "" {
+			counterparty = purpose
+		}
+		fields[FieldDescription] = counterparty
+		fields[FieldDetails] = purpose
+		return
+	}
+
+	text := strings.TrimSpace(strings.Join(narrative, " "))
+	fields[FieldDescription] = text
+	fields[FieldDetails] = text
+}
+
+// structuredNarrative splits a narrative of the form 166?00GUTSCHRIFT?20... into its
+// subfields, or returns nil when the narrative is free text.
+func structuredNarrative(narrative string) map[string]string {
+	if len(narrative) < 4 || narrative[3] != '?' {
+		return nil
+	}
+	if _, err := strconv.Atoi(narrative[:3]); err != nil {
+		return nil
+	}
+
+	subfields := make(map[string]string)
+	for _, part := range strings.Split(narrative[4:], "?") {
+		if len(part) < 2 {
+			continue
+		}
+		subfields[part[:2]] += part[2:]
+	}
+	return subfields
+}
+
+func joinSubfields(subfields map[string]string, keys ...string) string {
+	var parts []string
+	for _, key := range keys {
+		if value := strings.TrimSpace(subfields[key]); value != "" {
+			parts = append(parts, value)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// accountIdentification returns the account identification in :25:, without spaces or line
+// breaks. It is either an IBAN or a bank code and account number separated by a slash.
+func accountIdentification(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(value))
+}
@@ -0,0 +1,193 @@
+package mt940parser_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	csvparser "babylon/dataloader/csv"
+	"babylon/dataloader/datalake/datasource"
+	"babylon/dataloader/money"
+	. "babylon/dataloader/mt940"
+)
+
+const statement940 = `{1:F01BANKDEFFAXXX0000000000}{2:O9401200230131BANKDEFFAXXX00000000002301311200N}{4:
+:20:STARTUMS
+:25:37040044/0532013000
+:28C:00012/001
+:60F:C230130EUR1000,00
+:61:2301310131DR24,50NTRFNONREF//BANKREF1
+SEPA TRANSFER
+:86:166?00SEPA-UEBERWEISUNG?20EREF+INV-42?21Rechnung 42?32Stadtwe
+rke Berlin
+:61:2301310131CR250,NCHK4711
+:86:Salary January ACME GmbH
+:61:230131RC10,00NMSCNONREF
+:62F:C230131EUR1215,50
+:86:Statement narrative
+-}
+`
+
+const report942 = `:20:INTRADAY
+:25:DE89370400440532013000
+:28C:1/1
+:34F:EURD0,
+:13D:2302011200+0100
+:61:2302010201C5,00NTRFNONREF
+:86:Refund
+-
+`
+
+// writeStatement writes an MT940 file to a temporary directory.
+func writeStatement(t *testing.T, content string) string {
+	filePath := filepath.Join(t.TempDir(), "statement.sta")
+	if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write test MT940 file: %v", err)
+	}
+	return filePath
+}
+
+// parseAll runs the parser over filePath and collects every record it yields.
+func parseAll(t *testing.T, filePath string) ([]csvparser.Record, csvparser.Summary) {
+	var records []csvparser.Record
+	summary, err := NewParser().Parse(context.Background(), filePath, "", "",
+		func(_ context.Context, record csvparser.Record) error {
+			records = append(records, record)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	return records, summary
+}
+
+func TestParse_Statement(t *testing.T) {
+	records, summary := parseAll(t, writeStatement(t, statement940))
+	if len(records) != 3 || summary.Records != 3 {
+		t.Fatalf("Expected 3 records, got %d (summary %d)", len(records), summary.Records)
+	}
+
+	tests := []struct {
+		line int64
+		want map[string]string
+	}{
+		{6, map[string]string{
+			FieldPostingDate:    "2023-01-31",
+			FieldValueDate:      "2023-01-31",
+			FieldAmount:         "-24.50",
+			FieldCurrency:       "EUR",
+			FieldDescription:    "Stadtwerke Berlin",
+			FieldDetails:        "EREF+INV-42 Rechnung 42",
+			FieldType:           "NTRF",
+			FieldMemo:           "SEPA TRANSFER",
+			FieldEntryReference: "BANKREF1",
+			FieldStatementID:    "STARTUMS/00012/001",
+		}},
+		{10, map[string]string{
+			FieldAmount:      "250.00",
+			FieldDescription: "Salary January ACME GmbH",
+			FieldDetails:     "Salary January ACME GmbH",
+			FieldCheckNum:    "4711",
+		}},
+		// A reversed credit takes money out of the account.
+		{12, map[string]string{
+			FieldAmount:  "-10.00",
+			FieldDetails: "DEBIT",
+		}},
+	}
+	for i, tt := range tests {
+		if records[i].Line != tt.line {
+			t.Errorf("record %d: expected line %d, got %d", i, tt.line, records[i].Line)
+		}
+		for key, value := range tt.want {
+			if got := records[i].Fields[key]; got != value {
+				t.Errorf("record %d: expected %s %q, got %q", i, key, value, got)
+			}
+		}
+	}
+
+	if len(summary.Statements) != 1 {
+		t.Fatalf("Expected 1 statement, got %d", len(summary.Statements))
+	}
+	statement := summary.Statements[0]
+	if statement.ID != "STARTUMS/00012/001" || statement.AccountID != "37040044/0532013000" {
+		t.Errorf("Unexpected statement %+v", statement)
+	}
+	if statement.Opening == nil || statement.Opening.Amount != money.New(100000, "EUR") ||
+		statement.Closing == nil || statement.Closing.Amount != money.New(121550, "EUR") || statement.Closing.Date != "2023-01-31" {
+		t.Errorf("Unexpected balances %+v / %+v", statement.Opening, statement.Closing)
+	}
+}
+
+func TestParse_Report(t *testing.T) {
+	records, summary := parseAll(t, writeStatement(t, report942))
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(records))
+	}
+	if got := records[0].Fields; got[FieldCurrency] != "EUR" || got[FieldDescription] != "Refund" {
+		t.Errorf("Unexpected record %v", got)
+	}
+	if statement := summary.Statements[0]; statement.Opening != nil || statement.Closing != nil {
+		t.Errorf("Expected an interim report without balances, got %+v", statement)
+	}
+}
+
+func TestParse_EntryDateAcrossYearEnd(t *testing.T) {
+	records, _ := parseAll(t, writeStatement(t, ":20:X\n:25:1234\n:61:2301021231D1,00NTRFNONREF\n"))
+	if got := records[0].Fields[FieldPostingDate]; got != "2022-12-31" {
+		t.Errorf("Expected booking in the previous year, got %s", got)
+	}
+}
+
+func TestParse_InvalidEntryDate(t *testing.T) {
+	records, _ := parseAll(t, writeStatement(t,
+		":20:X\n:25:1234\n:61:2303030231D1,00NTRFNONREF\n:61:2403010229D1,00NTRFNONREF\n"))
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	// February 31st is rejected rather than read as March 3rd.
+	if rejected := records[0]; rejected.Reject != csvparser.RejectInvalidEntry || rejected.Detail == "" {
+		t.Errorf("Expected the line booked on 0231 to be rejected, got %+v", rejected)
+	}
+	if got := records[1].Fields[FieldPostingDate]; got != "2024-02-29" {
+		t.Errorf("Expected a leap day booking on 2024-02-29, got %s", got)
+	}
+}
+
+func TestParse_InvalidLine(t *testing.T) {
+	records, summary := parseAll(t, writeStatement(t,
+		":20:X\n:61:garbage\n:86:Narrative of the bad line\n:61:2301310131D1,00NTRFNONREF\n"))
+	if len(records) != 2 || summary.Records != 2 {
+		t.Fatalf("Expected 2 records, got %d (summary %d)", len(records), summary.Records)
+	}
+	// The malformed statement line is rejected; the file is still read.
+	if rejected := records[0]; rejected.Reject != csvparser.RejectInvalidEntry || rejected.Line != 2 ||
+		rejected.Raw != ":61:garbage" || rejected.Detail == "" {
+		t.Errorf("Expected line 2 to be rejected as an invalid entry, got %+v", rejected)
+	}
+	if valid := records[1]; valid.Reject != "" || valid.Fields[FieldMemo] != "" {
+		t.Errorf("Expected the next line to be read without the rejected line's narrative, got %+v", valid)
+	}
+}
+
+func TestParseInfo(t *testing.T) {
+	tests := map[string]struct {
+		content   string
+		accountID string
+	}{
+		"bank code and account": {statement940, "37040044/0532013000"},
+		"iban":                  {report942, "DE89370400440532013000"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			info, err := NewParser().ParseInfo(context.Background(), writeStatement(t, tt.content))
+			if err != nil {
+				t.Fatalf("ParseInfo failed: %v", err)
+			}
+			if want := (datasource.SourceInfo{AccountID: tt.accountID}); *info != want {
+				t.Errorf("Expected %+v, got %+v", want, *info)
+			}
+		})
+	}
+}
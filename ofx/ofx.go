@@ -0,0 +1,466 @@
+// Package ofxparser reads OFX 1.x (SGML) and 2.x (XML) / QFX bank statements.
+package ofxparser
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	csvparser "babylon/dataloader/csv"
+	"babylon/dataloader/datalake/datasource"
+	"babylon/dataloader/money"
+)
+
+// OFX element names read by the parser.
+const (
+	tagTransaction = "STMTTRN"
+	tagType        = "TRNTYPE"
+	tagPosted      = "DTPOSTED"
+	tagAmount      = "TRNAMT"
+	tagFITID       = "FITID"
+	tagCheckNum    = "CHECKNUM"
+	tagName        = "NAME"
+	tagPayee       = "PAYEE"
+	tagMemo        = "MEMO"
+	tagAccountID   = "ACCTID"
+	tagOrg         = "ORG"
+	tagFID         = "FID"
+	tagCurrency    = "CURDEF"
+	// Statement aggregates of bank and credit card accounts, and their elements.
+	tagStatement     = "STMTRS"
+	tagCardStatement = "CCSTMTRS"
+	tagEnd           = "DTEND"
+	tagLedger        = "LEDGERBAL"
+	tagBalanceAmount = "BALAMT"
+	tagBalanceDate   = "DTASOF"
+)
+
+// KindStatement is the kind reported in csvparser.Statement.Kind.
+const KindStatement = "ofx"
+
+// Keys of the records produced by the parser. They line up with the default column mapping.
+const (
+	FieldPostingDate = "posting date"
+	FieldAmount      = "amount"
+	FieldDescription = "description"
+	FieldDetails     = "details"
+	FieldType        = "type"
+	FieldCheckNum    = "check or slip #"
+	FieldMemo        = "memo"
+	FieldFITID       = "fitid"
+	FieldCurrency    = "currency"
+	FieldStatementID = "statement id"
+)
+
+const (
+	// ofxDateLayout is the date portion of an OFX datetime, e.g. 20240115120000.000[-5:EST].
+	ofxDateLayout = "20060102"
+	// recordDateLayout is the layout posting dates are emitted in.
+	recordDateLayout = "2006-01-02"
+)
+
+// numericFields are the record fields written as plain decimals, which are read whatever
+// the data source's locale.
+var numericFields = map[string]bool{FieldAmount: true}
+
+var errInvalidOFX = errors.New("invalid OFX statement")
+
+// InvalidOFXError is returned when a statement cannot be read.
+func InvalidOFXError(filePath string, reason string) error {
+	return fmt.Errorf("%w, %s: %s", errInvalidOFX, filePath, reason)
+}
+
+// Parser is a csvparser.Parser for OFX and QFX files.
+type Parser struct {
+	// Banks resolves a statement's FI organisation and ID to a data source.
+	Banks *datasource.Registry
+}
+
+// NewParser creates a new Parser that resolves institutions with the built-in bank profiles.
+func NewParser() *Parser {
+	return &Parser{Banks: datasource.DefaultRegistry()}
+}
+
+// Parse streams every STMTTRN aggregate in the file to handle as a record, and reports each
+// STMTRS or CCSTMTRS aggregate as a statement with its ledger balance. Files with
+// statements for more than one account are refused, as their transactions would all be
+// stored under one account.
+func (p *Parser) Parse(
+	ctx context.Context,
+	filePath string,
+	_ string,
+	_ string,
+	handle csvparser.RecordHandler,
+) (csvparser.Summary, error) {
+	accounts, err := accountIDs(ctx, filePath)
+	if err != nil {
+		return csvparser.Summary{}, err
+	}
+	if len(accounts) > 1 {
+		return csvparser.Summary{}, InvalidOFXError(filePath,
+			"statements for more than one account: "+strings.Join(accounts, ", "))
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return csvparser.Summary{}, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	var (
+		summary   csvparser.Summary
+		current   map[string]string
+		line      int64
+		currency  string
+		statement *statementState
+	)
+	tokens := newTokenizer(file)
+	for {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return summary, fmt.Errorf("parsing %s was interrupted: %w", filePath, ctxErr)
+		}
+
+		tok, tokErr := tokens.next()
+		if errors.Is(tokErr, io.EOF) {
+			break
+		}
+		if tokErr != nil {
+			return summary, fmt.Errorf("failed to read OFX from file %s: %w", filePath, tokErr)
+		}
+
+		switch {
+		case tok.name == tagTransaction:
+			current, line = make(map[string]string), tok.line
+		case tok.name == "/"+tagTransaction && current != nil:
+			// A transaction that cannot be read is rejected with its elements, not the file.
+			result := csvparser.Record{Line: line}
+			if record, recordErr := toRecord(current, currency); recordErr != nil {
+				result.Fields, result.Reject, result.Detail = current, csvparser.RejectInvalidEntry, recordErr.Error()
+			} else {
+				if statement != nil {
+					record[FieldStatementID] = statement.id()
+				}
+				result.Fields, result.Numeric = record, numericFields
+			}
+			if handleErr := handle(ctx, result); handleErr != nil {
+				return summary, handleErr
+			}
+			summary.Records++
+			current = nil
+		case current != nil:
+			if tok.text != "" {
+				current[tok.name] = tok.text
+			}
+		case tok.name == tagCurrency:
+			currency = tok.text
+		case tok.name == tagStatement || tok.name == tagCardStatement:
+			statement = &statementState{}
+		case statement != nil && (tok.name == "/"+tagStatement || tok.name == "/"+tagCardStatement):
+			closed, closeErr := statement.close(currency)
+			if closeErr != nil {
+				return summary, InvalidOFXError(filePath, closeErr.Error())
+			}
+			summary.Statements = append(summary.Statements, closed)
+			statement = nil
+		case statement != nil:
+			statement.read(tok)
+		}
+	}
+
+	return summary, nil
+}
+
+// statementState collects a STMTRS or CCSTMTRS aggregate's account, period and ledger
+// balance while its transactions are read.
+type statementState struct {
+	accountID string
+	end       string
+	inLedger  bool
+	balance   string
+	asOf      string
+}
+
+// read takes in an element of the statement outside its transactions.
+func (s *statementState) read(tok token) {
+	switch {
+	case tok.name == tagAccountID && s.accountID == "":
+		s.accountID = tok.text
+	case tok.name == tagEnd:
+		s.end = tok.text
+	case tok.name == tagLedger:
+		s.inLedger = true
+	case tok.name == "/"+tagLedger:
+		s.inLedger = false
+	case tok.name == tagBalanceAmount && s.inLedger:
+		s.balance = tok.text
+	case tok.name == tagBalanceDate && s.inLedger:
+		s.asOf = tok.text
+	}
+}
+
+// id identifies the statement by its account and the end of the period it covers. OFX
+// statements carry no ID of their own.
+func (s *statementState) id() string {
+	if date, err := ofxDate(s.end); err == nil {
+		return s.accountID + ":" + date.Format(recordDateLayout)
+	}
+	return s.accountID
+}
+
+// close returns the statement, with its ledger balance as the closing balance. OFX
+// statements report no opening balance, so they cannot be reconciled.
+func (s *statementState) close(currency string) (csvparser.Statement, error) {
+	statement := csvparser.Statement{ID: s.id(), Kind: KindStatement, AccountID: s.accountID}
+	if s.balance == "" {
+		return statement, nil
+	}
+	amount, err := money.Parse(canonicalAmount(s.balance), currency)
+	if err != nil {
+		return statement, fmt.Errorf("invalid %s %q: %w", tagBalanceAmount, s.balance, err)
+	}
+	statement.Closing = &csvparser.Balance{Amount: amount}
+	if date, dateErr := ofxDate(s.asOf); dateErr == nil {
+		statement.Closing.Date = date.Format(recordDateLayout)
+	}
+	return statement, nil
+}
+
+// accountIDs lists the distinct accounts of the file's statements, in file order.
+func accountIDs(ctx context.Context, filePath string) ([]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	var (
+		accounts      []string
+		inStatement   bool
+		inTransaction bool
+	)
+	tokens := newTokenizer(file)
+	for {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("reading %s was interrupted: %w", filePath, ctxErr)
+		}
+
+		tok, tokErr := tokens.next()
+		if errors.Is(tokErr, io.EOF) {
+			return accounts, nil
+		}
+		if tokErr != nil {
+			return nil, fmt.Errorf("failed to read OFX from file %s: %w", filePath, tokErr)
+		}
+
+		switch tok.name {
+		case tagStatement, tagCardStatement:
+			inStatement = true
+		case "/" + tagStatement, "/" + tagCardStatement:
+			inStatement = false
+		case tagTransaction:
+			inTransaction = true
+		case "/" + tagTransaction:
+			inTransaction = false
+		case tagAccountID:
+			// Transfers name the other account inside the transaction.
+			if inStatement && !inTransaction && !slices.Contains(accounts, tok.text) {
+				accounts = append(accounts, tok.text)
+			}
+		}
+	}
+}
+
+// ParseInfo reads the institution and full account number from the statement header.
+// The data source is the bank profile the FI organisation or ID belongs to, and is empty
+// when the file names no known bank.
+func (p *Parser) ParseInfo(ctx context.Context, filePath string) (*datasource.SourceInfo, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	var org, fid, accountID string
+	tokens := newTokenizer(file)
+	for accountID == "" {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("reading %s was interrupted: %w", filePath, ctxErr)
+		}
+
+		tok, tokErr := tokens.next()
+		if errors.Is(tokErr, io.EOF) {
+			break
+		}
+		if tokErr != nil {
+			return nil, fmt.Errorf("failed to read OFX from file %s: %w", filePath, tokErr)
+		}
+
+		switch tok.name {
+		case tagOrg:
+			org = tok.text
+		case tagFID:
+			fid = tok.text
+		case tagAccountID:
+			accountID = tok.text
+		case tagTransaction:
+			// Account details always precede the transaction list.
+			return nil, datasource.ErrUnableToExtractInfo
+		}
+	}
+
+	if accountID == "" {
+		return nil, datasource.ErrUnableToExtractInfo
+	}
+
+	info := &datasource.SourceInfo{AccountID: accountID}
+	if p.Banks != nil {
+		if profile, ok := p.Banks.MatchInstitution(org, fid); ok {
+			info.DataSource = string(profile.DataSource)
+		}
+	}
+	return info, nil
+}
+
+// toRecord maps the elements of a STMTTRN aggregate to record fields.
+func toRecord(elements map[string]string, currency string) (map[string]string, error) {
+	posted := elements[tagPosted]
+	date, err := ofxDate(posted)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %w", tagPosted, posted, err)
+	}
+
+	description := elements[tagName]
+	if description == "" {
+		description = elements[tagPayee]
+	}
+
+	return map[string]string{
+		FieldPostingDate: date.Format(recordDateLayout),
+		FieldAmount:      canonicalAmount(elements[tagAmount]),
+		FieldDescription: description,
+		FieldDetails:     strings.ToUpper(elements[tagType]),
+		FieldType:        strings.ToUpper(elements[tagType]),
+		FieldCheckNum:    elements[tagCheckNum],
+		FieldMemo:        elements[tagMemo],
+		FieldFITID:       elements[tagFITID],
+		FieldCurrency:    currency,
+	}, nil
+}
+
+// ofxDate reads the date portion of an OFX datetime.
+func ofxDate(value string) (time.Time, error) {
+	if len(value) < len(ofxDateLayout) {
+		return time.Time{}, fmt.Errorf("too short for %s", ofxDateLayout)
+	}
+	return time.Parse(ofxDateLayout, value[:len(ofxDateLayout)])
+}
+
+// canonicalAmount writes an OFX amount with a '.' decimal point. OFX amounts have no group
+// separators, but may use a comma as the decimal point.
+func canonicalAmount(value string) string {
+	return strings.Replace(strings.TrimSpace(value), ",", ".", 1)
+}
+
+// token is a single OFX tag and the text that follows it.
+type token struct {
+	// name is the upper-cased tag name, prefixed with "/" for closing tags.
+	name string
+	// text is the trimmed character data between this tag and the next.
+	text string
+	// line is the line the tag starts on.
+	line int64
+}
+
+// tokenizer splits both SGML and XML OFX into tags. SGML leaf elements are not closed,
+// so each tag's value is whatever text precedes the next tag.
+type tokenizer struct {
+	reader *bufio.Reader
+	line   int64
+}
+
+func newTokenizer(r io.Reader) *tokenizer {
+	return &tokenizer{reader: bufio.NewReader(r), line: 1}
+}
+
+// next returns the next element tag, skipping headers, processing instructions and comments.
+func (t *tokenizer) next() (token, error) {
+	for {
+		// Discard everything up to the next tag, e.g. the SGML header block.
+		if _, err := t.readUntil('<'); err != nil {
+			return token{}, err
+		}
+		line := t.line
+
+		name, err := t.readUntil('>')
+		if err != nil {
+			return token{}, err
+		}
+		name = strings.TrimSpace(strings.TrimSuffix(name, ">"))
+		if name == "" || name[0] == '?' || name[0] == '!' {
+			continue
+		}
+		// Drop any XML attributes and self-closing markers.
+		if fields := strings.Fields(name); len(fields) > 0 {
+			name = strings.TrimSuffix(fields[0], "/")
+		}
+
+		text, err := t.peekText()
+		if err != nil && !errors.Is(err, io.EOF) {
+			return token{}, err
+		}
+
+		return token{name: strings.ToUpper(name), text: text, line: line}, nil
+	}
+}
+
+// readUntil consumes input up to and including delim, tracking line numbers.
+func (t *tokenizer) readUntil(delim byte) (string, error) {
+	chunk, err := t.reader.ReadString(delim)
+	t.line += int64(strings.Count(chunk, "\n"))
+	if err != nil {
+		return chunk, err
+	}
+	return chunk, nil
+}
+
+// peekText consumes the character data before the next tag without consuming the tag.
+func (t *tokenizer) peekText() (string, error) {
+	var builder strings.Builder
+	for {
+		b, err := t.reader.ReadByte()
+		if err != nil {
+			return unescape(strings.TrimSpace(builder.String())), err
+		}
+		if b == '<' {
+			if unreadErr := t.reader.UnreadByte(); unreadErr != nil {
+				return "", fmt.Errorf("failed to unread tag delimiter: %w", unreadErr)
+			}
+			return unescape(strings.TrimSpace(builder.String())), nil
+		}
+		if b == '\n' {
+			t.line++
+		}
+		builder.WriteByte(b)
+	}
+}
+
+// unescape resolves the character entities OFX allows in element values.
+func unescape(value string) string {
+	if !strings.Contains(value, "&") {
+		return value
+	}
+	return strings.NewReplacer(
+		"&amp;", "&",
+		"&lt;", "<",
+		"&gt;", ">",
+		"&quot;", `"`,
+		"&apos;", "'",
+		"&nbsp;", " ",
+	).Replace(value)
+}
@@ -0,0 +1,264 @@
+package ofxparser_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	csvparser "babylon/dataloader/csv"
+	"babylon/dataloader/datalake/datasource"
+	"babylon/dataloader/money"
+	. "babylon/dataloader/ofx"
+)
+
+const sgmlStatement = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+ENCODING:USASCII
+CHARSET:1252
+
+<OFX>
+<SIGNONMSGSRSV1><SONRS><FI><ORG>JPMorgan Chase Bank<FID>10898</FI></SONRS></SIGNONMSGSRSV1>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>USD
+<BANKACCTFROM><BANKID>021000021<ACCTID>000123451234<ACCTTYPE>CHECKING</BANKACCTFROM>
+<BANKTRANLIST>
+<STMTTRN>
+<TRNTYPE>debit
+<DTPOSTED>20230131120000.000[-5:EST]
+<TRNAMT>-4.50
+<FITID>2023013101
+<NAME>Coffee &amp; Bagels
+<MEMO>Card 1234
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CHECK
+<DTPOSTED>20230201
+<TRNAMT>-100.00
+<FITID>2023020101
+<CHECKNUM>101
+<PAYEE>Landlord
+</STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`
+
+const xmlStatement = `<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE"?>
+<OFX>
+  <BANKMSGSRSV1><STMTTRNRS><STMTRS>
+    <CURDEF>EUR</CURDEF>
+    <BANKACCTFROM><ACCTID>9876</ACCTID></BANKACCTFROM>
+    <BANKTRANLIST>
+      <STMTTRN>
+        <TRNTYPE>CREDIT</TRNTYPE>
+        <DTPOSTED>20230315</DTPOSTED>
+        <TRNAMT>1500.00</TRNAMT>
+        <FITID>X1</FITID>
+        <NAME>Salary</NAME>
+      </STMTTRN>
+    </BANKTRANLIST>
+  </STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`
+
+// writeStatement writes an OFX statement to a temporary directory.
+func writeStatement(t *testing.T, filename, content string) string {
+	filePath := filepath.Join(t.TempDir(), filename)
+	if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write test OFX file: %v", err)
+	}
+	return filePath
+}
+
+// parseAll runs the parser over filePath and collects every record it yields.
+func parseAll(t *testing.T, filePath string) []csvparser.Record {
+	var records []csvparser.Record
+	summary, err := NewParser().Parse(context.Background(), filePath, "", "",
+		func(_ context.Context, record csvparser.Record) error {
+			records = append(records, record)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if summary.Records != int64(len(records)) {
+		t.Errorf("Expected summary to count %d records, got %d", len(records), summary.Records)
+	}
+	return records
+}
+
+func TestParse_SGML(t *testing.T) {
+	records := parseAll(t, writeStatement(t, "statement.qfx", sgmlStatement))
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+
+	first := records[0]
+	if first.Line != 13 {
+		t.Errorf("Expected first transaction on line 13, got %d", first.Line)
+	}
+	want := map[string]string{
+		FieldPostingDate: "2023-01-31",
+		FieldAmount:      "-4.50",
+		FieldDescription: "Coffee & Bagels",
+		FieldType:        "DEBIT",
+		FieldMemo:        "Card 1234",
+		FieldFITID:       "2023013101",
+		FieldCurrency:    "USD",
+	}
+	for key, value := range want {
+		if got := first.Fields[key]; got != value {
+			t.Errorf("Expected %s %q, got %q", key, value, got)
+		}
+	}
+
+	second := records[1].Fields
+	if second[FieldDescription] != "Landlord" || second[FieldCheckNum] != "101" {
+		t.Errorf("Expected payee and check number on the check transaction, got %v", second)
+	}
+}
+
+func TestParse_XML(t *testing.T) {
+	records := parseAll(t, writeStatement(t, "statement.ofx", xmlStatement))
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(records))
+	}
+	got := records[0].Fields
+	if got[FieldPostingDate] != "2023-03-15" || got[FieldAmount] != "1500.00" ||
+		got[FieldDescription] != "Salary" || got[FieldCurrency] != "EUR" {
+		t.Errorf("Unexpected record %v", got)
+	}
+}
+
+func TestParse_InvalidDate(t *testing.T) {
+	filePath := writeStatement(t, "bad.ofx", "<OFX>\n<STMTTRN><DTPOSTED>2023<TRNAMT>1.00</STMTTRN>\n"+
+		"<STMTTRN><DTPOSTED>20230131<TRNAMT>2.00</STMTTRN></OFX>")
+	records := parseAll(t, filePath)
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	// The transaction with a truncated DTPOSTED is rejected; the file is still read.
+	if rejected := records[0]; rejected.Reject != csvparser.RejectInvalidEntry || rejected.Line != 2 ||
+		rejected.Detail == "" || rejected.Fields["TRNAMT"] != "1.00" {
+		t.Errorf("Expected line 2 to be rejected as an invalid entry, got %+v", rejected)
+	}
+	if valid := records[1]; valid.Reject != "" || valid.Fields[FieldAmount] != "2.00" {
+		t.Errorf("Expected the next transaction to be read, got %+v", valid)
+	}
+}
+
+func TestParseInfo(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		want    datasource.SourceInfo
+	}{
+		"sgml with org":   {sgmlStatement, datasource.SourceInfo{DataSource: "chase", AccountID: "000123451234"}},
+		"xml without org": {xmlStatement, datasource.SourceInfo{DataSource: "", AccountID: "9876"}},
+		"fid without name": {
+			strings.Replace(sgmlStatement, "JPMorgan Chase Bank", "B1", 1),
+			datasource.SourceInfo{DataSource: "chase", AccountID: "000123451234"},
+		},
+		"unknown org": {
+			strings.Replace(strings.Replace(sgmlStatement, "JPMorgan Chase Bank", "First Community CU", 1), "10898", "4321", 1),
+			datasource.SourceInfo{DataSource: "", AccountID: "000123451234"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			info, err := NewParser().ParseInfo(context.Background(), writeStatement(t, "statement.ofx", tt.content))
+			if err != nil {
+				t.Fatalf("ParseInfo failed: %v", err)
+			}
+			if *info != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, *info)
+			}
+		})
+	}
+}
+
+func TestParseInfo_NoAccount(t *testing.T) {
+	filePath := writeStatement(t, "statement.ofx", "<OFX><STMTTRN><DTPOSTED>20230101</STMTTRN></OFX>")
+	_, err := NewParser().ParseInfo(context.Background(), filePath)
+	if !errors.Is(err, datasource.ErrUnableToExtractInfo) {
+		t.Errorf("Expected ErrUnableToExtractInfo, got %v", err)
+	}
+}
+
+// multiStatement holds two monthly statements of one account, each with its ledger
+// and available balances. The transfer names its destination account.
+const multiStatement = `<OFX><BANKMSGSRSV1>
+<STMTTRNRS><STMTRS><CURDEF>EUR
+<BANKACCTFROM><ACCTID>9876</BANKACCTFROM>
+<BANKTRANLIST><DTSTART>20230301<DTEND>20230331
+<STMTTRN><TRNTYPE>XFER<DTPOSTED>20230315<TRNAMT>-200.00<FITID>X1
+<BANKACCTTO><ACCTID>5555</BANKACCTTO></STMTTRN>
+</BANKTRANLIST>
+<LEDGERBAL><BALAMT>800.00<DTASOF>20230331</LEDGERBAL>
+<AVAILBAL><BALAMT>750.00<DTASOF>20230331</AVAILBAL>
+</STMTRS></STMTTRNRS>
+<STMTTRNRS><STMTRS><CURDEF>EUR
+<BANKACCTFROM><ACCTID>9876</BANKACCTFROM>
+<BANKTRANLIST><DTSTART>20230401<DTEND>20230430
+<STMTTRN><TRNTYPE>CREDIT<DTPOSTED>20230415<TRNAMT>1500,00<FITID>X2</STMTTRN>
+</BANKTRANLIST>
+<LEDGERBAL><BALAMT>2300.00<DTASOF>20230430</LEDGERBAL>
+</STMTRS></STMTTRNRS>
+</BANKMSGSRSV1></OFX>`
+
+func TestParse_Statements(t *testing.T) {
+	var records []csvparser.Record
+	summary, err := NewParser().Parse(context.Background(), writeStatement(t, "statement.ofx", multiStatement), "", "",
+		func(_ context.Context, record csvparser.Record) error {
+			records = append(records, record)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if len(records) != 2 || records[0].Fields[FieldStatementID] != "9876:2023-03-31" ||
+		records[1].Fields[FieldStatementID] != "9876:2023-04-30" {
+		t.Fatalf("Expected one record per statement, got %+v", records)
+	}
+	if len(summary.Statements) != 2 {
+		t.Fatalf("Expected 2 statements, got %+v", summary.Statements)
+	}
+	// Each statement keeps its ledger balance, not the available one.
+	for i, want := range []struct {
+		id      string
+		balance money.Money
+		date    string
+	}{
+		{"9876:2023-03-31", money.New(80000, "EUR"), "2023-03-31"},
+		{"9876:2023-04-30", money.New(230000, "EUR"), "2023-04-30"},
+	} {
+		got := summary.Statements[i]
+		if got.ID != want.id || got.Kind != KindStatement || got.AccountID != "9876" || got.Opening != nil ||
+			got.Closing == nil || got.Closing.Amount != want.balance || got.Closing.Date != want.date {
+			t.Errorf("statement %d: expected %s closing at %v on %s, got %+v", i, want.id, want.balance, want.date, got)
+		}
+	}
+}
+
+func TestParse_RefusesSeveralAccounts(t *testing.T) {
+	content := strings.Replace(multiStatement, "<ACCTID>9876</BANKACCTFROM>\n<BANKTRANLIST><DTSTART>20230401",
+		"<ACCTID>4321</BANKACCTFROM>\n<BANKTRANLIST><DTSTART>20230401", 1)
+	handled := 0
+	_, err := NewParser().Parse(context.Background(), writeStatement(t, "statement.ofx", content), "", "",
+		func(context.Context, csvparser.Record) error {
+			handled++
+			return nil
+		})
+	if err == nil || !strings.Contains(err.Error(), "9876, 4321") {
+		t.Errorf("Expected the file to be refused for naming two accounts, got %v", err)
+	}
+	if handled != 0 {
+		t.Errorf("Expected no records to be handled, got %d", handled)
+	}
+}
@@ -0,0 +1,331 @@
+// Package qifparser reads Quicken Interchange Format (QIF) account exports.
+package qifparser
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	csvparser "babylon/dataloader/csv"
+)
+
+// QIF line codes read by the parser.
+const (
+	codeDate        = 'D'
+	codeAmount      = 'T'
+	codeAmountAlt   = 'U'
+	codePayee       = 'P'
+	codeMemo        = 'M'
+	codeCheckNum    = 'N'
+	codeCategory    = 'L'
+	codeSplitCat    = 'S'
+	codeSplitMemo   = 'E'
+	codeSplitAmount = '$'
+	codeEnd         = '^'
+	codeHeader      = '!'
+)
+
+// Keys of the records produced by the parser. They line up with the default column mapping.
+const (
+	FieldPostingDate = "posting date"
+	FieldAmount      = "amount"
+	FieldDescription = "description"
+	FieldDetails     = "details"
+	FieldCategory    = "category"
+	FieldCheckNum    = "check or slip #"
+	FieldMemo        = "memo"
+)
+
+// recordDateLayout is the layout posting dates are emitted in.
+const recordDateLayout = "2006-01-02"
+
+// bankTypes are the !Type headers whose entries are plain cash transactions. Investment,
+// category, class and memorized-transaction lists are skipped.
+var bankTypes = map[string]bool{
+	"bank":  true,
+	"cash":  true,
+	"ccard": true,
+	"oth a": true,
+	"oth l": true,
+}
+
+var errInvalidQIF = errors.New("invalid QIF file")
+
+// InvalidQIFError is returned when a file cannot be read.
+func InvalidQIFError(filePath string, line int64, reason string) error {
+	return fmt.Errorf("%w, %s line %d: %s", errInvalidQIF, filePath, line, reason)
+}
+
+// Parser is a csvparser.Parser for QIF files.
+type Parser struct{}
+
+// NewParser creates a new Parser.
+func NewParser() *Parser {
+	return &Parser{}
+}
+
+// entry collects the lines of a single QIF transaction.
+type entry struct {
+	line     int64
+	date     string
+	amount   string
+	payee    string
+	memo     string
+	checkNum string
+	category string
+	splits   []split
+	// raw is the entry's original lines, kept in case it is rejected.
+	raw []string
+}
+
+// split is one line of a split transaction.
+type split struct {
+	category string
+	memo     string
+	amount   string
+}
+
+// Parse streams every transaction in the file to handle. A split transaction yields one
+// record per split line, each carrying the parent's date, payee and check number.
+func (p *Parser) Parse(
+	ctx context.Context,
+	filePath string,
+	_ string,
+	_ string,
+	handle csvparser.RecordHandler,
+) (csvparser.Summary, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return csvparser.Summary{}, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	var (
+		summary csvparser.Summary
+		current *entry
+		line    int64
+		// QIF files without a !Type header are treated as bank accounts.
+		inBank = true
+	)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return summary, fmt.Errorf("parsing %s was interrupted: %w", filePath, ctxErr)
+		}
+		line++
+
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		code, value := text[0], strings.TrimSpace(text[1:])
+		if code == codeHeader {
+			// An entry left open by a missing ^ ends where the next section starts.
+			if current != nil {
+				if err = emit(ctx, current, handle, &summary); err != nil {
+					return summary, err
+				}
+				current = nil
+			}
+			inBank = bankSection(value, inBank)
+			continue
+		}
+		if !inBank {
+			continue
+		}
+
+		if current == nil {
+			current = &entry{line: line}
+		}
+		current.raw = append(current.raw, text)
+		if code != codeEnd {
+			current.set(code, value)
+			continue
+		}
+
+		if err = emit(ctx, current, handle, &summary); err != nil {
+			return summary, err
+		}
+		current = nil
+	}
+	if err = scanner.Err(); err != nil {
+		return summary, fmt.Errorf("failed to read QIF from file %s: %w", filePath, err)
+	}
+	// Some exporters leave the ^ off the last entry.
+	if current != nil {
+		if err = emit(ctx, current, handle, &summary); err != nil {
+			return summary, err
+		}
+	}
+
+	return summary, nil
+}
+
+// emit hands an entry's records to handle, counting them in summary. An entry that cannot be
+// read is rejected, not the file.
+func emit(ctx context.Context, e *entry, handle csvparser.RecordHandler, summary *csvparser.Summary) error {
+	records, err := e.records()
+	if err != nil {
+		reject := csvparser.Record{
+			Line:   e.line,
+			Raw:    strings.Join(e.raw, "\n"),
+			Reject: csvparser.RejectInvalidEntry,
+			Detail: err.Error(),
+		}
+		if handleErr := handle(ctx, reject); handleErr != nil {
+			return handleErr
+		}
+		summary.Records++
+		return nil
+	}
+	for _, record := range records {
+		if handleErr := handle(ctx, csvparser.Record{Line: e.line, Fields: record}); handleErr != nil {
+			return handleErr
+		}
+		summary.Records++
+	}
+	return nil
+}
+
+// bankSection reports whether the entries following a header line are cash transactions.
+// Option headers such as !Option:AutoSwitch leave the current section unchanged.
+func bankSection(header string, current bool) bool {
+	kind, value, _ := strings.Cut(header, ":")
+	switch strings.ToLower(kind) {
+	case "type":
+		return bankTypes[strings.ToLower(strings.TrimSpace(value))]
+	case "account":
+		// An !Account block describes the account, not a transaction.
+		return false
+	default:
+		return current
+	}
+}
+
+// set stores the value of a single QIF line.
+func (e *entry) set(code byte, value string) {
+	switch code {
+	case codeDate:
+		e.date = value
+	case codeAmount:
+		e.amount = value
+	case codeAmountAlt:
+		if e.amount == "" {
+			e.amount = value
+		}
+	case codePayee:
+		e.payee = value
+	case codeMemo:
+		e.memo = value
+	case codeCheckNum:
+		e.checkNum = value
+	case codeCategory:
+		e.category = value
+	case codeSplitCat:
+		e.splits = append(e.splits, split{category: value})
+	case codeSplitMemo:
+		if n := len(e.splits); n > 0 {
+			e.splits[n-1].memo = value
+		}
+	case codeSplitAmount:
+		if n := len(e.splits); n > 0 {
+			e.splits[n-1].amount = value
+		}
+	}
+}
+
+// records maps the entry to one record, or one record per split line.
+func (e *entry) records() ([]map[string]string, error) {
+	date, err := parseDate(e.date)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(e.splits) == 0 {
+		return []map[string]string{e.record(date, e.amount, e.category, e.memo, direction(e.amount))}, nil
+	}
+
+	records := make([]map[string]string, 0, len(e.splits))
+	for i, s := range e.splits {
+		memo := s.memo
+		if memo == "" {
+			memo = e.memo
+		}
+		// Splits of one transaction share date and payee, so the details tell them apart.
+		details := fmt.Sprintf("SPLIT %d/%d", i+1, len(e.splits))
+		records = append(records, e.record(date, s.amount, s.category, memo, details))
+	}
+	return records, nil
+}
+
+func (e *entry) record(date string, amount string, category string, memo string, details string) map[string]string {
+	return map[string]string{
+		FieldPostingDate: date,
+		FieldAmount:      amount,
+		FieldDescription: e.payee,
+		FieldDetails:     details,
+		FieldCategory:    category,
+		FieldCheckNum:    e.checkNum,
+		FieldMemo:        memo,
+	}
+}
+
+// parseDate reads the month-first dates Quicken writes, e.g. 1/31/2023, 01/31/23 or 1/31'23,
+// where an apostrophe marks a year in the 2000s.
+func parseDate(value string) (string, error) {
+	normalized := strings.ReplaceAll(value, " ", "")
+	century := 0
+	if strings.Contains(normalized, "'") {
+		century = 2000
+		normalized = strings.ReplaceAll(normalized, "'", "/")
+	}
+	normalized = strings.NewReplacer("-", "/", ".", "/").Replace(normalized)
+
+	parts := strings.Split(normalized, "/")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("invalid date %q", value)
+	}
+	numbers := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return "", fmt.Errorf("invalid date %q: %w", value, err)
+		}
+		numbers[i] = n
+	}
+
+	month, day, year := numbers[0], numbers[1], numbers[2]
+	if len(parts[2]) <= 2 {
+		switch {
+		case century != 0:
+			year += century
+		case year < 70:
+			year += 2000
+		default:
+			year += 1900
+		}
+	}
+
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if date.Month() != time.Month(month) || date.Day() != day {
+		return "", fmt.Errorf("invalid date %q", value)
+	}
+	return date.Format(recordDateLayout), nil
+}
+
+// direction labels an amount the way bank CSV exports do in their details column.
+func direction(amount string) string {
+	if strings.HasPrefix(amount, "-") {
+		return "DEBIT"
+	}
+	return "CREDIT"
+}
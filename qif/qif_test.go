@@ -0,0 +1,192 @@
+package qifparser_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	csvparser "babylon/dataloader/csv"
+	"babylon/dataloader/datalake/mapping"
+	"babylon/dataloader/money"
+	. "babylon/dataloader/qif"
+)
+
+const bankExport = `!Option:AutoSwitch
+!Account
+NChecking
+TBank
+^
+!Option:AutoSwitch
+!Type:Bank
+D1/31'23
+T-1,234.56
+N101
+PLandlord
+MJanuary rent
+LHousing:Rent
+^
+D02/01/2023
+T-150.00
+PSupermarket
+SGroceries
+EFood
+$-100.00
+SHousehold
+$-50.00
+^
+D2/3/99
+T2,000.00
+PEmployer
+^
+!Type:Memorized
+D2/4/2023
+T-1.00
+PIgnored
+^
+`
+
+// writeExport writes a QIF export to a temporary directory.
+func writeExport(t *testing.T, content string) string {
+	filePath := filepath.Join(t.TempDir(), "export.qif")
+	if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write test QIF file: %v", err)
+	}
+	return filePath
+}
+
+func TestParse(t *testing.T) {
+	var records []csvparser.Record
+	summary, err := NewParser().Parse(context.Background(), writeExport(t, bankExport), "", "",
+		func(_ context.Context, record csvparser.Record) error {
+			records = append(records, record)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if summary.Records != 4 || len(records) != 4 {
+		t.Fatalf("Expected 4 records, got %d (summary %d)", len(records), summary.Records)
+	}
+
+	tests := []struct {
+		line int64
+		want map[string]string
+	}{
+		{8, map[string]string{
+			FieldPostingDate: "2023-01-31",
+			FieldAmount:      "-1,234.56",
+			FieldDescription: "Landlord",
+			FieldDetails:     "DEBIT",
+			FieldCategory:    "Housing:Rent",
+			FieldCheckNum:    "101",
+			FieldMemo:        "January rent",
+		}},
+		{15, map[string]string{
+			FieldPostingDate: "2023-02-01",
+			FieldAmount:      "-100.00",
+			FieldDescription: "Supermarket",
+			FieldDetails:     "SPLIT 1/2",
+			FieldCategory:    "Groceries",
+			FieldMemo:        "Food",
+		}},
+		{15, map[string]string{
+			FieldAmount:   "-50.00",
+			FieldDetails:  "SPLIT 2/2",
+			FieldCategory: "Household",
+		}},
+		{24, map[string]string{
+			FieldPostingDate: "1999-02-03",
+			FieldAmount:      "2,000.00",
+			FieldDetails:     "CREDIT",
+		}},
+	}
+
+	for i, tt := range tests {
+		if records[i].Line != tt.line {
+			t.Errorf("record %d: expected line %d, got %d", i, tt.line, records[i].Line)
+		}
+		for key, value := range tt.want {
+			if got := records[i].Fields[key]; got != value {
+				t.Errorf("record %d: expected %s %q, got %q", i, key, value, got)
+			}
+		}
+	}
+}
+
+func TestParse_InvalidDate(t *testing.T) {
+	var records []csvparser.Record
+	_, err := NewParser().Parse(context.Background(),
+		writeExport(t, "!Type:Bank\nD13/45/2023\nT1.00\n^\nD01/31/2023\nT2.00\n^\n"), "", "",
+		func(_ context.Context, record csvparser.Record) error {
+			records = append(records, record)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	// The entry with an invalid date is rejected; the file is still read.
+	if rejected := records[0]; rejected.Reject != csvparser.RejectInvalidEntry || rejected.Line != 2 ||
+		rejected.Raw != "D13/45/2023\nT1.00\n^" || rejected.Detail == "" {
+		t.Errorf("Expected line 2 to be rejected as an invalid entry, got %+v", rejected)
+	}
+	if valid := records[1]; valid.Reject != "" || valid.Fields[FieldAmount] != "2.00" {
+		t.Errorf("Expected the next entry to be read, got %+v", valid)
+	}
+}
+
+func TestParse_UnterminatedEntry(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		want    []string
+	}{
+		"at end of file":       {"!Type:Bank\nD01/30/2023\nT1.00\n^\nD01/31/2023\nT2.00\n", []string{"1.00", "2.00"}},
+		"before a new section": {"!Type:Bank\nD01/31/2023\nT2.00\n!Type:Memorized\nD02/01/2023\nT3.00\n", []string{"2.00"}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var amounts []string
+			summary, err := NewParser().Parse(context.Background(), writeExport(t, tt.content), "", "",
+				func(_ context.Context, record csvparser.Record) error {
+					amounts = append(amounts, record.Fields[FieldAmount])
+					return nil
+				})
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if summary.Records != int64(len(tt.want)) || !slices.Equal(amounts, tt.want) {
+				t.Errorf("Expected amounts %v, got %v (summary %d)", tt.want, amounts, summary.Records)
+			}
+		})
+	}
+}
+
+func TestParse_DecimalComma(t *testing.T) {
+	var records []csvparser.Record
+	_, err := NewParser().Parse(context.Background(), writeExport(t, "!Type:Bank\nD01/31/2023\nT-1.234,56\n^\n"), "", "",
+		func(_ context.Context, record csvparser.Record) error {
+			records = append(records, record)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(records))
+	}
+
+	// The amount is kept as written, for the source's locale to read.
+	profile := mapping.Default().WithDefaults(map[string]mapping.Profile{"bank": {Locale: "de-DE"}}).Resolve("bank")
+	amount, err := profile.Amount(records[0].Fields, "EUR")
+	if err != nil {
+		t.Fatalf("Amount failed: %v", err)
+	}
+	if amount != money.New(-123456, "EUR") {
+		t.Errorf("Expected -1234.56 EUR, got %v", amount)
+	}
+}
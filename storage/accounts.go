@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"babylon/dataloader/datalake/model"
+	"babylon/dataloader/datalake/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AccountsCollection holds the registered accounts.
+const AccountsCollection = "accounts"
+
+// Names of the unique indexes on an account's data source and ID, and on its aliases.
+const (
+	accountIndex      = "dataSource_accountID_unique"
+	accountAliasIndex = "dataSource_aliases_unique"
+)
+
+var (
+	errAccountExists = errors.New("account already registered")
+	errAliasInUse    = errors.New("account alias already in use")
+)
+
+// AccountNotFoundError is returned when no account is registered for a data source and account ID.
+func AccountNotFoundError(dataSource string, accountID string) error {
+	return fmt.Errorf("%w, %s in %s", repository.ErrAccountNotFound, accountID, dataSource)
+}
+
+// AccountExistsError is returned when adding an account that is already registered.
+func AccountExistsError(dataSource string, accountID string) error {
+	return fmt.Errorf("%w, %s in %s", errAccountExists, accountID, dataSource)
+}
+
+// AliasInUseError is returned when an alias already identifies another account.
+func AliasInUseError(dataSource string, alias string, accountID string) error {
+	return fmt.Errorf("%w, %s identifies %s in %s", errAliasInUse, alias, accountID, dataSource)
+}
+
+// AddAccount registers an account. Its ID and aliases must not identify another account.
+func (r *MongoRepository) AddAccount(ctx context.Context, account model.Account) error {
+	collection := r.provider.Collection(AccountsCollection)
+	if err := r.ensureAccountIndexes(ctx, collection); err != nil {
+		return err
+	}
+
+	existing, err := r.FindAccount(ctx, account.DataSource, account.AccountID)
+	if err == nil {
+		return AccountExistsError(existing.DataSource, existing.AccountID)
+	}
+	if !errors.Is(err, repository.ErrAccountNotFound) {
+		return err
+	}
+	aliases, err := r.checkAliases(ctx, account.DataSource, account.AccountID, account.Aliases)
+	if err != nil {
+		return err
+	}
+	account.Aliases = aliases
+
+	now := time.Now().UTC()
+	account.CreatedAt, account.UpdatedAt = now, now
+	_, err = collection.InsertOne(ctx, account)
+	if mongo.IsDuplicateKeyError(err) {
+		return AccountExistsError(account.DataSource, account.AccountID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to insert into %s collection: %w", AccountsCollection, err)
+	}
+
+	return nil
+}
+
+// UpdateAccount replaces the name, type, owner and institution of a registered account. The
+// account is no longer marked as auto-registered.
+func (r *MongoRepository) UpdateAccount(ctx context.Context, account model.Account) error {
+	update := bson.M{"$set": bson.M{
+		"name":           account.Name,
+		"type":           account.Type,
+		"owner":          account.Owner,
+		"institution":    account.Institution,
+		"autoRegistered": false,
+		"updatedAt":      time.Now().UTC(),
+	}}
+	result, err := r.provider.Collection(AccountsCollection).
+		UpdateOne(ctx, accountFilter(account.DataSource, account.AccountID), update)
+	if err != nil {
+		return fmt.Errorf("failed to update account %s in %s: %w", account.AccountID, account.DataSource, err)
+	}
+	if result.MatchedCount == 0 {
+		return AccountNotFoundError(account.DataSource, account.AccountID)
+	}
+
+	return nil
+}
+
+// AddAccountAliases adds identifiers the account is also known by. They are normalized with
+// model.NormalizeAccountAlias, and must not identify another account.
+func (r *MongoRepository) AddAccountAliases(
+	ctx context.Context,
+	dataSource string,
+	accountID string,
+	aliases ...string,
+) error {
+	collection := r.provider.Collection(AccountsCollection)
+	if err := r.ensureAccountIndexes(ctx, collection); err != nil {
+		return err
+	}
+
+	normalized, err := r.checkAliases(ctx, dataSource, accountID, aliases)
+	if err != nil {
+		return err
+	}
+	update := bson.M{
+		"$addToSet": bson.M{"aliases": bson.M{"$each": normalized}},
+		"$set":      bson.M{"updatedAt": time.Now().UTC()},
+	}
+	result, err := collection.UpdateOne(ctx, accountFilter(dataSource, accountID), update)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w, %v in %s", errAliasInUse, normalized, dataSource)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to add aliases to account %s in %s: %w", accountID, dataSource, err)
+	}
+	if result.MatchedCount == 0 {
+		return AccountNotFoundError(dataSource, accountID)
+	}
+
+	return nil
+}
+
+// checkAliases normalizes aliases for an account, failing if one identifies another account.
+func (r *MongoRepository) checkAliases(
+	ctx context.Context,
+	dataSource string,
+	accountID string,
+	aliases []string,
+) ([]string, error) {
+	normalized := make([]string, 0, len(aliases))
+	for _, alias := range aliases {
+		alias = model.NormalizeAccountAlias(alias)
+		existing, err := r.FindAccount(ctx, dataSource, alias)
+		if err == nil && existing.AccountID != accountID {
+			return nil, AliasInUseError(dataSource, alias, existing.AccountID)
+		}
+		if err != nil && !errors.Is(err, repository.ErrAccountNotFound) {
+			return nil, err
+		}
+		normalized = append(normalized, alias)
+	}
+	return normalized, nil
+}
+
+// FindAccount returns the account registered for a data source that an identifier names,
+// either as its account ID or as one of its aliases.
+func (r *MongoRepository) FindAccount(ctx context.Context, dataSource string, accountID string) (model.Account, error) {
+	filter := bson.M{
+		"dataSource": dataSource,
+		"$or": bson.A{
+			bson.M{"accountID": accountID},
+			bson.M{"aliases": model.NormalizeAccountAlias(accountID)},
+		},
+	}
+
+	var account model.Account
+	err := r.provider.Collection(AccountsCollection).
+		FindOne(ctx, filter).
+		Decode(&account)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return model.Account{}, AccountNotFoundError(dataSource, accountID)
+	}
+	if err != nil {
+		return model.Account{}, fmt.Errorf("failed to find account %s in %s: %w", accountID, dataSource, err)
+	}
+
+	return account, nil
+}
+
+// ListAccounts returns every registered account, ordered by data source and account ID.
+func (r *MongoRepository) ListAccounts(ctx context.Context) ([]model.Account, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "dataSource", Value: 1}, {Key: "accountID", Value: 1}})
+	cursor, err := r.provider.Collection(AccountsCollection).Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list accounts: %w", err)
+	}
+
+	var accounts []model.Account
+	if err = cursor.All(ctx, &accounts); err != nil {
+		return nil, fmt.Errorf("failed to decode accounts: %w", err)
+	}
+
+	return accounts, nil
+}
+
+// ensureAccountIndexes creates the unique indexes on an account's data source and ID, and on
+// its aliases, the first time the repository registers an account.
+func (r *MongoRepository) ensureAccountIndexes(ctx context.Context, collection DataStore) error {
+	if _, ok := r.indexed.Load(AccountsCollection); ok {
+		return nil
+	}
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "dataSource", Value: 1}, {Key: "accountID", Value: 1}},
+			Options: options.Index().SetName(accountIndex).SetUnique(true),
+		},
+		{
+			// Accounts without aliases are left out, so they do not collide on a missing key.
+			Keys: bson.D{{Key: "dataSource", Value: 1}, {Key: "aliases", Value: 1}},
+			Options: options.Index().
+				SetName(accountAliasIndex).
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"aliases": bson.M{"$exists": true}}),
+		},
+	}
+	for _, index := range indexes {
+		if _, err := collection.CreateIndex(ctx, index); err != nil {
+			return fmt.Errorf("failed to create index %s on collection %s: %w", *index.Options.Name, AccountsCollection, err)
+		}
+	}
+	r.indexed.Store(AccountsCollection, true)
+
+	return nil
+}
+
+func accountFilter(dataSource string, accountID string) bson.M {
+	return bson.M{"dataSource": dataSource, "accountID": accountID}
+}
@@ -0,0 +1,190 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"babylon/dataloader/datalake/model"
+	"babylon/dataloader/datalake/repository"
+	"babylon/dataloader/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestAddAccount(t *testing.T) {
+	ctx := context.Background()
+	var inserted []model.Account
+	mockDS := &mockDataStore{
+		insertOneFunc: func(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+			account := document.(model.Account)
+			for _, existing := range inserted {
+				if existing.DataSource == account.DataSource && existing.AccountID == account.AccountID {
+					return nil, mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000}}}
+				}
+			}
+			inserted = append(inserted, account)
+			return &mongo.InsertOneResult{}, nil
+		},
+	}
+	repo := storage.NewMongoRepository(&mockCollectionProvider{
+		collectionFunc: func(name string) storage.DataStore {
+			if name != storage.AccountsCollection {
+				t.Errorf("Expected collection %s, got %s", storage.AccountsCollection, name)
+			}
+			return mockDS
+		},
+	})
+
+	account := model.Account{DataSource: "chase", AccountID: "1234", Name: "Joint checking", Type: model.AccountChecking}
+	if err := repo.AddAccount(ctx, account); err != nil {
+		t.Fatalf("AddAccount failed: %v", err)
+	}
+	if len(inserted) != 1 || inserted[0].Name != "Joint checking" || inserted[0].CreatedAt.IsZero() {
+		t.Errorf("Expected the account to be inserted with its creation time, got %+v", inserted)
+	}
+	if err := repo.AddAccount(ctx, account); err == nil {
+		t.Error("Expected an error adding an account twice")
+	}
+
+	if len(mockDS.indexes) != 2 {
+		t.Fatalf("Expected the account and alias indexes to be created once, got %d", len(mockDS.indexes))
+	}
+	for _, index := range mockDS.indexes {
+		if unique := index.Options.Unique; unique == nil || !*unique {
+			t.Errorf("Expected index %s to be unique", *index.Options.Name)
+		}
+	}
+	if mockDS.indexes[1].Options.PartialFilterExpression == nil {
+		t.Error("Expected the alias index to leave out accounts without aliases")
+	}
+}
+
+func TestFindAccount_NotFound(t *testing.T) {
+	repo := storage.NewMongoRepository(&mockCollectionProvider{})
+
+	_, err := repo.FindAccount(context.Background(), "chase", "1234")
+	if !errors.Is(err, repository.ErrAccountNotFound) {
+		t.Errorf("Expected ErrAccountNotFound, got %v", err)
+	}
+}
+
+func TestUpdateAccount(t *testing.T) {
+	ctx := context.Background()
+	var update bson.M
+	mockDS := &mockDataStore{
+		updateOneFunc: func(ctx context.Context, filter interface{}, u interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+			if filter.(bson.M)["accountID"] != "1234" {
+				return &mongo.UpdateResult{}, nil
+			}
+			update = u.(bson.M)["$set"].(bson.M)
+			return &mongo.UpdateResult{MatchedCount: 1}, nil
+		},
+	}
+	repo := storage.NewMongoRepository(&mockCollectionProvider{
+		collectionFunc: func(name string) storage.DataStore { return mockDS },
+	})
+
+	err := repo.UpdateAccount(ctx, model.Account{DataSource: "amex", AccountID: "1234", Type: model.AccountCreditCard})
+	if err != nil {
+		t.Fatalf("UpdateAccount failed: %v", err)
+	}
+	if update["type"] != model.AccountCreditCard || update["autoRegistered"] != false {
+		t.Errorf("Unexpected update %v", update)
+	}
+
+	err = repo.UpdateAccount(ctx, model.Account{DataSource: "amex", AccountID: "9999"})
+	if !errors.Is(err, repository.ErrAccountNotFound) {
+		t.Errorf("Expected ErrAccountNotFound for an unregistered account, got %v", err)
+	}
+}
+
+func TestListAccounts(t *testing.T) {
+	mockDS := &mockDataStore{
+		findFunc: func(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+			return mongo.NewCursorFromDocuments([]interface{}{
+				model.Account{DataSource: "amex", AccountID: "1001", Type: model.AccountCreditCard},
+				model.Account{DataSource: "chase", AccountID: "1234", AutoRegistered: true},
+			}, nil, nil)
+		},
+	}
+	repo := storage.NewMongoRepository(&mockCollectionProvider{
+		collectionFunc: func(name string) storage.DataStore { return mockDS },
+	})
+
+	accounts, err := repo.ListAccounts(context.Background())
+	if err != nil {
+		t.Fatalf("ListAccounts failed: %v", err)
+	}
+	if len(accounts) != 2 || accounts[0].Type != model.AccountCreditCard || !accounts[1].AutoRegistered {
+		t.Errorf("Unexpected accounts %+v", accounts)
+	}
+}
+
+func TestAddAccountAliases(t *testing.T) {
+	ctx := context.Background()
+	accounts := []model.Account{
+		{DataSource: "chase", AccountID: "checking-joint", Aliases: []string{"1234"}},
+		{DataSource: "chase", AccountID: "savings"},
+	}
+	mockDS := &mockDataStore{
+		// Match the identifier filter FindAccount builds against the stored accounts.
+		findOneFunc: func(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
+			or := filter.(bson.M)["$or"].(bson.A)
+			id := or[0].(bson.M)["accountID"]
+			alias := or[1].(bson.M)["aliases"]
+			for _, account := range accounts {
+				if account.AccountID == id || slices.Contains(account.Aliases, alias.(string)) {
+					return mongo.NewSingleResultFromDocument(account, nil, nil)
+				}
+			}
+			return mongo.NewSingleResultFromDocument(bson.M{}, mongo.ErrNoDocuments, nil)
+		},
+		updateOneFunc: func(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+			each := update.(bson.M)["$addToSet"].(bson.M)["aliases"].(bson.M)["$each"].([]string)
+			for i := range accounts {
+				if accounts[i].AccountID == filter.(bson.M)["accountID"] {
+					accounts[i].Aliases = append(accounts[i].Aliases, each...)
+					return &mongo.UpdateResult{MatchedCount: 1}, nil
+				}
+			}
+			return &mongo.UpdateResult{}, nil
+		},
+	}
+	repo := storage.NewMongoRepository(&mockCollectionProvider{
+		collectionFunc: func(name string) storage.DataStore { return mockDS },
+	})
+
+	if err := repo.AddAccountAliases(ctx, "chase", "savings", "XXXX-XXXX-5678"); err != nil {
+		t.Fatalf("AddAccountAliases failed: %v", err)
+	}
+	found, err := repo.FindAccount(ctx, "chase", "****5678")
+	if err != nil {
+		t.Fatalf("FindAccount by masked number failed: %v", err)
+	}
+	if found.AccountID != "savings" {
+		t.Errorf("Expected the masked number to resolve to savings, got %s", found.AccountID)
+	}
+
+	if err = repo.AddAccountAliases(ctx, "chase", "savings", "1234"); err == nil {
+		t.Error("Expected an error adding an alias of another account")
+	}
+}
+
+func TestNormalizeAccountAlias(t *testing.T) {
+	tests := map[string]string{
+		"XXXX-XXXX-1234": "*1234",
+		"****1234":       "*1234",
+		"...1234":        "*1234",
+		"Chk 0012-3456":  "chk00123456",
+		"box12":          "box12",
+	}
+	for identifier, expected := range tests {
+		if got := model.NormalizeAccountAlias(identifier); got != expected {
+			t.Errorf("NormalizeAccountAlias(%q) got %q, want %q", identifier, got, expected)
+		}
+	}
+}
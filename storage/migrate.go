@@ -0,0 +1,312 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"babylon/dataloader/datalake/model"
+	"babylon/dataloader/money"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TransactionCollections lists the transactions collection of every data source.
+func TransactionCollections(ctx context.Context, client MongoClient) ([]string, error) {
+	filter := bson.M{"name": bson.M{"$regex": "^" + TransactionsCollection + "_"}}
+	names, err := client.Database(dbName).ListCollectionNames(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transaction collections: %w", err)
+	}
+	return names, nil
+}
+
+// MigrateMoney rewrites the amounts and balances that were stored as doubles, before amounts
+// were exact, as {minor, currency} documents. The transaction's currency field moves into its
+// amounts. Documents already migrated are left alone, so it is safe to run repeatedly.
+// It returns the number of documents rewritten.
+func MigrateMoney(ctx context.Context, provider CollectionProvider, transactionCollections []string) (int64, error) {
+	return applySteps(ctx, provider, moneySteps(transactionCollections))
+}
+
+// moneySteps converts the amounts of every transaction collection and of the statements.
+func moneySteps(transactionCollections []string) []migrationStep {
+	steps := make([]migrationStep, 0, len(transactionCollections)+1)
+	for _, name := range transactionCollections {
+		steps = append(steps, migrationStep{collection: name, update: transactionMoneyMigration()})
+	}
+	return append(steps, migrationStep{collection: StatementsCollection, update: statementMoneyMigration()})
+}
+
+// MigratePostingDates rewrites posting dates stored as 01/02/2006 strings as BSON dates, keeping
+// the string as rawPostingDate. Strings that are not such a date are left as they are.
+// It returns the number of documents rewritten.
+func MigratePostingDates(
+	ctx context.Context,
+	provider CollectionProvider,
+	transactionCollections []string,
+) (int64, error) {
+	return applySteps(ctx, provider, postingDateSteps(transactionCollections))
+}
+
+// postingDateSteps converts the posting dates of every transaction collection.
+func postingDateSteps(transactionCollections []string) []migrationStep {
+	update := mongo.NewUpdateManyModel().
+		SetFilter(bson.M{"PostingDate": bson.M{"$type": "string"}}).
+		SetUpdate(bson.A{
+			bson.M{"$set": bson.M{
+				"rawPostingDate": "$PostingDate",
+				"PostingDate": bson.M{"$dateFromString": bson.M{
+					"dateString": "$PostingDate",
+					"format":     "%m/%d/%Y",
+					"timezone":   "UTC",
+					"onError":    "$PostingDate",
+				}},
+			}},
+		})
+
+	steps := make([]migrationStep, 0, len(transactionCollections))
+	for _, name := range transactionCollections {
+		steps = append(steps, migrationStep{collection: name, update: update})
+	}
+	return steps
+}
+
+// camelCaseSteps renames the transaction fields stored with a capital letter, and the
+// snake_case fields of the sync log, to camelCase.
+func camelCaseSteps(transactionCollections []string) []migrationStep {
+	rename := func(fields map[string]string) *mongo.UpdateManyModel {
+		exists := make(bson.A, 0, len(fields))
+		for _, old := range slices.Sorted(maps.Keys(fields)) {
+			exists = append(exists, bson.M{old: bson.M{"$exists": true}})
+		}
+		return mongo.NewUpdateManyModel().
+			SetFilter(bson.M{"$or": exists}).
+			SetUpdate(bson.M{"$rename": fields})
+	}
+
+	transactions := rename(map[string]string{
+		"Details":        "details",
+		"PostingDate":    "postingDate",
+		"Description":    "description",
+		"Amount":         "amount",
+		"Type":           "type",
+		"Balance":        "balance",
+		"CheckOrSlipNum": "checkOrSlipNum",
+	})
+	steps := make([]migrationStep, 0, len(transactionCollections)+1)
+	for _, name := range transactionCollections {
+		steps = append(steps, migrationStep{collection: name, update: transactions})
+	}
+	return append(steps, migrationStep{collection: syncTableName, update: rename(map[string]string{
+		"collection_name":  "collectionName",
+		"sync_timestamp":   "syncTimestamp",
+		"records_uploaded": "recordsUploaded",
+	})})
+}
+
+// transactionIDBatchSize is the number of IDs written to a collection at a time.
+const transactionIDBatchSize = 500
+
+// transactionIDSteps gives the transactions loaded before transactions had IDs the ID
+// ingest would derive for them, so that they are upserted by ID alone. Legacy documents were
+// upserted by their details, so each content key's documents are numbered in the order they
+// were inserted, as repeats within a file are.
+func transactionIDSteps(transactionCollections []string) []migrationStep {
+	filter := bson.M{"transactionID": bson.M{"$exists": false}}
+	steps := make([]migrationStep, 0, len(transactionCollections))
+	for _, name := range transactionCollections {
+		steps = append(steps, migrationStep{
+			collection: name,
+			filter:     filter,
+			rewrite: func(ctx context.Context, collection DataStore) (int64, error) {
+				return backfillTransactionIDs(ctx, collection, filter)
+			},
+		})
+	}
+	return steps
+}
+
+// legacyTransaction is a transaction document with its MongoDB ID.
+type legacyTransaction struct {
+	ID                primitive.ObjectID `bson:"_id"`
+	model.Transaction `bson:",inline"`
+}
+
+// backfillTransactionIDs sets the transactionID of the documents filter matches, oldest first.
+func backfillTransactionIDs(ctx context.Context, collection DataStore, filter bson.M) (int64, error) {
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read legacy transactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var (
+		migrated int64
+		models   []mongo.WriteModel
+		seen     = make(map[string]int)
+	)
+	write := func() error {
+		if len(models) == 0 {
+			return nil
+		}
+		result, writeErr := collection.BulkWrite(ctx, models, options.BulkWrite())
+		if writeErr != nil {
+			return writeErr
+		}
+		migrated += result.ModifiedCount
+		models = models[:0]
+		return nil
+	}
+
+	for cursor.Next(ctx) {
+		var doc legacyTransaction
+		if err = cursor.Decode(&doc); err != nil {
+			return migrated, fmt.Errorf("failed to decode legacy transaction: %w", err)
+		}
+		key := model.ContentKey(doc.Transaction)
+		occurrence := seen[key]
+		seen[key]++
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": doc.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"transactionID": model.NewTransactionID(key, occurrence)}}))
+		if len(models) == transactionIDBatchSize {
+			if err = write(); err != nil {
+				return migrated, err
+			}
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		return migrated, fmt.Errorf("failed to read legacy transactions: %w", err)
+	}
+	return migrated, write()
+}
+
+// applySteps applies each step's update to every document of its collection it matches, and
+// returns the number of documents rewritten.
+func applySteps(ctx context.Context, provider CollectionProvider, steps []migrationStep) (int64, error) {
+	var migrated int64
+	for _, step := range steps {
+		collection := provider.Collection(step.collection)
+		if step.rewrite != nil {
+			rewritten, err := step.rewrite(ctx, collection)
+			migrated += rewritten
+			if err != nil {
+				return migrated, fmt.Errorf("failed to migrate collection %s: %w", step.collection, err)
+			}
+			continue
+		}
+		result, err := collection.BulkWrite(ctx, []mongo.WriteModel{step.update}, options.BulkWrite())
+		if err != nil {
+			return migrated, fmt.Errorf("failed to migrate collection %s: %w", step.collection, err)
+		}
+		migrated += result.ModifiedCount
+	}
+	return migrated, nil
+}
+
+// countSteps returns the number of documents the steps would rewrite, without rewriting them.
+func countSteps(ctx context.Context, provider CollectionProvider, steps []migrationStep) (int64, error) {
+	var matched int64
+	for _, step := range steps {
+		var filter any = step.filter
+		if step.update != nil {
+			filter = step.update.Filter
+		}
+		count, err := provider.Collection(step.collection).CountDocuments(ctx, filter)
+		if err != nil {
+			return matched, fmt.Errorf("failed to count documents to migrate in %s: %w", step.collection, err)
+		}
+		matched += count
+	}
+	return matched, nil
+}
+
+// transactionMoneyMigration converts a transaction's Amount and Balance, in its currency.
+func transactionMoneyMigration() *mongo.UpdateManyModel {
+	currency := bson.M{"$toUpper": bson.M{"$ifNull": bson.A{"$currency", ""}}}
+	return mongo.NewUpdateManyModel().
+		SetFilter(bson.M{"$or": bson.A{
+			bson.M{"Amount": bson.M{"$type": "double"}},
+			bson.M{"Balance": bson.M{"$type": "double"}},
+		}}).
+		SetUpdate(bson.A{
+			bson.M{"$set": bson.M{
+				"Amount":  moneyExpr("$Amount", currency),
+				"Balance": moneyExpr("$Balance", currency),
+			}},
+			bson.M{"$unset": "currency"},
+		})
+}
+
+// statementMoneyMigration converts a statement's balances and totals, in its balances' currency.
+func statementMoneyMigration() *mongo.UpdateManyModel {
+	currency := bson.M{"$toUpper": bson.M{"$ifNull": bson.A{
+		"$openingBalance.currency",
+		bson.M{"$ifNull": bson.A{"$closingBalance.currency", ""}},
+	}}}
+	return mongo.NewUpdateManyModel().
+		SetFilter(bson.M{"$or": bson.A{
+			bson.M{"entriesTotal": bson.M{"$type": "double"}},
+			bson.M{"difference": bson.M{"$type": "double"}},
+			bson.M{"openingBalance.amount": bson.M{"$type": "double"}},
+			bson.M{"closingBalance.amount": bson.M{"$type": "double"}},
+		}}).
+		SetUpdate(bson.A{
+			bson.M{"$set": bson.M{
+				"entriesTotal":   moneyExpr("$entriesTotal", currency),
+				"difference":     moneyExpr("$difference", currency),
+				"openingBalance": balanceExpr("$openingBalance"),
+				"closingBalance": balanceExpr("$closingBalance"),
+			}},
+		})
+}
+
+// balanceExpr converts a {amount, currency, date} balance to a {amount, date} one whose
+// amount carries the currency.
+func balanceExpr(path string) bson.M {
+	return bson.M{"$cond": bson.A{
+		bson.M{"$eq": bson.A{bson.M{"$type": path + ".amount"}, "double"}},
+		bson.M{
+			"amount": moneyExpr(path+".amount", bson.M{"$toUpper": bson.M{"$ifNull": bson.A{path + ".currency", ""}}}),
+			"date":   path + ".date",
+		},
+		path,
+	}}
+}
+
+// moneyExpr converts the double at path to a money.Money document, rounding to the minor unit
+// of currency. Values that are not doubles are kept as they are.
+func moneyExpr(path string, currency any) bson.M {
+	return bson.M{"$cond": bson.A{
+		bson.M{"$eq": bson.A{bson.M{"$type": path}, "double"}},
+		bson.M{
+			"minor": bson.M{"$toLong": bson.M{"$round": bson.A{
+				bson.M{"$multiply": bson.A{path, bson.M{"$pow": bson.A{10, exponentExpr(currency)}}}},
+				0,
+			}}},
+			"currency": currency,
+		},
+		path,
+	}}
+}
+
+// exponentExpr looks up the number of minor unit digits of currency.
+func exponentExpr(currency any) bson.M {
+	byExponent := make(map[int][]string)
+	for code, exponent := range money.Exponents() {
+		byExponent[exponent] = append(byExponent[exponent], code)
+	}
+
+	branches := bson.A{}
+	for _, exponent := range slices.Sorted(maps.Keys(byExponent)) {
+		codes := byExponent[exponent]
+		slices.Sort(codes)
+		branches = append(branches, bson.M{"case": bson.M{"$in": bson.A{currency, codes}}, "then": exponent})
+	}
+	return bson.M{"$switch": bson.M{"branches": branches, "default": money.Exponent("")}}
+}
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"babylon/dataloader/datalake/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SchemaMigrationsCollection records the migrations that have been applied to the datalake.
+const SchemaMigrationsCollection = "schemaMigrations"
+
+var errMigrationPending = errors.New("schema migration pending")
+
+// MigrationPendingError is returned when documents stored by an earlier version still need a migration.
+func MigrationPendingError(version int, name string, documents int64) error {
+	return fmt.Errorf("%w, migration %d (%s) would rewrite %d documents; run migrate first",
+		errMigrationPending, version, name, documents)
+}
+
+// Migration upgrades the documents stored by earlier versions of the loader.
+type Migration struct {
+	// Version is the schema version documents are at once the migration has been applied.
+	Version int
+	// Name describes what the migration changes.
+	Name string
+	// steps returns the updates the migration makes, given the transaction collections.
+	steps func(transactionCollections []string) []migrationStep
+}
+
+// migrationStep is an update of every matching document of one collection.
+type migrationStep struct {
+	collection string
+	update     *mongo.UpdateManyModel
+	// rewrite, set instead of update, rewrites the documents filter matches one by one, for
+	// changes an update pipeline cannot compute.
+	filter  bson.M
+	rewrite func(ctx context.Context, collection DataStore) (int64, error)
+}
+
+// Migrations returns the registered migrations, in the order they are applied. The last
+// one's version is model.SchemaVersion.
+func Migrations() []Migration {
+	return []Migration{
+		{Version: 1, Name: "store amounts as exact minor units", steps: moneySteps},
+		{Version: 2, Name: "store posting dates as BSON dates", steps: postingDateSteps},
+		{Version: 3, Name: "rename fields to camelCase", steps: camelCaseSteps},
+		{Version: 4, Name: "give legacy transactions their IDs", steps: transactionIDSteps},
+	}
+}
+
+// MigrationStatus reports whether a migration has been applied.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Documents is the number of documents the migration rewrote or, before it is applied,
+	// would rewrite.
+	Documents int64
+}
+
+// Migrator applies the registered migrations to the datalake's collections.
+type Migrator struct {
+	provider               CollectionProvider
+	transactionCollections []string
+	migrations             []Migration
+}
+
+// NewMigrator creates a Migrator for the given transaction collections.
+func NewMigrator(provider CollectionProvider, transactionCollections []string) *Migrator {
+	return &Migrator{
+		provider:               provider,
+		transactionCollections: transactionCollections,
+		migrations:             Migrations(),
+	}
+}
+
+// Status reports which migrations have been applied.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status, err := m.status(ctx, migration)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Migrate applies the migrations that have not been applied yet, in order, recording each one
+// in SchemaMigrationsCollection. With dryRun, nothing is changed and each pending migration
+// reports the documents it would rewrite. It returns the pending migrations.
+func (m *Migrator) Migrate(ctx context.Context, dryRun bool) ([]MigrationStatus, error) {
+	var pending []MigrationStatus
+	for _, migration := range m.migrations {
+		status, err := m.status(ctx, migration)
+		if err != nil {
+			return pending, err
+		}
+		if status.Applied {
+			continue
+		}
+
+		steps := migration.steps(m.transactionCollections)
+		if dryRun {
+			status.Documents, err = countSteps(ctx, m.provider, steps)
+			pending = append(pending, status)
+			if err != nil {
+				return pending, err
+			}
+			continue
+		}
+
+		status.Documents, err = applySteps(ctx, m.provider, steps)
+		if err == nil {
+			_, err = applySteps(ctx, m.provider, m.versionSteps(migration.Version))
+		}
+		if err != nil {
+			return pending, fmt.Errorf("migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+		}
+		status.Applied, status.AppliedAt = true, time.Now().UTC()
+		record := model.SchemaMigration{
+			Version:   status.Version,
+			Name:      status.Name,
+			AppliedAt: status.AppliedAt,
+			Documents: status.Documents,
+		}
+		if _, err = m.provider.Collection(SchemaMigrationsCollection).InsertOne(ctx, record); err != nil {
+			return pending, fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+		}
+		pending = append(pending, status)
+	}
+	return pending, nil
+}
+
+// Check returns a MigrationPendingError when a migration that has not been applied would
+// rewrite documents. Ingesting next to such documents would not match them, since the
+// repository only reads the current field names and types. Pending migrations with nothing
+// to rewrite, as on a new datalake, do not hold ingestion up.
+func (m *Migrator) Check(ctx context.Context) error {
+	pending, err := m.Migrate(ctx, true)
+	if err != nil {
+		return err
+	}
+	for _, status := range pending {
+		if status.Documents > 0 {
+			return MigrationPendingError(status.Version, status.Name, status.Documents)
+		}
+	}
+	return nil
+}
+
+// status looks up whether a migration has been recorded as applied.
+func (m *Migrator) status(ctx context.Context, migration Migration) (MigrationStatus, error) {
+	status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+
+	var record model.SchemaMigration
+	err := m.provider.Collection(SchemaMigrationsCollection).
+		FindOne(ctx, bson.M{"version": migration.Version}).
+		Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return status, nil
+	}
+	if err != nil {
+		return status, fmt.Errorf("failed to read migration %d: %w", migration.Version, err)
+	}
+
+	status.Applied, status.AppliedAt, status.Documents = true, record.AppliedAt, record.Documents
+	return status, nil
+}
+
+// versionSteps stamps the transactions and statements below a schema version with it.
+func (m *Migrator) versionSteps(version int) []migrationStep {
+	update := mongo.NewUpdateManyModel().
+		SetFilter(bson.M{"schemaVersion": bson.M{"$not": bson.M{"$gte": version}}}).
+		SetUpdate(bson.M{"$set": bson.M{"schemaVersion": version}})
+
+	steps := make([]migrationStep, 0, len(m.transactionCollections)+1)
+	for _, name := range m.transactionCollections {
+		steps = append(steps, migrationStep{collection: name, update: update})
+	}
+	return append(steps, migrationStep{collection: StatementsCollection, update: update})
+}
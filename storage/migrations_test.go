@@ -0,0 +1,227 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"babylon/dataloader/datalake/model"
+	"babylon/dataloader/money"
+	"babylon/dataloader/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migrationStore records the writes made to each collection and the migrations applied.
+type migrationStore struct {
+	applied map[int]model.SchemaMigration
+	writes  map[string]int
+}
+
+func newMigrationStore() *migrationStore {
+	return &migrationStore{applied: make(map[int]model.SchemaMigration), writes: make(map[string]int)}
+}
+
+func (s *migrationStore) provider() *mockCollectionProvider {
+	return &mockCollectionProvider{
+		collectionFunc: func(name string) storage.DataStore {
+			return &mockDataStore{
+				bulkWriteFunc: func(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+					s.writes[name]++
+					return &mongo.BulkWriteResult{ModifiedCount: 1}, nil
+				},
+				countFunc: func(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error) {
+					return 2, nil
+				},
+				insertOneFunc: func(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+					record := document.(model.SchemaMigration)
+					s.applied[record.Version] = record
+					return &mongo.InsertOneResult{}, nil
+				},
+				findOneFunc: func(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
+					record, ok := s.applied[filter.(bson.M)["version"].(int)]
+					if !ok {
+						return mongo.NewSingleResultFromDocument(bson.M{}, mongo.ErrNoDocuments, nil)
+					}
+					return mongo.NewSingleResultFromDocument(record, nil, nil)
+				},
+			}
+		},
+	}
+}
+
+func TestMigrations_EndAtSchemaVersion(t *testing.T) {
+	migrations := storage.Migrations()
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			t.Errorf("Expected migration %d to have version %d, got %d", i, i+1, migration.Version)
+		}
+	}
+	if last := migrations[len(migrations)-1].Version; last != model.SchemaVersion {
+		t.Errorf("Expected the last migration to be version %d, got %d", model.SchemaVersion, last)
+	}
+}
+
+func TestMigrator_DryRunChangesNothing(t *testing.T) {
+	ctx := context.Background()
+	store := newMigrationStore()
+	migrator := storage.NewMigrator(store.provider(), []string{"transactions_chase"})
+
+	pending, err := migrator.Migrate(ctx, true)
+	if err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if len(pending) != model.SchemaVersion {
+		t.Fatalf("Expected every migration to be pending, got %d", len(pending))
+	}
+	if pending[0].Applied || pending[0].Documents != 4 {
+		t.Errorf("Expected the money migration to report 4 documents in 2 collections, got %+v", pending[0])
+	}
+	if len(store.writes) != 0 || len(store.applied) != 0 {
+		t.Errorf("Expected a dry run to write nothing, got writes %v and records %v", store.writes, store.applied)
+	}
+}
+
+func TestMigrator_AppliesPendingMigrationsOnce(t *testing.T) {
+	ctx := context.Background()
+	store := newMigrationStore()
+	store.applied[1] = model.SchemaMigration{Version: 1, Name: "store amounts as exact minor units"}
+	migrator := storage.NewMigrator(store.provider(), []string{"transactions_chase"})
+
+	applied, err := migrator.Migrate(ctx, false)
+	if err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if len(applied) != 3 || applied[0].Version != 2 || applied[2].Version != 4 {
+		t.Fatalf("Expected migrations 2 to 4 to be applied, got %+v", applied)
+	}
+	if _, ok := store.applied[4]; !ok {
+		t.Error("Expected migration 4 to be recorded")
+	}
+	// Migrations 2 and 3 each update the collection and stamp its schema version. Migration 4
+	// finds no legacy transactions, so it only stamps the version.
+	if store.writes["transactions_chase"] != 5 {
+		t.Errorf("Expected 5 writes to transactions_chase, got %d", store.writes["transactions_chase"])
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	for _, status := range statuses {
+		if !status.Applied {
+			t.Errorf("Expected migration %d to be applied, got %+v", status.Version, status)
+		}
+	}
+
+	if applied, err = migrator.Migrate(ctx, false); err != nil || len(applied) != 0 {
+		t.Errorf("Expected nothing left to migrate, got %+v (%v)", applied, err)
+	}
+}
+
+func TestMigrator_CheckRefusesPendingDocuments(t *testing.T) {
+	ctx := context.Background()
+	store := newMigrationStore()
+	store.applied[1] = model.SchemaMigration{Version: 1, Name: "store amounts as exact minor units"}
+	migrator := storage.NewMigrator(store.provider(), []string{"transactions_chase"})
+
+	err := migrator.Check(ctx)
+	want := storage.MigrationPendingError(2, "store posting dates as BSON dates", 2)
+	if err == nil || err.Error() != want.Error() {
+		t.Fatalf("Expected %v, got %v", want, err)
+	}
+	if len(store.writes) != 0 {
+		t.Errorf("Expected Check to write nothing, got %v", store.writes)
+	}
+
+	// Migrations with nothing to rewrite, as on a new datalake, do not block ingestion.
+	empty := storage.NewMigrator(&mockCollectionProvider{}, []string{"transactions_chase"})
+	if err = empty.Check(ctx); err != nil {
+		t.Errorf("Expected no error without documents to migrate, got %v", err)
+	}
+}
+
+func TestMigrator_BackfillsTransactionIDs(t *testing.T) {
+	ctx := context.Background()
+	store := newMigrationStore()
+	for version := 1; version < model.SchemaVersion; version++ {
+		store.applied[version] = model.SchemaMigration{Version: version}
+	}
+
+	posted := time.Date(2023, time.January, 31, 0, 0, 0, 0, time.UTC)
+	coffee := model.Transaction{
+		DataSource:  "chase",
+		AccountID:   "1234",
+		PostingDate: posted,
+		Description: "COFFEE",
+		Amount:      money.New(-450, "USD"),
+	}
+	books := coffee
+	books.Description = "BOOKS"
+	legacy := make([]any, 0, 3)
+	ids := make([]primitive.ObjectID, 0, 3)
+	for _, transaction := range []model.Transaction{coffee, books, coffee} {
+		id := primitive.NewObjectID()
+		ids = append(ids, id)
+		doc, err := bson.Marshal(transaction)
+		if err != nil {
+			t.Fatalf("failed to encode transaction: %v", err)
+		}
+		var fields bson.M
+		if err = bson.Unmarshal(doc, &fields); err != nil {
+			t.Fatalf("failed to decode transaction: %v", err)
+		}
+		delete(fields, "transactionID")
+		fields["_id"] = id
+		legacy = append(legacy, fields)
+	}
+
+	set := make(map[primitive.ObjectID]string)
+	provider := store.provider()
+	storeCollection := provider.collectionFunc
+	provider.collectionFunc = func(name string) storage.DataStore {
+		if name != "transactions_chase" {
+			return storeCollection(name)
+		}
+		return &mockDataStore{
+			findFunc: func(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+				return mongo.NewCursorFromDocuments(legacy, nil, nil)
+			},
+			bulkWriteFunc: func(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+				for _, writeModel := range models {
+					update, ok := writeModel.(*mongo.UpdateOneModel)
+					if !ok {
+						continue
+					}
+					id := update.Filter.(bson.M)["_id"].(primitive.ObjectID)
+					set[id] = update.Update.(bson.M)["$set"].(bson.M)["transactionID"].(string)
+				}
+				return &mongo.BulkWriteResult{ModifiedCount: int64(len(models))}, nil
+			},
+		}
+	}
+
+	applied, err := storage.NewMigrator(provider, []string{"transactions_chase"}).Migrate(ctx, false)
+	if err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if len(applied) != 1 || applied[0].Documents != 3 {
+		t.Fatalf("Expected 3 legacy transactions to be given IDs, got %+v", applied)
+	}
+
+	// The IDs are the ones ingest derives, repeats numbered in the order they were inserted.
+	coffeeKey, booksKey := model.ContentKey(coffee), model.ContentKey(books)
+	want := []string{
+		model.NewTransactionID(coffeeKey, 0),
+		model.NewTransactionID(booksKey, 0),
+		model.NewTransactionID(coffeeKey, 1),
+	}
+	for i, id := range ids {
+		if set[id] != want[i] {
+			t.Errorf("document %d: expected ID %s, got %q", i, want[i], set[id])
+		}
+	}
+}
@@ -27,6 +27,27 @@ type DataStore interface {
 		ctx context.Context,
 		document interface{},
 		opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error)
+	CreateIndex(
+		ctx context.Context,
+		index mongo.IndexModel,
+		opts ...*options.CreateIndexesOptions) (string, error)
+	FindOne(
+		ctx context.Context,
+		filter interface{},
+		opts ...*options.FindOneOptions) *mongo.SingleResult
+	CountDocuments(
+		ctx context.Context,
+		filter interface{},
+		opts ...*options.CountOptions) (int64, error)
+	Find(
+		ctx context.Context,
+		filter interface{},
+		opts ...*options.FindOptions) (*mongo.Cursor, error)
+	UpdateOne(
+		ctx context.Context,
+		filter interface{},
+		update interface{},
+		opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
 }
 
 // CollectionProvider defines the interface for obtaining a collection.
@@ -67,6 +88,20 @@ func (c *MongoCollection) InsertOne(
 	return result, nil
 }
 
+// CreateIndex creates an index, doing nothing if an identical one exists.
+func (c *MongoCollection) CreateIndex(
+	ctx context.Context,
+	index mongo.IndexModel,
+	opts ...*options.CreateIndexesOptions,
+) (string, error) {
+	name, err := c.Collection.Indexes().CreateOne(ctx, index, opts...)
+	if err != nil {
+		return "", fmt.Errorf("failed to perform CreateIndex: %w", err)
+	}
+
+	return name, nil
+}
+
 // MongoProvider adapts *mongo.Client to CollectionProvider.
 type MongoProvider struct {
 	client MongoClient
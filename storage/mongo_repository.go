@@ -2,7 +2,9 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"babylon/dataloader/datalake/model"
@@ -14,12 +16,26 @@ import (
 
 const (
 	TransactionsCollection = "transactions"
+	StatementsCollection   = "statements"
 	syncTableName          = "dataSync"
 )
 
+var errTransactionNotFound = errors.New("transaction not found")
+
+// TransactionNotFoundError is returned when a data source has no transaction with an ID.
+func TransactionNotFoundError(dataSource string, transactionID string) error {
+	return fmt.Errorf("%w, %s in %s_%s", errTransactionNotFound, transactionID, TransactionsCollection, dataSource)
+}
+
+// transactionIDIndex is the name of the unique index on transactionID.
+const transactionIDIndex = "transactionID_unique"
+
 // MongoRepository implements the datalake.Repository interface for MongoDB.
 type MongoRepository struct {
 	provider CollectionProvider
+
+	// indexed records the transaction collections whose indexes have been created.
+	indexed sync.Map
 }
 
 // NewMongoRepository creates a new MongoRepository.
@@ -41,19 +57,17 @@ func (r *MongoRepository) BulkUpsertTransactions(ctx context.Context, transactio
 
 	var models []mongo.WriteModel
 	for _, doc := range transactions {
-		filter := bson.M{
-			"Details":     doc.Details,
-			"PostingDate": doc.PostingDate,
-			"Description": doc.Description,
-			"dataSource":  doc.DataSource,
-			"accountID":   doc.AccountID,
-		}
+		// Documents loaded before transactions had IDs are given theirs by migration 4.
+		filter := bson.M{"transactionID": doc.TransactionID}
 		update := bson.M{"$set": doc}
 		models = append(models, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(true))
 	}
 
 	collectionName := fmt.Sprintf("%s_%s", TransactionsCollection, dataSource)
 	collection := r.provider.Collection(collectionName)
+	if err := r.ensureTransactionIndexes(ctx, collectionName, collection); err != nil {
+		return err
+	}
 	_, err := collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
 	if err != nil {
 		return fmt.Errorf("failed to perform bulk write for collection %s: %w", collectionName, err)
@@ -73,3 +87,73 @@ func (r *MongoRepository) BulkUpsertTransactions(ctx context.Context, transactio
 
 	return nil
 }
+
+// ensureTransactionIndexes creates the unique transactionID index of a transactions
+// collection the first time the repository writes to it. The index leaves out documents
+// loaded before transactions had IDs that have not been migrated yet.
+func (r *MongoRepository) ensureTransactionIndexes(ctx context.Context, name string, collection DataStore) error {
+	if _, ok := r.indexed.Load(name); ok {
+		return nil
+	}
+
+	index := mongo.IndexModel{
+		Keys: bson.D{{Key: "transactionID", Value: 1}},
+		Options: options.Index().
+			SetName(transactionIDIndex).
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"transactionID": bson.M{"$type": "string"}}),
+	}
+	if _, err := collection.CreateIndex(ctx, index); err != nil {
+		return fmt.Errorf("failed to create index %s on collection %s: %w", transactionIDIndex, name, err)
+	}
+	r.indexed.Store(name, true)
+
+	return nil
+}
+
+// FindTransaction returns the transaction of a data source with the given ID.
+func (r *MongoRepository) FindTransaction(
+	ctx context.Context,
+	dataSource string,
+	transactionID string,
+) (model.Transaction, error) {
+	collectionName := fmt.Sprintf("%s_%s", TransactionsCollection, dataSource)
+	result := r.provider.Collection(collectionName).FindOne(ctx, bson.M{"transactionID": transactionID})
+
+	var transaction model.Transaction
+	err := result.Decode(&transaction)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return model.Transaction{}, TransactionNotFoundError(dataSource, transactionID)
+	}
+	if err != nil {
+		return model.Transaction{}, fmt.Errorf("failed to find transaction %s in %s: %w", transactionID, collectionName, err)
+	}
+
+	return transaction, nil
+}
+
+// UpsertStatements upserts statement balances into the MongoDB "statements" collection,
+// keyed by data source, account and statement ID.
+func (r *MongoRepository) UpsertStatements(ctx context.Context, statements []model.Statement) error {
+	if len(statements) == 0 {
+		return nil
+	}
+
+	models := make([]mongo.WriteModel, 0, len(statements))
+	for _, doc := range statements {
+		filter := bson.M{
+			"dataSource":  doc.DataSource,
+			"accountID":   doc.AccountID,
+			"statementID": doc.StatementID,
+		}
+		update := bson.M{"$set": doc}
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(true))
+	}
+
+	collection := r.provider.Collection(StatementsCollection)
+	if _, err := collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+		return fmt.Errorf("failed to perform bulk write for collection %s: %w", StatementsCollection, err)
+	}
+
+	return nil
+}
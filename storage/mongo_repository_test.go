@@ -3,12 +3,15 @@ package storage_test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"babylon/dataloader/datalake/model"
 	"babylon/dataloader/storage"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -17,6 +20,11 @@ import (
 type mockDataStore struct {
 	bulkWriteFunc func(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error)
 	insertOneFunc func(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error)
+	findOneFunc   func(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult
+	countFunc     func(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error)
+	findFunc      func(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error)
+	updateOneFunc func(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	indexes       []mongo.IndexModel
 }
 
 func (m *mockDataStore) BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
@@ -33,6 +41,39 @@ func (m *mockDataStore) InsertOne(ctx context.Context, document interface{}, opt
 	return &mongo.InsertOneResult{}, nil
 }
 
+func (m *mockDataStore) CreateIndex(ctx context.Context, index mongo.IndexModel, opts ...*options.CreateIndexesOptions) (string, error) {
+	m.indexes = append(m.indexes, index)
+	return "", nil
+}
+
+func (m *mockDataStore) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
+	if m.findOneFunc != nil {
+		return m.findOneFunc(ctx, filter, opts...)
+	}
+	return mongo.NewSingleResultFromDocument(bson.M{}, mongo.ErrNoDocuments, nil)
+}
+
+func (m *mockDataStore) CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error) {
+	if m.countFunc != nil {
+		return m.countFunc(ctx, filter, opts...)
+	}
+	return 0, nil
+}
+
+func (m *mockDataStore) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	if m.findFunc != nil {
+		return m.findFunc(ctx, filter, opts...)
+	}
+	return mongo.NewCursorFromDocuments(nil, nil, nil)
+}
+
+func (m *mockDataStore) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	if m.updateOneFunc != nil {
+		return m.updateOneFunc(ctx, filter, update, opts...)
+	}
+	return &mongo.UpdateResult{}, nil
+}
+
 // Mock for CollectionProvider interface.
 type mockCollectionProvider struct {
 	collectionFunc func(name string) storage.DataStore
@@ -56,8 +97,8 @@ func TestNewMongoRepository(t *testing.T) {
 func TestBulkUpsertTransactions_Success(t *testing.T) {
 	ctx := context.Background()
 	transactions := []model.Transaction{
-		{Details: "Test1", PostingDate: "2024-01-01", DataSource: "synthetic", AccountID: "123"},
-		{Details: "Test2", PostingDate: "2024-01-02", DataSource: "synthetic", AccountID: "123"},
+		{Details: "Test1", PostingDate: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC), DataSource: "synthetic", AccountID: "123"},
+		{Details: "Test2", PostingDate: time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC), DataSource: "synthetic", AccountID: "123"},
 	}
 
 	mockDS := &mockDataStore{
@@ -98,6 +139,82 @@ func TestBulkUpsertTransactions_Success(t *testing.T) {
 	}
 }
 
+func TestBulkUpsertTransactions_UpsertsByTransactionID(t *testing.T) {
+	ctx := context.Background()
+	transactions := []model.Transaction{
+		{TransactionID: "a1", Details: "DEBIT", DataSource: "synthetic", AccountID: "123"},
+	}
+
+	var filters []interface{}
+	mockDS := &mockDataStore{
+		bulkWriteFunc: func(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+			for _, writeModel := range models {
+				filters = append(filters, writeModel.(*mongo.UpdateOneModel).Filter)
+			}
+			return &mongo.BulkWriteResult{}, nil
+		},
+	}
+	repo := storage.NewMongoRepository(&mockCollectionProvider{
+		collectionFunc: func(name string) storage.DataStore { return mockDS },
+	})
+
+	// The index is created once per collection, however many batches are written.
+	for range 2 {
+		if err := repo.BulkUpsertTransactions(ctx, transactions); err != nil {
+			t.Fatalf("BulkUpsertTransactions failed: %v", err)
+		}
+	}
+	if len(mockDS.indexes) != 1 {
+		t.Fatalf("Expected 1 index to be created, got %d", len(mockDS.indexes))
+	}
+	if keys := mockDS.indexes[0].Keys.(bson.D); keys[0].Key != "transactionID" || !*mockDS.indexes[0].Options.Unique {
+		t.Errorf("Expected a unique index on transactionID, got %+v", mockDS.indexes[0])
+	}
+
+	// Legacy documents are given IDs by migration, so the upsert matches on the ID alone.
+	if filter := filters[0].(bson.M); len(filter) != 1 || filter["transactionID"] != "a1" {
+		t.Errorf("Expected the upsert to match only transactionID a1, got %v", filter)
+	}
+}
+
+func TestFindTransaction(t *testing.T) {
+	ctx := context.Background()
+	stored := model.Transaction{
+		TransactionID: "a1",
+		DataSource:    "chase",
+		Lineage:       model.Lineage{SourceFile: "chase1234.csv", Line: 7, RunID: "run-1"},
+	}
+
+	mockDS := &mockDataStore{
+		findOneFunc: func(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
+			if filter.(bson.M)["transactionID"] != "a1" {
+				return mongo.NewSingleResultFromDocument(bson.M{}, mongo.ErrNoDocuments, nil)
+			}
+			return mongo.NewSingleResultFromDocument(stored, nil, nil)
+		},
+	}
+	repo := storage.NewMongoRepository(&mockCollectionProvider{
+		collectionFunc: func(name string) storage.DataStore {
+			if name != "transactions_chase" {
+				t.Errorf("Expected collection transactions_chase, got %s", name)
+			}
+			return mockDS
+		},
+	})
+
+	found, err := repo.FindTransaction(ctx, "chase", "a1")
+	if err != nil {
+		t.Fatalf("FindTransaction failed: %v", err)
+	}
+	if found.Lineage != stored.Lineage {
+		t.Errorf("Expected lineage %+v, got %+v", stored.Lineage, found.Lineage)
+	}
+
+	if _, err = repo.FindTransaction(ctx, "chase", "missing"); err == nil || !strings.Contains(err.Error(), "transaction not found") {
+		t.Errorf("Expected a transaction not found error, got %v", err)
+	}
+}
+
 func TestBulkUpsertTransactions_EmptyTransactions(t *testing.T) {
 	ctx := context.Background()
 	repo := storage.NewMongoRepository(&mockCollectionProvider{})
@@ -110,7 +227,7 @@ func TestBulkUpsertTransactions_EmptyTransactions(t *testing.T) {
 func TestBulkUpsertTransactions_BulkWriteError(t *testing.T) {
 	ctx := context.Background()
 	transactions := []model.Transaction{
-		{Details: "Test1", PostingDate: "2024-01-01", DataSource: "synthetic", AccountID: "123"},
+		{Details: "Test1", PostingDate: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC), DataSource: "synthetic", AccountID: "123"},
 	}
 	expectedErr := errors.New("bulk write error")
 
@@ -136,7 +253,7 @@ func TestBulkUpsertTransactions_BulkWriteError(t *testing.T) {
 func TestBulkUpsertTransactions_SyncLogError(t *testing.T) {
 	ctx := context.Background()
 	transactions := []model.Transaction{
-		{Details: "Test1", PostingDate: "2024-01-01", DataSource: "synthetic", AccountID: "123"},
+		{Details: "Test1", PostingDate: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC), DataSource: "synthetic", AccountID: "123"},
 	}
 	expectedErr := errors.New("sync log error")
 
@@ -161,3 +278,99 @@ func TestBulkUpsertTransactions_SyncLogError(t *testing.T) {
 		t.Errorf("Expected sync log error, got: %v", err)
 	}
 }
+
+func TestUpsertStatements_Success(t *testing.T) {
+	ctx := context.Background()
+	statements := []model.Statement{
+		{StatementID: "S1", DataSource: "generic", AccountID: "3000", Reconciled: true},
+	}
+
+	var collectionName string
+	mockDS := &mockDataStore{
+		bulkWriteFunc: func(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+			if len(models) != 1 {
+				t.Errorf("Expected 1 write model, got %d", len(models))
+			}
+			return &mongo.BulkWriteResult{UpsertedCount: 1}, nil
+		},
+	}
+
+	provider := &mockCollectionProvider{
+		collectionFunc: func(name string) storage.DataStore {
+			collectionName = name
+			return mockDS
+		},
+	}
+
+	repo := storage.NewMongoRepository(provider)
+	if err := repo.UpsertStatements(ctx, statements); err != nil {
+		t.Errorf("UpsertStatements failed: %v", err)
+	}
+	if collectionName != storage.StatementsCollection {
+		t.Errorf("Expected collection %s, got %s", storage.StatementsCollection, collectionName)
+	}
+}
+
+func TestMigrateMoney(t *testing.T) {
+	ctx := context.Background()
+
+	var collections []string
+	provider := &mockCollectionProvider{
+		collectionFunc: func(name string) storage.DataStore {
+			collections = append(collections, name)
+			return &mockDataStore{
+				bulkWriteFunc: func(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+					if len(models) != 1 {
+						t.Errorf("Expected 1 write model for %s, got %d", name, len(models))
+					}
+					if _, ok := models[0].(*mongo.UpdateManyModel); !ok {
+						t.Errorf("Expected an update of every matching document in %s, got %T", name, models[0])
+					}
+					return &mongo.BulkWriteResult{ModifiedCount: 2}, nil
+				},
+			}
+		},
+	}
+
+	migrated, err := storage.MigrateMoney(ctx, provider, []string{"transactions_chase", "transactions_dkb"})
+	if err != nil {
+		t.Fatalf("MigrateMoney failed: %v", err)
+	}
+	if migrated != 6 {
+		t.Errorf("Expected 6 documents migrated, got %d", migrated)
+	}
+	expected := []string{"transactions_chase", "transactions_dkb", storage.StatementsCollection}
+	if strings.Join(collections, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected collections %v, got %v", expected, collections)
+	}
+}
+
+func TestMigratePostingDates(t *testing.T) {
+	ctx := context.Background()
+
+	provider := &mockCollectionProvider{
+		collectionFunc: func(name string) storage.DataStore {
+			return &mockDataStore{
+				bulkWriteFunc: func(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+					update, ok := models[0].(*mongo.UpdateManyModel)
+					if !ok {
+						t.Fatalf("Expected an update of every matching document in %s, got %T", name, models[0])
+					}
+					filter, ok := update.Filter.(bson.M)
+					if !ok || fmt.Sprint(filter["PostingDate"]) != "map[$type:string]" {
+						t.Errorf("Expected only string posting dates to be matched, got %v", update.Filter)
+					}
+					return &mongo.BulkWriteResult{ModifiedCount: 3}, nil
+				},
+			}
+		},
+	}
+
+	migrated, err := storage.MigratePostingDates(ctx, provider, []string{"transactions_chase", "transactions_dkb"})
+	if err != nil {
+		t.Fatalf("MigratePostingDates failed: %v", err)
+	}
+	if migrated != 6 {
+		t.Errorf("Expected 6 documents migrated, got %d", migrated)
+	}
+}
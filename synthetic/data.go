@@ -10,45 +10,51 @@ import (
 	"time"
 
 	bcontext "babylon/dataloader/appcontext"
+	"babylon/dataloader/datalake/model"
+	"babylon/dataloader/money"
 	"babylon/dataloader/storage"
 )
 
 const (
-	// Max amount for random account ID generation.
-	maxAmount = 1000
-	// Max balance for random account ID generation.
-	maxBalance = 10000
+	// Max amount, in cents, for random amount generation.
+	maxAmount = 1000_00
+	// Max balance, in cents, for random balance generation.
+	maxBalance = 10000_00
 	// Max value for random account ID generation.
 	maxAccountID = 10000
 )
 
 // Data represents a single row from the CSV file.
 type Data struct {
-	Details        string  `bson:"Details"`
-	PostingDate    string  `bson:"PostingDate"`
-	Description    string  `bson:"Description"`
-	Amount         float64 `bson:"Amount"`
-	Category       string  `bson:"category"` // New field
-	Type           string  `bson:"Type"`
-	Balance        float64 `bson:"Balance"`
-	CheckOrSlipNum string  `bson:"CheckOrSlipNum"`
-	DataSource     string  `bson:"dataSource"` // New field
-	AccountID      string  `bson:"accountID"`  // New field
+	SchemaVersion  int         `bson:"schemaVersion"`
+	Details        string      `bson:"details"`
+	PostingDate    time.Time   `bson:"postingDate"`
+	Description    string      `bson:"description"`
+	Amount         money.Money `bson:"amount"`
+	Category       string      `bson:"category"` // New field
+	Type           string      `bson:"type"`
+	Balance        money.Money `bson:"balance"`
+	CheckOrSlipNum string      `bson:"checkOrSlipNum"`
+	DataSource     string      `bson:"dataSource"` // New field
+	AccountID      string      `bson:"accountID"`  // New field
 }
 
 // GenerateSyntheticDocuments generates a slice of synthetic data documents.
 func GenerateSyntheticDocuments(rows int) []Data {
 	documents := make([]Data, rows)
+	year, month, day := time.Now().Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
 	for i := range rows {
 		//nolint:gosec // G404: Use of weak random number generator is acceptable for non-sensitive test data.
-		amount := rand.Float64() * maxAmount
+		amount := money.New(rand.Int64N(maxAmount), "")
 		//nolint:gosec // G404: Use of weak random number generator is acceptable for non-sensitive test data.
-		balance := rand.Float64() * maxBalance
+		balance := money.New(rand.Int64N(maxBalance), "")
 		//nolint:gosec // G404: Use of weak random number generator is acceptable for non-sensitive test data.
 		accountID := fmt.Sprintf("%04d", rand.IntN(maxAccountID)) // Random 4-digit account ID
 		documents[i] = Data{
+			SchemaVersion:  model.SchemaVersion,
 			Details:        "SALE",
-			PostingDate:    time.Now().Format("01/02/2006"),
+			PostingDate:    today,
 			Description:    fmt.Sprintf("Synthetic transaction %d", i),
 			Amount:         amount,
 			Category:       "synthetic",
@@ -143,12 +149,12 @@ func GenerateSyntheticData(rows int, dir string) error {
 	for _, record := range documents {
 		row := []string{
 			record.Details,
-			record.PostingDate,
+			record.PostingDate.Format("01/02/2006"),
 			record.Description,
 			record.Category,
-			fmt.Sprintf("%.2f", record.Amount),
+			record.Amount.Decimal(),
 			record.Type,
-			fmt.Sprintf("%.2f", record.Balance),
+			record.Balance.Decimal(),
 			record.CheckOrSlipNum,
 		}
 		if err = writer.Write(row); err != nil {
@@ -0,0 +1,300 @@
+package xlsxparser
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Parts of the workbook package read by the parser.
+const (
+	partWorkbook      = "xl/workbook.xml"
+	partWorkbookRels  = "xl/_rels/workbook.xml.rels"
+	partSharedStrings = "xl/sharedStrings.xml"
+	partStyles        = "xl/styles.xml"
+)
+
+// errMissingPart is returned by decodePart when the archive has no such part.
+var errMissingPart = errors.New("missing workbook part")
+
+// workbook is the metadata needed to read one of a workbook's sheets.
+type workbook struct {
+	// sheets maps sheet names to their part names, in workbook order.
+	sheets []sheetRef
+	// sharedStrings holds the workbook's shared string table.
+	sharedStrings []string
+	// styles holds, per cell style index, how the style formats numbers.
+	styles []numberFormat
+	// date1904 is set when serial dates count from 1904 rather than 1900.
+	date1904 bool
+}
+
+type sheetRef struct {
+	name string
+	part string
+}
+
+// openWorkbook reads the workbook, relationship, shared string and style parts.
+func openWorkbook(archive *zip.Reader) (*workbook, error) {
+	var doc struct {
+		Properties struct {
+			Date1904 string `xml:"date1904,attr"`
+		} `xml:"workbookPr"`
+		Sheets []struct {
+			Name  string     `xml:"name,attr"`
+			Attrs []xml.Attr `xml:",any,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodePart(archive, partWorkbook, &doc); err != nil {
+		return nil, err
+	}
+
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodePart(archive, partWorkbookRels, &rels); err != nil {
+		return nil, err
+	}
+	targets := make(map[string]string, len(rels.Relationships))
+	for _, rel := range rels.Relationships {
+		targets[rel.ID] = resolveTarget(rel.Target)
+	}
+
+	wb := &workbook{date1904: doc.Properties.Date1904 == "1" || doc.Properties.Date1904 == "true"}
+	for _, sheet := range doc.Sheets {
+		// The relationship ID attribute's namespace differs between transitional and strict files.
+		for _, attr := range sheet.Attrs {
+			if attr.Name.Local == "id" {
+				wb.sheets = append(wb.sheets, sheetRef{name: sheet.Name, part: targets[attr.Value]})
+				break
+			}
+		}
+	}
+
+	var err error
+	if wb.sharedStrings, err = readSharedStrings(archive); err != nil {
+		return nil, err
+	}
+	if wb.styles, err = readStyles(archive); err != nil {
+		return nil, err
+	}
+
+	return wb, nil
+}
+
+// sheet returns the part of the named sheet, or of the first sheet when name is empty.
+func (wb *workbook) sheet(name string) (sheetRef, error) {
+	if len(wb.sheets) == 0 {
+		return sheetRef{}, errors.New("workbook has no sheets")
+	}
+	if name == "" {
+		return wb.sheets[0], nil
+	}
+	for _, sheet := range wb.sheets {
+		if strings.EqualFold(sheet.name, name) {
+			return sheet, nil
+		}
+	}
+	return sheetRef{}, fmt.Errorf("workbook has no sheet named %q", name)
+}
+
+// numberFormat is what the reader needs to know of a cell style's number format.
+type numberFormat struct {
+	// date is set when the format displays numbers as dates.
+	date bool
+	// decimals is the number of decimal places the format shows, when fixed is set.
+	decimals int
+	fixed    bool
+}
+
+// style returns the number format of the cell style with the given index, which is the
+// General format when the index is empty or unknown.
+func (wb *workbook) style(style string) numberFormat {
+	if style == "" {
+		return numberFormat{}
+	}
+	index, err := strconv.Atoi(style)
+	if err != nil || index < 0 || index >= len(wb.styles) {
+		return numberFormat{}
+	}
+	return wb.styles[index]
+}
+
+// resolveTarget turns a relationship target into a part name within the archive.
+func resolveTarget(target string) string {
+	if strings.HasPrefix(target, "/") {
+		return strings.TrimPrefix(target, "/")
+	}
+	return path.Join("xl", target)
+}
+
+// readSharedStrings reads the shared string table, joining the runs of rich text strings.
+func readSharedStrings(archive *zip.Reader) ([]string, error) {
+	var doc struct {
+		Items []struct {
+			Text string `xml:"t"`
+			Runs []struct {
+				Text string `xml:"t"`
+			} `xml:"r"`
+		} `xml:"si"`
+	}
+	if err := decodePart(archive, partSharedStrings, &doc); err != nil {
+		if errors.Is(err, errMissingPart) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	table := make([]string, len(doc.Items))
+	for i, item := range doc.Items {
+		if len(item.Runs) == 0 {
+			table[i] = item.Text
+			continue
+		}
+		var builder strings.Builder
+		for _, run := range item.Runs {
+			builder.WriteString(run.Text)
+		}
+		table[i] = builder.String()
+	}
+	return table, nil
+}
+
+// builtinDateFormats are the predefined number format IDs that display dates.
+var builtinDateFormats = map[int]bool{
+	14: true, 15: true, 16: true, 17: true, 22: true,
+	27: true, 28: true, 29: true, 30: true, 31: true, 32: true, 33: true, 34: true, 35: true, 36: true,
+	50: true, 51: true, 52: true, 53: true, 54: true, 55: true, 56: true, 57: true, 58: true,
+}
+
+// builtinDecimalFormats are the predefined number format IDs that show a fixed number of
+// decimal places, and how many.
+var builtinDecimalFormats = map[int]int{
+	2: 2, 4: 2, 7: 2, 8: 2, 39: 2, 40: 2, 43: 2, 44: 2,
+}
+
+// readStyles works out the number format each cell style applies.
+func readStyles(archive *zip.Reader) ([]numberFormat, error) {
+	var doc struct {
+		NumFmts []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		CellXfs []struct {
+			NumFmtID int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if err := decodePart(archive, partStyles, &doc); err != nil {
+		if errors.Is(err, errMissingPart) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	custom := make(map[int]numberFormat, len(doc.NumFmts))
+	for _, format := range doc.NumFmts {
+		decimals, fixed := formatDecimals(format.Code)
+		custom[format.ID] = numberFormat{date: isDateFormat(format.Code), decimals: decimals, fixed: fixed}
+	}
+
+	styles := make([]numberFormat, len(doc.CellXfs))
+	for i, xf := range doc.CellXfs {
+		if format, ok := custom[xf.NumFmtID]; ok {
+			styles[i] = format
+			continue
+		}
+		decimals, fixed := builtinDecimalFormats[xf.NumFmtID]
+		styles[i] = numberFormat{date: builtinDateFormats[xf.NumFmtID], decimals: decimals, fixed: fixed}
+	}
+	return styles, nil
+}
+
+// isDateFormat reports whether a custom number format code displays a date. Quoted
+// literals, bracketed sections and escaped characters are ignored, and a format must
+// show a day or year; months alone are indistinguishable from minutes.
+func isDateFormat(code string) bool {
+	var (
+		inQuotes  bool
+		inBracket bool
+		escaped   bool
+	)
+	for _, r := range strings.ToLower(code) {
+		switch {
+		case escaped:
+			escaped = false
+		case inQuotes:
+			inQuotes = r != '"'
+		case inBracket:
+			inBracket = r != ']'
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			inQuotes = true
+		case r == '[':
+			inBracket = true
+		case r == 'd' || r == 'y':
+			return true
+		}
+	}
+	return false
+}
+
+// formatDecimals returns the number of decimal places a custom number format code shows
+// for positive numbers. Padding (_x) and fill (*x) characters are skipped like escaped ones.
+// It reports false for formats without a decimal point, and for
+// percentages and scientific notation, which do not show the cell's value as it is.
+func formatDecimals(code string) (int, bool) {
+	var (
+		inQuotes  bool
+		inBracket bool
+		escaped   bool
+		point     bool
+		decimals  int
+	)
+	for _, r := range strings.ToLower(code) {
+		switch {
+		case escaped:
+			escaped = false
+		case inQuotes:
+			inQuotes = r != '"'
+		case inBracket:
+			inBracket = r != ']'
+		case r == '\\' || r == '_' || r == '*':
+			escaped = true
+		case r == '"':
+			inQuotes = true
+		case r == '[':
+			inBracket = true
+		case r == ';':
+			return decimals, point
+		case r == '%' || r == 'e':
+			return 0, false
+		case r == '.':
+			point = true
+		case point && (r == '0' || r == '#' || r == '?'):
+			decimals++
+		}
+	}
+	return decimals, point
+}
+
+// decodePart unmarshals an XML part of the archive into v.
+func decodePart(archive *zip.Reader, name string, v any) error {
+	file, err := archive.Open(name)
+	if err != nil {
+		return fmt.Errorf("%w %s: %w", errMissingPart, name, err)
+	}
+	defer file.Close()
+
+	if err = xml.NewDecoder(file).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", name, err)
+	}
+	return nil
+}
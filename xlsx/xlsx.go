@@ -0,0 +1,451 @@
+// Package xlsxparser reads rows from Office Open XML (.xlsx) spreadsheets.
+package xlsxparser
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	csvparser "babylon/dataloader/csv"
+)
+
+// Cell types, from the t attribute of a <c> element.
+const (
+	cellShared  = "s"
+	cellInline  = "inlineStr"
+	cellFormula = "str"
+	cellBoolean = "b"
+	cellError   = "e"
+	cellDate    = "d"
+)
+
+const (
+	// defaultLayout is the layout date cells are written in.
+	defaultLayout = "2006-01-02"
+	// dateTimeLayout is used for date cells that carry a time of day.
+	dateTimeLayout = "2006-01-02T15:04:05"
+	// headerScanRows is the number of rows searched for the header row.
+	headerScanRows = 20
+	// minHeaderCells is the number of labels a row needs to be taken as the header.
+	minHeaderCells = 2
+	// significantDigits is the precision Excel keeps for numbers.
+	significantDigits = 15
+)
+
+// Serial date epochs. The 1900 system's epoch absorbs Excel's phantom 29 February 1900.
+var (
+	epoch1900 = time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+	epoch1904 = time.Date(1904, time.January, 1, 0, 0, 0, 0, time.UTC)
+)
+
+var (
+	errInvalidWorkbook = errors.New("invalid XLSX workbook")
+	errNoHeader        = errors.New("no header row found")
+)
+
+// InvalidWorkbookError is returned when a workbook cannot be read.
+func InvalidWorkbookError(filePath string, cause error) error {
+	return fmt.Errorf("%w, %s: %w", errInvalidWorkbook, filePath, cause)
+}
+
+// Sheet selects where a data source's rows are read from.
+type Sheet struct {
+	// Name is the worksheet to read. The first sheet is read when it is empty.
+	Name string `json:"name,omitempty"`
+	// HeaderRow is the 1-based row holding the column headers. It is detected when zero.
+	HeaderRow int `json:"headerRow,omitempty"`
+}
+
+// LoadSheets reads per-data-source sheet settings from a JSON file of the form
+// {"accountant": {"name": "Transactions", "headerRow": 3}}.
+func LoadSheets(path string) (map[string]Sheet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sheet settings %s: %w", path, err)
+	}
+
+	var sheets map[string]Sheet
+	if err = json.Unmarshal(data, &sheets); err != nil {
+		return nil, fmt.Errorf("failed to decode sheet settings %s: %w", path, err)
+	}
+	for source, sheet := range sheets {
+		if sheet.HeaderRow < 0 {
+			return nil, fmt.Errorf("invalid sheet settings for %s: header row %d", source, sheet.HeaderRow)
+		}
+	}
+
+	return sheets, nil
+}
+
+// Parser is a csvparser.Parser for XLSX workbooks. It yields the same lowercased
+// header-to-value row maps as csvparser.DefaultParser.
+type Parser struct {
+	// Sheets holds per-data-source sheet settings.
+	Sheets map[string]Sheet
+}
+
+// NewParser creates a new Parser.
+func NewParser() *Parser {
+	return &Parser{}
+}
+
+// row is a sheet row with its cells already converted to text.
+type row struct {
+	number int64
+	cells  []string
+	// numeric marks the cells that hold numbers, written as plain decimals.
+	numeric []bool
+}
+
+// Parse streams the rows below the header row of the data source's sheet to handle.
+// Empty rows are skipped, and date-formatted cells are written as 2006-01-02.
+func (p *Parser) Parse(
+	ctx context.Context,
+	filePath string,
+	dataSource string,
+	_ string,
+	handle csvparser.RecordHandler,
+) (csvparser.Summary, error) {
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return csvparser.Summary{}, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer archive.Close()
+
+	wb, err := openWorkbook(&archive.Reader)
+	if err != nil {
+		return csvparser.Summary{}, InvalidWorkbookError(filePath, err)
+	}
+	settings := p.Sheets[dataSource]
+	sheet, err := wb.sheet(settings.Name)
+	if err != nil {
+		return csvparser.Summary{}, InvalidWorkbookError(filePath, err)
+	}
+	part, err := archive.Open(sheet.part)
+	if err != nil {
+		return csvparser.Summary{}, InvalidWorkbookError(filePath, err)
+	}
+	defer part.Close()
+
+	var (
+		summary csvparser.Summary
+		header  []string
+		// scanned buffers the rows searched for the header.
+		scanned []row
+	)
+	emit := func(r row) error {
+		if isEmpty(r.cells) {
+			return nil
+		}
+		doc := make(map[string]string, len(header))
+		numeric := make(map[string]bool)
+		for i, key := range header {
+			if key == "" {
+				continue
+			}
+			if i < len(r.cells) {
+				doc[key] = r.cells[i]
+				if r.numeric[i] {
+					numeric[key] = true
+				}
+			} else {
+				doc[key] = ""
+			}
+		}
+		if handleErr := handle(ctx, csvparser.Record{Line: r.number, Fields: doc, Numeric: numeric}); handleErr != nil {
+			return handleErr
+		}
+		summary.Records++
+		return nil
+	}
+
+	// detectHeader picks the header from the scanned rows and emits the rows below it.
+	detectHeader := func() error {
+		index := headerIndex(scanned)
+		if index < 0 {
+			return InvalidWorkbookError(filePath, errNoHeader)
+		}
+		header = headerKeys(scanned[index].cells)
+		for _, r := range scanned[index+1:] {
+			if emitErr := emit(r); emitErr != nil {
+				return emitErr
+			}
+		}
+		scanned = nil
+		return nil
+	}
+
+	rows := newRowReader(part, wb)
+	for {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return summary, fmt.Errorf("parsing %s was interrupted: %w", filePath, ctxErr)
+		}
+
+		r, readErr := rows.next()
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+		if readErr != nil {
+			return summary, InvalidWorkbookError(filePath, readErr)
+		}
+
+		if header != nil {
+			if err = emit(r); err != nil {
+				return summary, err
+			}
+			continue
+		}
+
+		if settings.HeaderRow > 0 {
+			if r.number == int64(settings.HeaderRow) {
+				header = headerKeys(r.cells)
+			}
+			continue
+		}
+
+		scanned = append(scanned, r)
+		if len(scanned) < headerScanRows {
+			continue
+		}
+		if err = detectHeader(); err != nil {
+			return summary, err
+		}
+	}
+
+	if header == nil && len(scanned) > 0 {
+		if err = detectHeader(); err != nil {
+			return summary, err
+		}
+	}
+
+	return summary, nil
+}
+
+// headerIndex returns the index of the header row: the first of the widest rows made up
+// entirely of text labels. Title rows above a table have fewer cells; data rows have
+// numbers or dates.
+func headerIndex(rows []row) int {
+	best, bestWidth := -1, 0
+	for i, r := range rows {
+		width := 0
+		labels := true
+		for _, cell := range r.cells {
+			if cell == "" {
+				continue
+			}
+			width++
+			if _, err := strconv.ParseFloat(cell, 64); err == nil || looksLikeDate(cell) {
+				labels = false
+				break
+			}
+		}
+		if labels && width >= minHeaderCells && width > bestWidth {
+			best, bestWidth = i, width
+		}
+	}
+	return best
+}
+
+// headerKeys lowercases the header cells as csvparser.DefaultParser does.
+func headerKeys(cells []string) []string {
+	keys := make([]string, len(cells))
+	for i, cell := range cells {
+		keys[i] = strings.ToLower(cell)
+	}
+	return keys
+}
+
+func isEmpty(cells []string) bool {
+	for _, cell := range cells {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// looksLikeDate reports whether a cell holds a date this parser wrote.
+func looksLikeDate(cell string) bool {
+	if _, err := time.Parse(defaultLayout, cell); err == nil {
+		return true
+	}
+	_, err := time.Parse(dateTimeLayout, cell)
+	return err == nil
+}
+
+// serialDate converts an Excel serial day number to a date, keeping any time of day.
+func serialDate(serial float64, date1904 bool) string {
+	epoch := epoch1900
+	if date1904 {
+		epoch = epoch1904
+	}
+	days := math.Floor(serial)
+	seconds := math.Round((serial - days) * 24 * 60 * 60)
+	date := epoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+	if seconds == 0 {
+		return date.Format(defaultLayout)
+	}
+	return date.Format(dateTimeLayout)
+}
+
+// rowReader streams the rows of a worksheet part.
+type rowReader struct {
+	decoder *xml.Decoder
+	wb      *workbook
+	// last is the number of the previous row, for rows without an r attribute.
+	last int64
+}
+
+func newRowReader(part io.Reader, wb *workbook) *rowReader {
+	return &rowReader{decoder: xml.NewDecoder(part), wb: wb}
+}
+
+type cellXML struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Style  string `xml:"s,attr"`
+	Value  string `xml:"v"`
+	Inline struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"is"`
+}
+
+type rowXML struct {
+	Number int64     `xml:"r,attr"`
+	Cells  []cellXML `xml:"c"`
+}
+
+// next returns the next <row> of the sheet, or io.EOF after the last.
+func (r *rowReader) next() (row, error) {
+	for {
+		tok, err := r.decoder.Token()
+		if err != nil {
+			return row{}, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+
+		var raw rowXML
+		if err = r.decoder.DecodeElement(&raw, &start); err != nil {
+			return row{}, fmt.Errorf("failed to decode row: %w", err)
+		}
+		if raw.Number == 0 {
+			raw.Number = r.last + 1
+		}
+		r.last = raw.Number
+
+		var (
+			cells   []string
+			numeric []bool
+		)
+		for i, c := range raw.Cells {
+			column := i
+			if c.Ref != "" {
+				if column, err = columnIndex(c.Ref); err != nil {
+					return row{}, err
+				}
+			}
+			for len(cells) <= column {
+				cells = append(cells, "")
+				numeric = append(numeric, false)
+			}
+			if cells[column], numeric[column], err = r.cellText(c); err != nil {
+				return row{}, fmt.Errorf("cell %s: %w", c.Ref, err)
+			}
+		}
+		return row{number: raw.Number, cells: cells, numeric: numeric}, nil
+	}
+}
+
+// cellText converts a cell to the text a CSV export of the sheet would hold, and reports
+// whether it is a number rather than text or a date.
+func (r *rowReader) cellText(c cellXML) (string, bool, error) {
+	switch c.Type {
+	case cellShared:
+		index, err := strconv.Atoi(c.Value)
+		if err != nil || index < 0 || index >= len(r.wb.sharedStrings) {
+			return "", false, fmt.Errorf("invalid shared string index %q", c.Value)
+		}
+		return strings.TrimSpace(r.wb.sharedStrings[index]), false, nil
+	case cellInline:
+		if len(c.Inline.Runs) == 0 {
+			return strings.TrimSpace(c.Inline.Text), false, nil
+		}
+		var builder strings.Builder
+		for _, run := range c.Inline.Runs {
+			builder.WriteString(run.Text)
+		}
+		return strings.TrimSpace(builder.String()), false, nil
+	case cellBoolean:
+		if c.Value == "1" {
+			return "TRUE", false, nil
+		}
+		return "FALSE", false, nil
+	case cellFormula, cellError:
+		return strings.TrimSpace(c.Value), false, nil
+	case cellDate:
+		if len(c.Value) > len(defaultLayout) && strings.HasSuffix(c.Value, "T00:00:00") {
+			return c.Value[:len(defaultLayout)], false, nil
+		}
+		return c.Value, false, nil
+	}
+
+	// Numeric cell.
+	if c.Value == "" {
+		return "", false, nil
+	}
+	number, err := strconv.ParseFloat(c.Value, 64)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid number %q: %w", c.Value, err)
+	}
+	format := r.wb.style(c.Style)
+	if format.date {
+		return serialDate(number, r.wb.date1904), false, nil
+	}
+	return formatNumber(number, format), true, nil
+}
+
+// formatNumber writes a number cell's value as a plain decimal. Computed values such as
+// 12.100000000000001 are rounded to the decimal places their format shows, or else to the
+// 15 significant digits Excel itself keeps.
+func formatNumber(number float64, format numberFormat) string {
+	if format.fixed {
+		return strconv.FormatFloat(number, 'f', format.decimals, 64)
+	}
+	rounded, err := strconv.ParseFloat(strconv.FormatFloat(number, 'g', significantDigits, 64), 64)
+	if err != nil {
+		rounded = number
+	}
+	return strconv.FormatFloat(rounded, 'f', -1, 64)
+}
+
+// columnIndex returns the 0-based column of a cell reference such as "AB12".
+func columnIndex(ref string) (int, error) {
+	column := 0
+	letters := 0
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		column = column*26 + int(ch-'A'+1)
+		letters++
+	}
+	if letters == 0 {
+		return 0, fmt.Errorf("invalid cell reference %q", ref)
+	}
+	return column - 1, nil
+}
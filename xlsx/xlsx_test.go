@@ -0,0 +1,198 @@
+package xlsxparser_test
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	csvparser "babylon/dataloader/csv"
+	. "babylon/dataloader/xlsx"
+)
+
+const (
+	workbookXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+  xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+  <workbookPr %s/>
+  <sheets>
+    <sheet name="Summary" sheetId="1" r:id="rId1"/>
+    <sheet name="Transactions" sheetId="2" r:id="rId2"/>
+  </sheets>
+</workbook>`
+
+	relsXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+  <Relationship Id="rId1" Type="worksheet" Target="worksheets/sheet1.xml"/>
+  <Relationship Id="rId2" Type="worksheet" Target="/xl/worksheets/sheet2.xml"/>
+</Relationships>`
+
+	sharedStringsXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+  <si><t>Account statement</t></si>
+  <si><t>Posting Date</t></si>
+  <si><t>Description</t></si>
+  <si><t>Amount</t></si>
+  <si><r><t>Coffee </t></r><r><t>&amp; Bagels</t></r></si>
+</sst>`
+
+	// Style 1 uses built-in date format 14, style 2 a custom day-first format,
+	// style 3 a custom number format with a quoted "d" and style 4 built-in format
+	// 4, #,##0.00.
+	stylesXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+  <numFmts>
+    <numFmt numFmtId="164" formatCode="dd.mm.yyyy"/>
+    <numFmt numFmtId="165" formatCode="0.00&quot; d&quot;"/>
+  </numFmts>
+  <cellXfs>
+    <xf numFmtId="0"/>
+    <xf numFmtId="14"/>
+    <xf numFmtId="164"/>
+    <xf numFmtId="165"/>
+    <xf numFmtId="4"/>
+  </cellXfs>
+</styleSheet>`
+
+	// A title row and a blank row sit above the table.
+	summarySheetXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+  <row r="1"><c r="A1" t="s"><v>0</v></c></row>
+  <row r="3"><c r="A3" t="s"><v>1</v></c><c r="B3" t="s"><v>2</v></c><c r="C3" t="s"><v>3</v></c></row>
+  <row r="4"><c r="A4" s="1"><v>44957</v></c><c r="B4" t="s"><v>4</v></c><c r="C4" s="3"><v>-4.5</v></c></row>
+  <row r="5"></row>
+  <row r="6"><c r="A6" s="2"><v>44958.5</v></c><c r="B6" t="inlineStr"><is><t>Salary</t></is></c><c r="C6"><v>1500</v></c></row>
+  <row r="7"><c r="A7" s="1"><v>44959</v></c><c r="C7"><v>-1</v></c></row>
+  <row r="8"><c r="A8" s="1"><v>44960</v></c><c r="C8"><f>C6*0.0080666666666667</f><v>12.100000000000001</v></c></row>
+  <row r="9"><c r="A9" s="1"><v>44961</v></c><c r="C9" s="4"><f>C6/45</f><v>33.333333333333336</v></c></row>
+</sheetData></worksheet>`
+
+	transactionsSheetXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+  <row r="1"><c r="A1" t="inlineStr"><is><t>Date</t></is></c><c r="B1" t="inlineStr"><is><t>Total</t></is></c></row>
+  <row r="2"><c r="A2" t="inlineStr"><is><t>Datum</t></is></c><c r="B2" t="inlineStr"><is><t>Betrag</t></is></c></row>
+  <row r="3"><c r="A3" s="1"><v>0</v></c><c r="B3" t="b"><v>1</v></c></row>
+</sheetData></worksheet>`
+)
+
+// writeWorkbook writes a two-sheet workbook to a temporary directory.
+func writeWorkbook(t *testing.T, workbookProperties string) string {
+	filePath := filepath.Join(t.TempDir(), "export.xlsx")
+	file, err := os.Create(filePath)
+	if err != nil {
+		t.Fatalf("failed to create test XLSX file: %v", err)
+	}
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	parts := map[string]string{
+		"xl/workbook.xml":            fmt.Sprintf(workbookXML, workbookProperties),
+		"xl/_rels/workbook.xml.rels": relsXML,
+		"xl/sharedStrings.xml":       sharedStringsXML,
+		"xl/styles.xml":              stylesXML,
+		"xl/worksheets/sheet1.xml":   summarySheetXML,
+		"xl/worksheets/sheet2.xml":   transactionsSheetXML,
+	}
+	for name, content := range parts {
+		w, createErr := archive.Create(name)
+		if createErr != nil {
+			t.Fatalf("failed to add %s: %v", name, createErr)
+		}
+		if _, writeErr := w.Write([]byte(content)); writeErr != nil {
+			t.Fatalf("failed to write %s: %v", name, writeErr)
+		}
+	}
+	if err = archive.Close(); err != nil {
+		t.Fatalf("failed to close test XLSX file: %v", err)
+	}
+	return filePath
+}
+
+// parseAll runs parser over filePath and collects every record it yields.
+func parseAll(t *testing.T, parser *Parser, filePath string, dataSource string) []csvparser.Record {
+	var records []csvparser.Record
+	summary, err := parser.Parse(context.Background(), filePath, dataSource, "",
+		func(_ context.Context, record csvparser.Record) error {
+			records = append(records, record)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if summary.Records != int64(len(records)) {
+		t.Errorf("Expected summary to count %d records, got %d", len(records), summary.Records)
+	}
+	return records
+}
+
+func TestParse_FirstSheetDetectsHeader(t *testing.T) {
+	records := parseAll(t, NewParser(), writeWorkbook(t, ""), "generic")
+	if len(records) != 5 {
+		t.Fatalf("Expected 5 records, got %d", len(records))
+	}
+
+	tests := []struct {
+		line int64
+		want map[string]string
+	}{
+		{4, map[string]string{"posting date": "2023-01-31", "description": "Coffee & Bagels", "amount": "-4.50"}},
+		{6, map[string]string{"posting date": "2023-02-01T12:00:00", "description": "Salary", "amount": "1500"}},
+		// Missing trailing or middle cells are empty, as in a CSV row.
+		{7, map[string]string{"posting date": "2023-02-02", "description": "", "amount": "-1"}},
+		// Formula results lose their float noise, rounded to the decimals their format shows.
+		{8, map[string]string{"posting date": "2023-02-03", "amount": "12.1"}},
+		{9, map[string]string{"posting date": "2023-02-04", "amount": "33.33"}},
+	}
+	for i, tt := range tests {
+		if records[i].Line != tt.line {
+			t.Errorf("record %d: expected line %d, got %d", i, tt.line, records[i].Line)
+		}
+		for key, value := range tt.want {
+			if got, ok := records[i].Fields[key]; !ok || got != value {
+				t.Errorf("record %d: expected %s %q, got %q", i, key, value, got)
+			}
+		}
+	}
+}
+
+func TestParse_ConfiguredSheet(t *testing.T) {
+	parser := NewParser()
+	parser.Sheets = map[string]Sheet{"dkb": {Name: "transactions", HeaderRow: 2}}
+
+	records := parseAll(t, parser, writeWorkbook(t, `date1904="1"`), "dkb")
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(records))
+	}
+	got := records[0].Fields
+	if got["datum"] != "1904-01-01" || got["betrag"] != "TRUE" {
+		t.Errorf("Unexpected record %v", got)
+	}
+}
+
+func TestParse_UnknownSheet(t *testing.T) {
+	parser := NewParser()
+	parser.Sheets = map[string]Sheet{"dkb": {Name: "Missing"}}
+
+	_, err := parser.Parse(context.Background(), writeWorkbook(t, ""), "dkb", "",
+		func(context.Context, csvparser.Record) error { return nil })
+	if err == nil {
+		t.Fatal("Expected an error for a missing sheet")
+	}
+}
+
+func TestLoadSheets(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "sheets.json")
+	if err := os.WriteFile(filePath, []byte(`{"dkb": {"name": "Umsätze", "headerRow": 3}}`), 0o644); err != nil {
+		t.Fatalf("failed to write sheet settings: %v", err)
+	}
+
+	sheets, err := LoadSheets(filePath)
+	if err != nil {
+		t.Fatalf("LoadSheets failed: %v", err)
+	}
+	if want := (Sheet{Name: "Umsätze", HeaderRow: 3}); sheets["dkb"] != want {
+		t.Errorf("Expected %+v, got %+v", want, sheets["dkb"])
+	}
+}